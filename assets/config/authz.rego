@@ -14,7 +14,8 @@ allow = response {
     pathstart == ["api", "v0"]
 
     response := {
-        "tenants": token.payload.tenants
+        "tenants": token.payload.tenants,
+        "user": object.get(token.payload, "preferred_username", object.get(token.payload, "sub", ""))
     }
 }
 
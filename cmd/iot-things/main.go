@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/diwise/iot-things/internal/app/api"
 	app "github.com/diwise/iot-things/internal/app/iot-things"
@@ -34,11 +36,14 @@ func main() {
 	ctx, log, cleanup := o11y.Init(ctx, serviceName, serviceVersion, "json")
 	defer cleanup()
 
-	var opa, fp, cfgFile string
+	var opa, fp, fpType, cfgFile string
+	var dryRun bool
 
 	flag.StringVar(&opa, "policies", "/opt/diwise/config/authz.rego", "An authorization policy file")
 	flag.StringVar(&fp, "things", "/opt/diwise/config/things.csv", "A file with things")
+	flag.StringVar(&fpType, "things-type", "", "The content type of the file with things, e.g. application/geo+json. Given by the file extension if not set")
 	flag.StringVar(&cfgFile, "config", "/opt/diwise/config/config.yaml", "A yaml file with configuration")
+	flag.BoolVar(&dryRun, "dry-run", false, "Validate the file with things and report the changes it would make, without seeding it or starting the service")
 	flag.Parse()
 
 	s, err := storage.New(ctx, storage.LoadConfiguration(ctx))
@@ -54,7 +59,7 @@ func main() {
 	}
 	messenger.Start()
 
-	a, err := newApp(ctx, s, s, messenger, cfgFile)
+	a, err := newApp(ctx, s, s, s, s, messenger, cfgFile)
 	if err != nil {
 		log.Error("could not configure application", "err", err.Error())
 		os.Exit(1)
@@ -68,12 +73,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	err = seed(ctx, fp, a)
+	err = seed(ctx, fp, app.SeedFormatOf(fpType, fp), a, dryRun)
 	if err != nil {
 		log.Error("file with things found but could not seed data", "err", err.Error())
 		os.Exit(1)
 	}
 
+	if dryRun {
+		messenger.Close()
+		s.Close()
+		return
+	}
+
 	port := env.GetVariableOrDefault(ctx, "SERVICE_PORT", "8080")
 
 	webServer := &http.Server{Addr: ":" + port, Handler: r}
@@ -94,14 +105,23 @@ func main() {
 	s.Close()
 }
 
-func newApp(ctx context.Context, r app.ThingsReader, w app.ThingsWriter, m messaging.MsgContext, cfgFilePath string) (app.ThingsApp, error) {
+func newApp(ctx context.Context, r app.ThingsReader, w app.ThingsWriter, o app.ThingsOutbox, t app.ThingsTransactor, m messaging.MsgContext, cfgFilePath string) (app.ThingsApp, error) {
 	f, err := os.Open(cfgFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open config file: %s", err.Error())
 	}
 	defer f.Close()
 
-	a := app.New(ctx, r, w, m)
+	numberOfWorkers, _ := strconv.Atoi(env.GetVariableOrDefault(ctx, "MEASUREMENT_WORKERS", strconv.Itoa(app.DefaultNumberOfWorkers)))
+	queueSize, _ := strconv.Atoi(env.GetVariableOrDefault(ctx, "MEASUREMENT_QUEUE_SIZE", strconv.Itoa(app.DefaultQueueSize)))
+
+	// deleted things are kept until they are purged, unless a retention period (e.g. 720h) is configured
+	retention, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "DELETED_THINGS_RETENTION", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention period for deleted things: %s", err.Error())
+	}
+
+	a := app.New(ctx, r, w, m, app.WithWorkers(numberOfWorkers, queueSize), app.WithOutbox(o), app.WithTransactions(t), app.WithRetention(retention))
 	err = a.LoadConfig(ctx, f)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load config: %s", err.Error())
@@ -125,7 +145,7 @@ func newRouter(ctx context.Context, opa string, a app.ThingsApp) (*chi.Mux, erro
 	return r, nil
 }
 
-func seed(ctx context.Context, fp string, a app.ThingsApp) error {
+func seed(ctx context.Context, fp string, format app.SeedFormat, a app.ThingsApp, dryRun bool) error {
 	log := logging.GetFromContext(ctx)
 	things, err := os.Open(fp)
 	if err != nil {
@@ -137,5 +157,24 @@ func seed(ctx context.Context, fp string, a app.ThingsApp) error {
 	}
 	defer things.Close()
 
-	return a.Seed(ctx, things)
+	// the file with things at startup may seed things in every tenant
+	report, err := a.Seed(ctx, things, format, dryRun, nil)
+
+	for _, row := range report.Rows {
+		for _, e := range row.Errors {
+			log.Error("row in file with things is not valid", "row", row.Row, "id", row.ID, "err", e.Error())
+		}
+		for _, w := range row.Warnings {
+			log.Warn("row in file with things has a warning", "row", row.Row, "id", row.ID, "warning", w)
+		}
+		if row.Action == app.SeedUpdate {
+			log.Debug("thing is updated", "row", row.Row, "id", row.ID, "diff", string(row.Diff))
+		}
+	}
+
+	log.Info("file with things read", "path", fp, "format", format, "dryRun", dryRun, "rows", len(report.Rows),
+		"created", report.Count(app.SeedCreate), "updated", report.Count(app.SeedUpdate),
+		"unchanged", report.Count(app.SeedUnchanged), "failed", report.Failed())
+
+	return err
 }
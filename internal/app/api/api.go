@@ -1,14 +1,17 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -48,14 +51,22 @@ func Register(ctx context.Context, app app.ThingsApp, policies io.Reader) (*chi.
 			r.Route("/things", func(r chi.Router) {
 				r.Get("/", queryHandler(log, app))
 				r.Get("/{id}", getByIDHandler(log, app))
+				r.Get("/{id}/history", getHistoryHandler(log, app))
 				r.Post("/", addHandler(log, app))
+				r.Post("/$batch", batchHandler(log, app))
+				r.Post("/{id}", connectHandler(log, app))
 				r.Put("/{id}", updateHandler(log, app))
 				r.Patch("/{id}", patchHandler(log, app))
 				r.Delete("/{id}", deleteHandler(log, app))
+				r.Post("/{id}/restore", restoreHandler(log, app))
+				r.Post("/{id}/devices", attachDeviceHandler(log, app))
+				r.Delete("/{id}/devices/{deviceID}", detachDeviceHandler(log, app))
 				r.Get("/tags", getTagsHandler(log, app))
 				r.Get("/types", getTypesHandler(log, app))
 				r.Get("/values", getValuesHandler(log, app))
 			})
+
+			r.Get("/devices/{deviceID}/things", getDeviceThingsHandler(log, app))
 		})
 	})
 
@@ -76,7 +87,14 @@ func queryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/vnd.api+json")
 
-		result, err := a.QueryThings(ctx, r.URL.Query())
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		result, err := a.QueryThings(ctx, r.URL.Query(), tenants)
+		if errors.Is(err, app.ErrInvalidGeometry) {
+			logger.Debug("invalid geo-query", "err", err.Error())
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
 		if err != nil {
 			logger.Error("could not query things", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -84,6 +102,25 @@ func queryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
+		if r.Header.Get("Accept") == "application/geo+json" {
+			fc, err := newFeatureCollection(result)
+			if err != nil {
+				logger.Error("could not create feature collection", "err", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			for _, link := range NewLinkHeaders(r, uint64(result.Count), uint64(result.TotalCount), uint64(result.Offset), uint64(result.Limit)) {
+				w.Header().Add("Link", link)
+			}
+
+			w.Header().Set("Content-Type", "application/geo+json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(fc.Byte())
+			return
+		}
+
 		if result.Count == 0 {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("[]"))
@@ -91,7 +128,8 @@ func queryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 		}
 
 		if r.Header.Get("Accept") == "text/csv" {
-			err := exportQueryResultAsCSV(result, w)
+			var buf bytes.Buffer
+			err := app.ExportCSV(&buf, result.Data)
 			if err != nil {
 				logger.Error("could not export query response as CSV", "err", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
@@ -101,6 +139,7 @@ func queryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 
 			w.Header().Set("Content-Type", "text/csv")
 			w.WriteHeader(http.StatusOK)
+			w.Write(buf.Bytes())
 
 			return
 		}
@@ -135,107 +174,27 @@ func queryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 	}
 }
 
-func exportQueryResultAsCSV(result app.QueryResult, w io.Writer) error {
-	if result.Count == 0 {
-		return nil
-	}
-
-	for i, b := range result.Data {
-		t, err := things.ConvToThing(b)
-		if err != nil {
-			return err
-		}
+func newFeatureCollection(result app.QueryResult) (FeatureCollection, error) {
+	features := make([]Feature, 0, len(result.Data))
 
+	for _, b := range result.Data {
 		m := make(map[string]any)
-		err = json.Unmarshal(b, &m)
+		err := json.Unmarshal(b, &m)
 		if err != nil {
-			return err
+			return FeatureCollection{}, err
 		}
 
-		if i == 0 {
-			header := strings.Join([]string{"id", "type", "subType", "name", "decsription", "location", "tenant", "tags", "refDevices", "args"}, ";")
-			_, err := w.Write([]byte(fmt.Sprintln(header)))
-			if err != nil {
-				return err
-			}
-		}
-
-		asString := func(v any) string {
-			if v == nil {
-				return ""
-			}
-			return fmt.Sprintf("%v", v)
-		}
-		asTags := func(v any) string {
-			if v == nil {
-				return ""
-			}
-			values := v.([]any)
-			tags := make([]string, len(values))
-			for i, tag := range values {
-				tags[i] = fmt.Sprintf("%v", tag)
-			}
+		mapToOutModel(m)
 
-			return strings.Join(tags, ",")
-		}
-		asRefDevices := func(v any) string {
-			if v == nil {
-				return ""
-			}
-			devices := v.([]any)
-			refDevices := make([]string, len(devices))
-			for i, device := range devices {
-				d := device.(map[string]any)
-				refDevices[i] = fmt.Sprintf("%v", d["deviceID"])
-			}
-			return strings.Join(refDevices, ",")
-		}
-		asArgs := func(m map[string]any) string {
-			args := []string{}
-
-			for k, v := range m {
-				if slices.Contains([]string{"maxd", "maxl", "meanl", "offset", "angle"}, k) {
-					args = append(args, fmt.Sprintf("'%s':%f", k, v.(float64)))
-				}
-				if slices.Contains([]string{"alternativeName"}, k) {
-					s := v.(string)
-					if s != "" {
-						args = append(args, fmt.Sprintf("'%s':'%s'", k, s))
-					}
-				}
-			}
-
-			if len(args) > 0 {
-				j := "{" + strings.Join(args, ",") + "}"
-				return j
-			}
-
-			return ""
-		}
-
-		lat, lon := t.LatLon()
-		values := []string{
-			t.ID(),
-			t.Type(),
-			asString(m["subType"]),
-			asString(m["name"]),
-			asString(m["description"]),
-			fmt.Sprintf("%f,%f", lat, lon),
-			t.Tenant(),
-			asTags(m["tags"]),
-			asRefDevices(m["refDevices"]),
-			asArgs(m),
-		}
-
-		row := strings.Join(values, ";")
-
-		_, err = w.Write([]byte(fmt.Sprintln(row)))
+		feature, err := NewFeature(b, m)
 		if err != nil {
-			return err
+			return FeatureCollection{}, err
 		}
+
+		features = append(features, feature)
 	}
 
-	return nil
+	return NewFeatureCollection(features), nil
 }
 
 func getByIDHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
@@ -255,7 +214,22 @@ func getByIDHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
-		result, err := a.QueryThings(ctx, map[string][]string{"id": {thingId}})
+		params := map[string][]string{"id": {thingId}}
+
+		// the thing as it was at asOf, from its history
+		asOf := r.URL.Query().Get("asOf")
+		if asOf != "" {
+			if _, err := time.Parse(time.RFC3339, asOf); err != nil {
+				logger.Debug("invalid asOf parameter", "asOf", asOf)
+				writeError(w, http.StatusBadRequest, fmt.Errorf("asOf must be a RFC3339 timestamp, %w", err))
+				return
+			}
+			params["asOf"] = []string{asOf}
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		result, err := a.QueryThings(ctx, params, tenants)
 		if err != nil {
 			logger.Debug("failed to query things", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -270,7 +244,10 @@ func getByIDHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 
 		q := r.URL.Query()
 		q.Set("thingid", thingId)
-		values, err := a.QueryValues(ctx, q)
+		q.Del("tenant")
+		q.Del("asOf")
+		q.Del("include")
+		values, err := a.QueryValues(ctx, q, tenants)
 		if err != nil {
 			logger.Debug("failed to query values", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -289,9 +266,83 @@ func getByIDHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 
 		thing["values"] = transformValues(r, values.Data)
 
+		var included []any
+
+		// include=children adds the things that are parts of the thing, i.e. have the thing as refParent
+		if slices.Contains(includes(r), "children") {
+			params := map[string][]string{"refParent": {thingId}, "limit": {strconv.Itoa(maxIncluded)}}
+			if asOf != "" {
+				params["asOf"] = []string{asOf}
+			}
+
+			children, err := a.QueryThings(ctx, params, tenants)
+			if err != nil {
+				logger.Debug("failed to query children", "err", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			hasPart := make([]string, 0, len(children.Data))
+			for _, b := range children.Data {
+				child := make(map[string]any)
+				if err := json.Unmarshal(b, &child); err != nil {
+					continue
+				}
+				mapToOutModel(child)
+				hasPart = append(hasPart, fmt.Sprint(child["id"]))
+				included = append(included, child)
+			}
+
+			thing["hasPart"] = hasPart
+		}
+
 		mapToOutModel(thing)
 
 		response := NewApiResponse(r, thing, uint64(values.Count), uint64(values.TotalCount), uint64(values.Offset), uint64(values.Limit))
+		response.Included = included
+
+		if len(result.Versions) == 1 && asOf == "" {
+			w.Header().Set("ETag", etag(result.Versions[0]))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(response.Byte())
+	}
+}
+
+func getHistoryHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		ctx, span := tracer.Start(r.Context(), "get-thing-history")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		thingId := chi.URLParam(r, "id")
+		if thingId == "" {
+			logger.Error("no id parameter found in request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		result, err := a.QueryHistory(ctx, thingId, r.URL.Query(), tenants)
+		if err != nil {
+			logger.Error("could not query history", "err", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		entries := make([]json.RawMessage, 0, len(result.Data))
+		for _, b := range result.Data {
+			entries = append(entries, b)
+		}
+
+		response := NewApiResponse(r, entries, uint64(result.Count), uint64(result.TotalCount), uint64(result.Offset), uint64(result.Limit))
 
 		w.WriteHeader(http.StatusOK)
 		w.Write(response.Byte())
@@ -310,7 +361,7 @@ func addHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 			_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
 
-			file, _, err := r.FormFile("fileupload")
+			file, header, err := r.FormFile("fileupload")
 			if err != nil {
 				logger.Error("unable to get file from fileupload", "err", err.Error())
 				w.WriteHeader(http.StatusBadRequest)
@@ -318,7 +369,31 @@ func addHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			}
 			defer file.Close()
 
-			err = a.Seed(ctx, file)
+			format := app.SeedFormatOf(header.Header.Get("Content-Type"), header.Filename)
+			dryRun := r.URL.Query().Get("dryRun") == "true"
+
+			// a dry run is not seeded, it only reports the changes the file would make
+			status := http.StatusCreated
+			if dryRun {
+				status = http.StatusOK
+			}
+
+			tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+			report, err := a.Seed(ctx, file, format, dryRun, tenants)
+			if errors.Is(err, app.ErrSeedNotValid) {
+				logger.Warn("could not seed, file not valid", "failed", report.Failed())
+				if !dryRun {
+					status = http.StatusBadRequest
+				}
+				w.WriteHeader(status)
+				w.Write(NewSeedResponse(report).Byte())
+				return
+			}
+			if writeValidationError(w, err) {
+				logger.Warn("could not seed, thing not valid", "err", err.Error())
+				return
+			}
 			if err != nil {
 				logger.Error("could not seed", "err", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
@@ -326,7 +401,8 @@ func addHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 				return
 			}
 
-			w.WriteHeader(http.StatusCreated)
+			w.WriteHeader(status)
+			w.Write(NewSeedResponse(report).Byte())
 			return
 		}
 
@@ -342,11 +418,27 @@ func addHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
-		err = a.AddThing(ctx, b)
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		err = a.AddThing(ctx, b, tenants)
 		if err != nil && errors.Is(err, app.ErrAlreadyExists) {
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
+		if err != nil && errors.Is(err, app.ErrDeviceAttached) {
+			logger.Warn("could not create thing, device is attached", "err", err.Error())
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil && errors.Is(err, app.ErrTenantNotAllowed) {
+			logger.Warn("not allowed to create thing in tenant", "err", err.Error())
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if writeValidationError(w, err) {
+			logger.Warn("could not create thing, thing not valid", "err", err.Error())
+			return
+		}
 		if err != nil {
 			logger.Error("could not create thing", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -358,6 +450,62 @@ func addHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 	}
 }
 
+// connectHandler makes the thing in the body a part of the thing {id}, the thing is created if it does not exist
+func connectHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer r.Body.Close()
+
+		ctx, span := tracer.Start(r.Context(), "connect-thing")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		thingId := chi.URLParam(r, "id")
+		if thingId == "" {
+			logger.Error("no id parameter found in request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("could not read body", "err", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		err = a.ConnectThing(ctx, thingId, b, tenants)
+		if writeValidationError(w, err) {
+			logger.Warn("could not connect thing, thing not valid", "err", err.Error())
+			return
+		}
+		if err != nil {
+			logger.Warn("could not connect thing", "err", err.Error())
+
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, app.ErrThingNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, app.ErrAlreadyExists), errors.Is(err, app.ErrDeviceAttached):
+				status = http.StatusConflict
+			case errors.Is(err, app.ErrTenantNotAllowed):
+				status = http.StatusForbidden
+			case errors.Is(err, app.ErrMissingThingID), errors.Is(err, app.ErrMissingThingType), errors.Is(err, app.ErrMissingThingTenant):
+				status = http.StatusBadRequest
+			}
+
+			writeError(w, status, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func updateHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -376,9 +524,34 @@ func updateHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
 		tenants := auth.GetAllowedTenantsFromContext(ctx)
 
-		err = a.UpdateThing(ctx, b, tenants)
+		err = a.UpdateThing(ctx, b, version, tenants)
+		if writeValidationError(w, err) {
+			logger.Warn("could not update thing, thing not valid", "err", err.Error())
+			return
+		}
+		if errors.Is(err, app.ErrVersionConflict) {
+			logger.Warn("could not update thing, version does not match", "err", err.Error())
+			writeError(w, http.StatusPreconditionFailed, err)
+			return
+		}
+		if errors.Is(err, app.ErrDeviceAttached) {
+			logger.Warn("could not update thing, device is attached", "err", err.Error())
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, app.ErrProtectedProperty) {
+			logger.Warn("could not update thing, type or tenant is changed", "err", err.Error())
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
 		if err != nil {
 			logger.Error("could not update thing", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -416,12 +589,50 @@ func patchHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
 		tenants := auth.GetAllowedTenantsFromContext(ctx)
 
-		err = a.MergeThing(ctx, thingId, b, tenants)
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		switch contentType {
+		case "", "application/json", "application/merge-patch+json":
+			err = a.MergeThing(ctx, thingId, b, version, tenants)
+		case "application/json-patch+json":
+			err = a.PatchThing(ctx, thingId, b, version, tenants)
+		default:
+			logger.Warn("unsupported patch content type", "content_type", contentType)
+			w.Header().Set("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		if writeValidationError(w, err) {
+			logger.Warn("could not patch thing, thing not valid", "err", err.Error())
+			return
+		}
 		if err != nil {
-			logger.Error("could not patch thing", "err", err.Error())
-			w.WriteHeader(http.StatusBadRequest)
+			logger.Warn("could not patch thing", "err", err.Error())
+
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, app.ErrInvalidPatch):
+				status = http.StatusBadRequest
+			case errors.Is(err, app.ErrThingNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, app.ErrPatchTestFailed), errors.Is(err, app.ErrDeviceAttached):
+				status = http.StatusConflict
+			case errors.Is(err, app.ErrVersionConflict):
+				status = http.StatusPreconditionFailed
+			case errors.Is(err, app.ErrPatchNotPossible), errors.Is(err, app.ErrProtectedProperty):
+				status = http.StatusUnprocessableEntity
+			}
+
+			writeError(w, status, err)
 			return
 		}
 
@@ -447,9 +658,30 @@ func deleteHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 			return
 		}
 
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
 		tenants := auth.GetAllowedTenantsFromContext(ctx)
 
-		err = a.DeleteThing(ctx, thingId, tenants)
+		// purge removes the thing permanently, together with its history and values
+		if r.URL.Query().Get("purge") == "true" {
+			err = a.PurgeThing(ctx, thingId, version, tenants)
+		} else {
+			err = a.DeleteThing(ctx, thingId, version, tenants)
+		}
+		if errors.Is(err, app.ErrThingNotFound) {
+			logger.Debug("could not delete thing, thing not found", "id", thingId)
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, app.ErrVersionConflict) {
+			logger.Warn("could not delete thing, version does not match", "err", err.Error())
+			writeError(w, http.StatusPreconditionFailed, err)
+			return
+		}
 		if err != nil {
 			logger.Error("could not delete thing", "err", err.Error())
 			w.WriteHeader(http.StatusBadRequest)
@@ -460,6 +692,174 @@ func deleteHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 	}
 }
 
+func restoreHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer r.Body.Close()
+
+		ctx, span := tracer.Start(r.Context(), "restore-thing")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		thingId := chi.URLParam(r, "id")
+		if thingId == "" {
+			logger.Error("no id parameter found in request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		err = a.RestoreThing(ctx, thingId, version, tenants)
+		if err != nil {
+			logger.Warn("could not restore thing", "err", err.Error())
+
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, app.ErrThingNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, app.ErrVersionConflict):
+				status = http.StatusPreconditionFailed
+			case errors.Is(err, app.ErrDeviceAttached):
+				status = http.StatusConflict
+			}
+
+			writeError(w, status, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func attachDeviceHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer r.Body.Close()
+
+		ctx, span := tracer.Start(r.Context(), "attach-device")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		thingId := chi.URLParam(r, "id")
+		if thingId == "" {
+			logger.Error("no id parameter found in request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body := struct {
+			DeviceID    string `json:"deviceID"`
+			AllowShared bool   `json:"allowShared"`
+		}{}
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.DeviceID == "" {
+			logger.Warn("could not read device to attach")
+			writeError(w, http.StatusBadRequest, errors.New("body must contain a deviceID"))
+			return
+		}
+
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		err = a.AttachDevice(ctx, thingId, body.DeviceID, body.AllowShared, version, tenants)
+		if err != nil {
+			logger.Warn("could not attach device", "device_id", body.DeviceID, "err", err.Error())
+			writeError(w, deviceErrorStatus(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func detachDeviceHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer r.Body.Close()
+
+		ctx, span := tracer.Start(r.Context(), "detach-device")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+
+		thingId := chi.URLParam(r, "id")
+		deviceId := chi.URLParam(r, "deviceID")
+		if thingId == "" || deviceId == "" {
+			logger.Error("no id or deviceID parameter found in request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatch(r)
+		if !ok {
+			writeError(w, http.StatusPreconditionFailed, app.ErrVersionConflict)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		err = a.DetachDevice(ctx, thingId, deviceId, version, tenants)
+		if err != nil {
+			logger.Warn("could not detach device", "device_id", deviceId, "err", err.Error())
+			writeError(w, deviceErrorStatus(err), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func deviceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, app.ErrThingNotFound), errors.Is(err, app.ErrDeviceNotAttached):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrDeviceAttached):
+		return http.StatusConflict
+	case errors.Is(err, app.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getDeviceThingsHandler queries the things a device is attached to, with the same parameters and formats as queryHandler
+func getDeviceThingsHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	query := queryHandler(log, a)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceId := chi.URLParam(r, "deviceID")
+
+		r = r.Clone(r.Context())
+		q := r.URL.Query()
+		for k := range q {
+			if strings.EqualFold(k, "refdevice") {
+				q.Del(k)
+			}
+		}
+		q.Set("refDevice", deviceId)
+		r.URL.RawQuery = q.Encode()
+
+		query(w, r)
+	}
+}
+
 func getTagsHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -524,7 +924,9 @@ func getValuesHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/vnd.api+json")
 
-		result, err := a.QueryValues(ctx, r.URL.Query())
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		result, err := a.QueryValues(ctx, r.URL.Query(), tenants)
 		if err != nil {
 			logger.Error("could not query for values", "err", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -622,6 +1024,82 @@ func exportValuesAsCSV(result app.QueryResult, w io.Writer) error {
 	return nil
 }
 
+// etag returns the version of a thing as a strong entity tag
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch returns the version in the If-Match header, or 0 if there is no If-Match header or it is "*".
+// ok is false if the header is not an entity tag returned by etag, i.e. it can never match a thing.
+func ifMatch(r *http.Request) (version int64, ok bool) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, true
+	}
+
+	if len(h) < 2 || h[0] != '"' || h[len(h)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(h[1:len(h)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// writeError writes a JSON:API error object with the status and the error as detail
+func writeError(w http.ResponseWriter, status int, err error) {
+	response := ErrorResponse{
+		Errors: []ErrorObject{{
+			Status: strconv.Itoa(status),
+			Title:  http.StatusText(status),
+			Detail: err.Error(),
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	w.Write(response.Byte())
+}
+
+// writeValidationError writes a 400 response with JSON:API error objects if err is a validation error,
+// or if the refParent of the thing is not valid
+func writeValidationError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, app.ErrParentNotFound) || errors.Is(err, app.ErrCircularParent) {
+		writeError(w, http.StatusBadRequest, err)
+		return true
+	}
+
+	var ve *things.ValidationError
+	if !errors.As(err, &ve) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(NewValidationErrorResponse(ve).Byte())
+
+	return true
+}
+
+// maxIncluded is the number of related things that are included in a response
+const maxIncluded = 1000
+
+// includes returns the related things to include in a response, e.g. include=children
+func includes(r *http.Request) []string {
+	include := []string{}
+	for _, v := range r.URL.Query()["include"] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				include = append(include, s)
+			}
+		}
+	}
+	return include
+}
+
 func isMultipartFormData(r *http.Request) bool {
 	contentType := r.Header.Get("Content-Type")
 	return strings.Contains(contentType, "multipart/form-data")
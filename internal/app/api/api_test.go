@@ -0,0 +1,766 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/internal/pkg/auth"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+)
+
+func TestQueryThingsIsScopedToAllowedTenants(t *testing.T) {
+	is := is.New(t)
+
+	r, _, _ := testSetup(t, []string{"default"})
+
+	body, status := get(r, "/api/v0/things")
+	is.Equal(status, http.StatusOK)
+	is.True(strings.Contains(body, "container-default"))
+	is.True(!strings.Contains(body, "container-secret"))
+
+	body, status = get(r, "/api/v0/things?tenant=secret")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "[]")
+}
+
+func TestQueryThingsWithMalformedGeometry(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, _ := testSetup(t, []string{"default"})
+
+	queries := []string{
+		"bbox=17.3,62.3",
+		"bbox=18,62,17,63",
+		"near=north",
+		"near=62.39,17.30&maxDistance=-1",
+		"georel=within",
+		"georel=intersects&geometry=%7B%7D",
+		"georel=within&geometry=%7B%22type%22%3A%22Point%22%7D",
+	}
+
+	for _, q := range queries {
+		_, status := get(r, "/api/v0/things?"+q)
+		is.Equal(status, http.StatusBadRequest) // the filter must not be dropped
+	}
+
+	is.Equal(len(reader.QueryThingsCalls()), 0)
+
+	_, status := get(r, "/api/v0/things?bbox=17.0,62.0,18.0,63.0")
+	is.Equal(status, http.StatusOK)
+	is.Equal(newConditions(reader.QueryThingsCalls()[0].Conditions...)["bbox"], []float64{17, 62, 18, 63})
+}
+
+func TestQueryThingsAsCSV(t *testing.T) {
+	is := is.New(t)
+
+	r, _, _ := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v0/things", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("Content-Type"), "text/csv")
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Equal(lines[0], "id;type;subType;name;description;location;tenant;tags;refDevices;args")
+	is.Equal(len(lines), 3) // header and the things in the allowed tenant
+	is.True(strings.HasPrefix(lines[2], "container-with-device;Container;"))
+}
+
+func TestGetThingInOtherTenantIsNotFound(t *testing.T) {
+	is := is.New(t)
+
+	r, _, _ := testSetup(t, []string{"default"})
+
+	_, status := get(r, "/api/v0/things/container-default")
+	is.Equal(status, http.StatusOK)
+
+	_, status = get(r, "/api/v0/things/container-secret")
+	is.Equal(status, http.StatusNotFound)
+}
+
+func TestQueryValuesIsScopedToAllowedTenants(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, _ := testSetup(t, []string{"default"})
+
+	_, status := get(r, "/api/v0/things/values?thingid=container-secret")
+	is.Equal(status, http.StatusOK)
+
+	calls := reader.QueryValuesCalls()
+	is.Equal(len(calls), 1)
+	is.Equal(newConditions(calls[0].Conditions...)["tenants"], []string{"default"})
+
+	body, status := get(r, "/api/v0/things/values?thingid=container-secret&tenant=secret")
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, "[]")
+	is.Equal(len(reader.QueryValuesCalls()), 1) // reader should not be called for a tenant that is not allowed
+}
+
+func TestAddThingInOtherTenantIsForbidden(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v0/things", strings.NewReader(`{"id":"room-001","type":"Room","tenant":"secret"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusForbidden)
+	is.Equal(len(writer.AddThingCalls()), 0)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v0/things", strings.NewReader(`{"id":"room-001","type":"Room","tenant":"default"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusCreated)
+	is.Equal(len(writer.AddThingCalls()), 1)
+}
+
+func TestUpdateThingCanNotChangeTenantOrType(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default", "secret"})
+
+	bodies := []string{
+		`{"id":"container-default","type":"Container","tenant":"secret"}`,
+		`{"id":"container-default","type":"Room","tenant":"default"}`,
+	}
+
+	for _, body := range bodies {
+		req := httptest.NewRequest(http.MethodPut, "/api/v0/things/container-default", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		is.Equal(w.Code, http.StatusUnprocessableEntity)
+	}
+
+	is.Equal(len(writer.UpdateThingCalls()), 0)
+}
+
+func TestPatchWithInvalidPropertyIsBadRequest(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v0/things/container-default", strings.NewReader(`{"maxd":"high","location":{"latitude":100,"longitude":17}}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusBadRequest)
+	is.Equal(w.Header().Get("Content-Type"), "application/vnd.api+json")
+	is.Equal(len(writer.UpdateThingCalls()), 0)
+
+	response := ErrorResponse{}
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &response))
+	is.Equal(len(response.Errors), 2)
+	is.Equal(response.Errors[0].Status, "400")
+	is.Equal(response.Errors[0].Source.Pointer, "/location/latitude")
+	is.Equal(response.Errors[1].Source.Pointer, "/maxd")
+	is.Equal(response.Errors[1].Detail, "got string, want number")
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/v0/things/container-default", strings.NewReader(`{"maxd":0.94}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(len(writer.UpdateThingCalls()), 1)
+}
+
+func TestPatchWithJSONPatch(t *testing.T) {
+	r, _, writer := testSetup(t, []string{"default"})
+
+	tests := map[string]struct {
+		id          string
+		contentType string
+		body        string
+		status      int
+	}{
+		"add":                  {"container-default", "application/json-patch+json", `[{"op":"add","path":"/name","value":"Container 1"}]`, http.StatusOK},
+		"test and replace":     {"container-default", "application/json-patch+json", `[{"op":"test","path":"/tenant","value":"default"},{"op":"add","path":"/maxd","value":0.94}]`, http.StatusOK},
+		"merge patch":          {"container-default", "application/merge-patch+json", `{"name":null}`, http.StatusOK},
+		"test failed":          {"container-default", "application/json-patch+json", `[{"op":"test","path":"/tenant","value":"secret"}]`, http.StatusConflict},
+		"protected property":   {"container-default", "application/json-patch+json", `[{"op":"replace","path":"/tenant","value":"secret"}]`, http.StatusUnprocessableEntity},
+		"missing path":         {"container-default", "application/json-patch+json", `[{"op":"remove","path":"/missing"}]`, http.StatusUnprocessableEntity},
+		"unsupported op":       {"container-default", "application/json-patch+json", `[{"op":"copy","from":"/name","path":"/description"}]`, http.StatusBadRequest},
+		"invalid property":     {"container-default", "application/json-patch+json", `[{"op":"add","path":"/maxd","value":"high"}]`, http.StatusBadRequest},
+		"other tenant":         {"container-secret", "application/json-patch+json", `[{"op":"add","path":"/name","value":"Container 1"}]`, http.StatusNotFound},
+		"unsupported media":    {"container-default", "text/plain", `name=Container`, http.StatusUnsupportedMediaType},
+		"content type charset": {"container-default", "application/merge-patch+json; charset=utf-8", `{"description":"x"}`, http.StatusOK},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			calls := len(writer.UpdateThingCalls())
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/v0/things/"+tc.id, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			is.Equal(w.Code, tc.status)
+
+			if tc.status == http.StatusOK {
+				is.Equal(len(writer.UpdateThingCalls()), calls+1)
+				return
+			}
+
+			is.Equal(len(writer.UpdateThingCalls()), calls)
+			if tc.status == http.StatusUnsupportedMediaType {
+				is.Equal(w.Header().Get("Accept-Patch"), "application/merge-patch+json, application/json-patch+json")
+				return
+			}
+
+			response := ErrorResponse{}
+			is.NoErr(json.Unmarshal(w.Body.Bytes(), &response))
+			is.Equal(response.Errors[0].Status, strconv.Itoa(tc.status))
+		})
+	}
+}
+
+func TestGetThingReturnsETag(t *testing.T) {
+	is := is.New(t)
+
+	r, _, _ := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v0/things/container-default", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("ETag"), `"3"`)
+}
+
+func TestIfMatch(t *testing.T) {
+	r, _, writer := testSetup(t, []string{"default"})
+
+	container := things.NewContainer("container-default", things.DefaultLocation, "default")
+
+	tests := map[string]struct {
+		method  string
+		body    string
+		ifMatch string
+		status  int
+		version int64 // the version passed to storage, 0 saves the thing regardless of its version
+	}{
+		"put without If-Match":    {http.MethodPut, string(container.Byte()), "", http.StatusOK, 0},
+		"put with current":        {http.MethodPut, string(container.Byte()), `"3"`, http.StatusOK, 3},
+		"put with other":          {http.MethodPut, string(container.Byte()), `"2"`, http.StatusPreconditionFailed, 0},
+		"patch with any":          {http.MethodPatch, `{"name":"container"}`, "*", http.StatusOK, 3},
+		"patch with current":      {http.MethodPatch, `{"name":"container"}`, `"3"`, http.StatusOK, 3},
+		"patch with other":        {http.MethodPatch, `{"name":"container"}`, `"4"`, http.StatusPreconditionFailed, 0},
+		"patch with weak":         {http.MethodPatch, `{"name":"container"}`, `W/"3"`, http.StatusPreconditionFailed, 0},
+		"patch with unquoted":     {http.MethodPatch, `{"name":"container"}`, `3`, http.StatusPreconditionFailed, 0},
+		"delete with current":     {http.MethodDelete, "", `"3"`, http.StatusOK, 3},
+		"delete with other":       {http.MethodDelete, "", `"1"`, http.StatusPreconditionFailed, 0},
+		"delete without If-Match": {http.MethodDelete, "", "", http.StatusOK, 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			writes := len(writer.UpdateThingCalls()) + len(writer.DeleteThingCalls())
+
+			req := httptest.NewRequest(tc.method, "/api/v0/things/container-default", strings.NewReader(tc.body))
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			is.Equal(w.Code, tc.status)
+
+			if tc.status != http.StatusOK {
+				is.Equal(len(writer.UpdateThingCalls())+len(writer.DeleteThingCalls()), writes)
+				return
+			}
+
+			is.Equal(len(writer.UpdateThingCalls())+len(writer.DeleteThingCalls()), writes+1)
+
+			// a patch is applied to the version that was read, so that version is passed to storage
+			if tc.method == http.MethodDelete {
+				is.Equal(writer.DeleteThingCalls()[len(writer.DeleteThingCalls())-1].Version, tc.version)
+			} else {
+				is.Equal(writer.UpdateThingCalls()[len(writer.UpdateThingCalls())-1].Version, tc.version)
+			}
+		})
+	}
+}
+
+func TestGetThingAsOf(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, _ := testSetup(t, []string{"default"})
+
+	_, status := get(r, "/api/v0/things/container-default?asOf=last-march")
+	is.Equal(status, http.StatusBadRequest)
+	is.Equal(len(reader.QueryThingsCalls()), 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v0/things/container-default?asOf=2024-03-01T12:00:00Z", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(w.Header().Get("ETag"), "") // a historical version can not be used with If-Match
+
+	c := newConditions(reader.QueryThingsCalls()[0].Conditions...)
+	is.Equal(c["asof"], time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	_, ok := newConditions(reader.QueryValuesCalls()[0].Conditions...)["asof"]
+	is.True(!ok)
+}
+
+func TestGetThingHistory(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, _ := testSetup(t, []string{"default"})
+	reader.QueryHistoryFunc = func(ctx context.Context, conditions ...app.ConditionFunc) (app.QueryResult, error) {
+		entry := app.HistoryEntry{ThingID: "container-default", Version: 2, Source: app.SourceAPI, Actor: "admin", Diff: json.RawMessage(`{"maxd":0.94}`)}
+		b, _ := json.Marshal(entry)
+		return app.QueryResult{Data: [][]byte{b}, Count: 1, TotalCount: 1, Limit: 100}, nil
+	}
+
+	body, status := get(r, "/api/v0/things/container-default/history?timerel=after&timeat=2024-03-01T00:00:00Z")
+	is.Equal(status, http.StatusOK)
+
+	response := struct {
+		Data []app.HistoryEntry `json:"data"`
+	}{}
+	is.NoErr(json.Unmarshal([]byte(body), &response))
+	is.Equal(len(response.Data), 1)
+	is.Equal(response.Data[0].Actor, "admin")
+	is.Equal(string(response.Data[0].Diff), `{"maxd":0.94}`)
+
+	c := newConditions(reader.QueryHistoryCalls()[0].Conditions...)
+	is.Equal(c["id"], "container-default")
+	is.Equal(c["tenants"], []string{"default"})
+	is.Equal(c["timerel"], "after")
+}
+
+func TestDeleteWithPurge(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v0/things/container-default?purge=true", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(len(writer.DeleteThingCalls()), 0)
+	is.Equal(writer.PurgeThingCalls()[0].ThingID, "container-default")
+
+	for _, target := range []string{"/api/v0/things/container-missing?purge=true", "/api/v0/things/container-missing"} {
+		req = httptest.NewRequest(http.MethodDelete, target, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		is.Equal(w.Code, http.StatusNotFound)
+	}
+
+	is.Equal(len(writer.PurgeThingCalls()), 1)
+}
+
+func TestRestore(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, writer := testSetup(t, []string{"default"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v0/things/container-default/restore", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusOK)
+	is.Equal(writer.RestoreThingCalls()[0].ThingID, "container-default")
+	is.Equal(newConditions(reader.QueryThingsCalls()[0].Conditions...)["deleted"], true)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v0/things/container-secret/restore", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	is.Equal(w.Code, http.StatusNotFound)
+	is.Equal(len(writer.RestoreThingCalls()), 1)
+}
+
+func TestAttachAndDetachDevice(t *testing.T) {
+	r, _, writer := testSetup(t, []string{"default"})
+
+	tests := map[string]struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		"attach":                     {http.MethodPost, "/api/v0/things/container-default/devices", `{"deviceID":"device-2"}`, http.StatusOK},
+		"attach without device":      {http.MethodPost, "/api/v0/things/container-default/devices", `{}`, http.StatusBadRequest},
+		"attach to other thing":      {http.MethodPost, "/api/v0/things/container-default/devices", `{"deviceID":"device-1"}`, http.StatusConflict},
+		"attach shared":              {http.MethodPost, "/api/v0/things/container-default/devices", `{"deviceID":"device-1","allowShared":true}`, http.StatusOK},
+		"attach in other tenant":     {http.MethodPost, "/api/v0/things/container-secret/devices", `{"deviceID":"device-2"}`, http.StatusNotFound},
+		"detach":                     {http.MethodDelete, "/api/v0/things/container-with-device/devices/device-1", "", http.StatusOK},
+		"detach device not attached": {http.MethodDelete, "/api/v0/things/container-default/devices/device-1", "", http.StatusNotFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			calls := len(writer.UpdateThingCalls())
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			is.Equal(w.Code, tc.status)
+
+			if tc.status == http.StatusOK || tc.status == http.StatusConflict {
+				is.Equal(len(writer.UpdateThingCalls()), calls+1)
+			} else {
+				is.Equal(len(writer.UpdateThingCalls()), calls)
+			}
+		})
+	}
+}
+
+func TestGetDeviceThings(t *testing.T) {
+	is := is.New(t)
+
+	r, reader, _ := testSetup(t, []string{"default"})
+
+	body, status := get(r, "/api/v0/devices/device-1/things?refdevice=device-2")
+	is.Equal(status, http.StatusOK)
+	is.True(strings.Contains(body, `"id":"container-with-device"`))
+	is.Equal(newConditions(reader.QueryThingsCalls()[0].Conditions...)["refdevice"], "device-1")
+}
+
+func TestGetThingIncludeChildren(t *testing.T) {
+	is := is.New(t)
+
+	r, _, _ := testSetup(t, []string{"default"})
+
+	body, status := get(r, "/api/v0/things/container-default?include=children")
+	is.Equal(status, http.StatusOK)
+
+	response := struct {
+		Data struct {
+			HasPart []string `json:"hasPart"`
+		} `json:"data"`
+		Included []map[string]any `json:"included"`
+	}{}
+	is.NoErr(json.Unmarshal([]byte(body), &response))
+	is.Equal(response.Data.HasPart, []string{"container-with-device"})
+	is.Equal(len(response.Included), 1)
+	is.Equal(response.Included[0]["refParent"], "container-default")
+
+	body, _ = get(r, "/api/v0/things/container-default")
+	is.True(!strings.Contains(body, `"included"`))
+}
+
+func TestConnectThing(t *testing.T) {
+	r, _, writer := testSetup(t, []string{"default"})
+
+	tests := map[string]struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		"connect new thing":      {http.MethodPost, "/api/v0/things/container-default", `{"id":"container-new","type":"Container","tenant":"default"}`, http.StatusOK},
+		"connect existing thing": {http.MethodPost, "/api/v0/things/container-with-device", `{"id":"container-default"}`, http.StatusBadRequest},
+		"connect to missing":     {http.MethodPost, "/api/v0/things/container-missing", `{"id":"container-new","type":"Container","tenant":"default"}`, http.StatusNotFound},
+		"connect without id":     {http.MethodPost, "/api/v0/things/container-default", `{"type":"Container"}`, http.StatusBadRequest},
+		"update with cycle":      {http.MethodPut, "/api/v0/things/container-default", `{"id":"container-default","type":"Container","tenant":"default","refParent":"container-with-device"}`, http.StatusBadRequest},
+		"update with no parent":  {http.MethodPut, "/api/v0/things/container-default", `{"id":"container-default","type":"Container","tenant":"default","refParent":"container-missing"}`, http.StatusBadRequest},
+		"add to other tenant":    {http.MethodPost, "/api/v0/things", `{"id":"container-new","type":"Container","tenant":"default","refParent":"container-secret"}`, http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			is.Equal(w.Code, tc.status)
+		})
+	}
+
+	is := is.New(t)
+	is.Equal(len(writer.AddThingCalls()), 1)
+	is.Equal(writer.AddThingCalls()[0].T.Parent(), "container-default")
+	is.Equal(len(writer.UpdateThingCalls()), 0)
+}
+
+func TestBatch(t *testing.T) {
+	r, _, _ := testSetup(t, []string{"default"})
+
+	tests := map[string]struct {
+		target      string
+		contentType string
+		body        string
+		status      int
+		statuses    []string
+	}{
+		"create": {
+			"/api/v0/things/$batch", "application/json",
+			`[{"id":"container-new","type":"Container","tenant":"default"},{"id":"container-default","type":"Container","tenant":"default"},{"id":"container-x","type":"Container","tenant":"default","maxd":"high"}]`,
+			http.StatusMultiStatus, []string{"201", "409", "400"},
+		},
+		"upsert ndjson": {
+			"/api/v0/things/$batch?mode=upsert", "application/x-ndjson",
+			"{\"id\":\"container-new\",\"type\":\"Container\",\"tenant\":\"default\"}\n\n{\"id\":\"container-default\",\"name\":\"x\"}\nnot json\n",
+			http.StatusMultiStatus, []string{"201", "200", "400"},
+		},
+		"replace in other tenant": {
+			"/api/v0/things/$batch?mode=replace", "application/json",
+			`[{"id":"container-new","type":"Container","tenant":"secret"},{"id":"container-new","type":"Spaceship","tenant":"default"}]`,
+			http.StatusMultiStatus, []string{"403", "400"},
+		},
+		"atomic": {
+			"/api/v0/things/$batch?atomic=true", "application/json", `[{"id":"container-new","type":"Container","tenant":"default"}]`,
+			http.StatusNotImplemented, nil,
+		},
+		"invalid mode": {"/api/v0/things/$batch?mode=merge", "application/json", `[{"id":"container-new"}]`, http.StatusBadRequest, nil},
+		"not an array": {"/api/v0/things/$batch", "application/json", `{"id":"container-new"}`, http.StatusBadRequest, nil},
+		"empty":        {"/api/v0/things/$batch", "application/json", `[]`, http.StatusBadRequest, nil},
+		"too many":     {"/api/v0/things/$batch", "application/json", "[" + strings.Repeat("{},", maxBatchSize) + "{}]", http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			is.Equal(w.Code, tc.status)
+
+			if tc.statuses == nil {
+				return
+			}
+
+			response := BatchResponse{}
+			is.NoErr(json.Unmarshal(w.Body.Bytes(), &response))
+
+			statuses := []string{}
+			for _, e := range response.Data {
+				statuses = append(statuses, e.Status)
+			}
+			is.Equal(statuses, tc.statuses)
+			is.Equal(response.Meta.Total, len(tc.statuses))
+		})
+	}
+}
+
+func TestSeedDryRun(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default"})
+
+	csv := `id;type;subType;name;decsription;location;tenant;tags;refDevices;args
+container-new;Container;;Container;;62.3,17.3;default;;;
+container-default;Container;;Container;;62.3,17.3;default;;;`
+
+	response, status := seed(r, "/api/v0/things?dryRun=true", "things.csv", csv)
+	is.Equal(status, http.StatusOK)
+	is.True(response.Meta.DryRun)
+	is.Equal(response.Meta.Created, 1)
+	is.Equal(response.Meta.Updated, 1)
+	is.Equal(response.Data[1].Action, "update")
+	is.Equal(len(writer.AddThingCalls()), 0)
+
+	response, status = seed(r, "/api/v0/things?dryRun=true", "things.csv", csv+"\ncontainer-x;Container;;Container;;62.3;default;;;")
+	is.Equal(status, http.StatusOK)
+	is.Equal(response.Meta.Failed, 1)
+	is.Equal(response.Data[2].Row, 4)
+	is.Equal(response.Data[2].Errors[0].Status, "400")
+
+	_, status = seed(r, "/api/v0/things", "things.csv", csv+"\ncontainer-x;Container;;Container;;62.3;default;;;")
+	is.Equal(status, http.StatusBadRequest)
+	is.Equal(len(writer.AddThingCalls()), 0)
+
+	_, status = seed(r, "/api/v0/things", "things.csv", csv)
+	is.Equal(status, http.StatusCreated)
+	is.Equal(len(writer.AddThingCalls()), 1)
+
+	geojson := `{"type":"FeatureCollection","features":[{"type":"Feature","id":"container-geo","geometry":{"type":"Point","coordinates":[17.3,62.3]},"properties":{"type":"Container","tenant":"default"}}]}`
+
+	response, status = seed(r, "/api/v0/things?dryRun=true", "things.geojson", geojson)
+	is.Equal(status, http.StatusOK)
+	is.Equal(response.Meta.Created, 1)
+	is.Equal(response.Data[0].ID, "container-geo")
+}
+
+func TestSeedInOtherTenantIsNotValid(t *testing.T) {
+	is := is.New(t)
+
+	r, _, writer := testSetup(t, []string{"default"})
+
+	response, status := seed(r, "/api/v0/things", "things.csv", `container-new;Container;;Container;;62.3,17.3;default;;;
+container-foreign;Container;;Container;;62.3,17.3;secret;;;
+container-secret;Container;;Container;;62.3,17.3;default;;;`)
+
+	is.Equal(status, http.StatusBadRequest)
+	is.Equal(response.Meta.Failed, 2) // a new thing in, and an existing thing from, a tenant that is not allowed
+	is.Equal(len(writer.AddThingCalls()), 0)
+	is.Equal(len(writer.UpdateThingCalls()), 0)
+}
+
+func seed(r http.Handler, target, name, file string) (SeedResponse, int) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("fileupload", name)
+	fw.Write([]byte(file))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	response := SeedResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	return response, w.Code
+}
+
+func testSetup(t *testing.T, tenants []string) (*chi.Mux, *app.ThingsReaderMock, *app.ThingsWriterMock) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store := []things.Thing{
+		things.NewContainer("container-default", things.DefaultLocation, "default"),
+		things.NewContainer("container-secret", things.DefaultLocation, "secret"),
+		things.NewContainer("container-with-device", things.DefaultLocation, "default"),
+	}
+	store[2].AddDevice("device-1")
+	store[2].(*things.Container).RefParent = "container-default"
+
+	reader := &app.ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...app.ConditionFunc) (app.QueryResult, error) {
+			c := newConditions(conditions...)
+			data := [][]byte{}
+			versions := []int64{}
+			for _, t := range store {
+				if id, ok := c["id"]; ok && id != t.ID() {
+					continue
+				}
+				if tenants, ok := c["tenants"]; ok && !slices.Contains(tenants.([]string), t.Tenant()) {
+					continue
+				}
+				if ref, ok := c["refdevice"]; ok && !slices.ContainsFunc(t.Refs(), func(d things.Device) bool { return d.DeviceID == ref }) {
+					continue
+				}
+				if types, ok := c["types"]; ok && !slices.Contains(types.([]string), t.Type()) {
+					continue
+				}
+				if refParent, ok := c["refparent"]; ok && refParent != t.Parent() {
+					continue
+				}
+				data = append(data, t.Byte())
+				versions = append(versions, 3)
+			}
+			return app.QueryResult{Data: data, Versions: versions, Count: len(data), TotalCount: int64(len(data))}, nil
+		},
+		QueryValuesFunc: func(ctx context.Context, conditions ...app.ConditionFunc) (app.QueryResult, error) {
+			return app.QueryResult{Data: [][]byte{}}, nil
+		},
+	}
+	writer := &app.ThingsWriterMock{
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
+			if slices.ContainsFunc(store, func(s things.Thing) bool { return s.ID() == t.ID() }) {
+				return app.ErrAlreadyExists
+			}
+			return nil
+		},
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			// device-1 is attached to container-with-device, as checked by the storage
+			for _, d := range t.Refs() {
+				if d.DeviceID == "device-1" && t.ID() != "container-with-device" && !slices.Contains(app.SharedDevicesFromContext(ctx), d.DeviceID) {
+					return app.ErrDeviceAttached
+				}
+			}
+			return nil
+		},
+		DeleteThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+		RestoreThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+		PurgeThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+	}
+	msgCtx := &messaging.MsgContextMock{
+		PublishOnTopicFunc: func(ctx context.Context, message messaging.TopicMessage) error {
+			return nil
+		},
+	}
+
+	a := app.New(ctx, reader, writer, msgCtx)
+	log := slog.Default()
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.WithAllowedTenants(r.Context(), tenants)))
+		})
+	})
+	r.Route("/api/v0/things", func(r chi.Router) {
+		r.Get("/", queryHandler(log, a))
+		r.Get("/{id}", getByIDHandler(log, a))
+		r.Get("/{id}/history", getHistoryHandler(log, a))
+		r.Post("/", addHandler(log, a))
+		r.Post("/$batch", batchHandler(log, a))
+		r.Post("/{id}", connectHandler(log, a))
+		r.Put("/{id}", updateHandler(log, a))
+		r.Patch("/{id}", patchHandler(log, a))
+		r.Delete("/{id}", deleteHandler(log, a))
+		r.Post("/{id}/restore", restoreHandler(log, a))
+		r.Post("/{id}/devices", attachDeviceHandler(log, a))
+		r.Delete("/{id}/devices/{deviceID}", detachDeviceHandler(log, a))
+		r.Get("/values", getValuesHandler(log, a))
+	})
+	r.Get("/api/v0/devices/{deviceID}/things", getDeviceThingsHandler(log, a))
+
+	return r, reader, writer
+}
+
+func get(r http.Handler, target string) (string, int) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String(), w.Code
+}
+
+func newConditions(conditions ...app.ConditionFunc) map[string]any {
+	m := make(map[string]any)
+
+	for _, f := range conditions {
+		m = f(m)
+	}
+
+	return m
+}
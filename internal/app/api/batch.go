@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/internal/pkg/auth"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+// maxBatchSize is the number of things that can be added, or updated, in a batch
+const maxBatchSize = 1000
+
+var (
+	errEmptyBatch    = errors.New("batch must contain at least one thing")
+	errBatchTooLarge = fmt.Errorf("batch can contain at most %d things", maxBatchSize)
+)
+
+// batchHandler adds, or updates, a JSON array or NDJSON of things and responds with 207 Multi-Status and the result of each thing
+func batchHandler(log *slog.Logger, a app.ThingsApp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer r.Body.Close()
+
+		ctx, span := tracer.Start(r.Context(), "batch-things")
+		defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+		_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, log, ctx)
+
+		mode := app.BatchMode(r.URL.Query().Get("mode"))
+		if mode == "" {
+			mode = app.BatchCreate
+		}
+
+		atomic := r.URL.Query().Get("atomic") == "true"
+
+		items, err := readBatch(r)
+		if errors.Is(err, errBatchTooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if err != nil {
+			logger.Warn("could not read batch", "err", err.Error())
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		tenants := auth.GetAllowedTenantsFromContext(ctx)
+
+		results, err := a.AddThings(ctx, items, mode, atomic, tenants)
+		if errors.Is(err, app.ErrInvalidBatchMode) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, app.ErrBatchNotAtomic) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		if err != nil {
+			logger.Error("could not save batch", "err", err.Error())
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := NewBatchResponse(results)
+
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(response.Byte())
+	}
+}
+
+// readBatch reads the things in a batch, as NDJSON if the content type is application/x-ndjson, otherwise as a JSON array
+func readBatch(r *http.Request) ([][]byte, error) {
+	items := [][]byte{}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch contentType {
+	case "application/x-ndjson", "application/ndjson":
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(items) == maxBatchSize {
+				return nil, errBatchTooLarge
+			}
+			items = append(items, bytes.Clone(line))
+		}
+
+		err := scanner.Err()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		raw := []json.RawMessage{}
+		err = json.Unmarshal(b, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("batch must be a JSON array of things, %w", err)
+		}
+		if len(raw) > maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+
+		for _, item := range raw {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, errEmptyBatch
+	}
+
+	return items, nil
+}
+
+// batchItemStatus returns the status of a thing in a batch
+func batchItemStatus(result app.BatchResult) int {
+	var ve *things.ValidationError
+
+	switch {
+	case result.Err == nil && result.Created:
+		return http.StatusCreated
+	case result.Err == nil:
+		return http.StatusOK
+	case errors.As(result.Err, &ve),
+		errors.Is(result.Err, app.ErrInvalidBatchItem),
+		errors.Is(result.Err, app.ErrMissingThingID),
+		errors.Is(result.Err, app.ErrMissingThingType),
+		errors.Is(result.Err, app.ErrMissingThingTenant),
+		errors.Is(result.Err, app.ErrParentNotFound),
+		errors.Is(result.Err, app.ErrCircularParent),
+		errors.Is(result.Err, app.ErrInvalidPatch),
+		errors.Is(result.Err, things.ErrUnknownType):
+		return http.StatusBadRequest
+	case errors.Is(result.Err, app.ErrTenantNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(result.Err, app.ErrThingNotFound):
+		return http.StatusNotFound
+	case errors.Is(result.Err, app.ErrAlreadyExists), errors.Is(result.Err, app.ErrVersionConflict), errors.Is(result.Err, app.ErrDeviceAttached):
+		return http.StatusConflict
+	case errors.Is(result.Err, app.ErrProtectedProperty), errors.Is(result.Err, app.ErrPatchNotPossible):
+		return http.StatusUnprocessableEntity
+	case errors.Is(result.Err, app.ErrBatchRolledBack):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,9 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
 )
 
 type FeatureCollection struct {
@@ -12,19 +17,74 @@ type FeatureCollection struct {
 	Features []Feature `json:"features"`
 }
 type Feature struct {
-	ID         string   `json:"id"`
-	Type       string   `json:"type"`
-	Geometry   Geometry `json:"geometry"`
-	Properties map[string]any
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Geometry   Geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
 }
 type Geometry struct {
-	Type        string    `json:"type"`
-	Coordinates []float64 `json:"coordinates"`
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func NewFeatureCollection(features []Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+
+	return FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: features,
+	}
+}
+
+// NewFeature creates a GeoJSON feature from a thing. The geometry is a LineString or MultiLineString
+// if the thing has an area, otherwise a Point created from its location.
+func NewFeature(b []byte, properties map[string]any) (Feature, error) {
+	t := struct {
+		ID       string               `json:"id"`
+		Location things.Location      `json:"location"`
+		Area     *things.LineSegments `json:"area,omitempty"`
+	}{}
+
+	err := json.Unmarshal(b, &t)
+	if err != nil {
+		return Feature{}, err
+	}
+
+	return Feature{
+		ID:         t.ID,
+		Type:       "Feature",
+		Geometry:   newGeometry(t.Location, t.Area),
+		Properties: properties,
+	}, nil
+}
+
+func (fc FeatureCollection) Byte() []byte {
+	b, _ := json.Marshal(fc)
+	return b
 }
 
-type Resource struct {
-	Id   string `json:"id"`
-	Type string `json:"type"`
+func newGeometry(l things.Location, area *things.LineSegments) Geometry {
+	if area != nil && len(*area) == 1 {
+		return Geometry{
+			Type:        "LineString",
+			Coordinates: (*area)[0],
+		}
+	}
+
+	if area != nil && len(*area) > 1 {
+		return Geometry{
+			Type:        "MultiLineString",
+			Coordinates: *area,
+		}
+	}
+
+	// GeoJSON positions are [longitude, latitude]
+	return Geometry{
+		Type:        "Point",
+		Coordinates: []float64{l.Longitude, l.Latitude},
+	}
 }
 
 /* - - - - - - - - - - */
@@ -45,13 +105,221 @@ type links struct {
 }
 
 type ApiResponse struct {
-	Meta     *meta      `json:"meta,omitempty"`
-	Data     any        `json:"data"`
-	Links    *links     `json:"links,omitempty"`
-	Included []Resource `json:"included,omitempty"`
+	Meta     *meta  `json:"meta,omitempty"`
+	Data     any    `json:"data"`
+	Links    *links `json:"links,omitempty"`
+	Included []any  `json:"included,omitempty"`
 }
 
 func NewApiResponse(r *http.Request, data any, count, total, offset, limit uint64) ApiResponse {
+	meta := newMeta(count, total, offset, limit)
+	links := createLinks(r.URL, meta)
+
+	return ApiResponse{
+		Meta:  meta,
+		Data:  data,
+		Links: links,
+	}
+}
+
+func (r ApiResponse) Byte() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// ErrorResponse is a JSON:API error document
+type ErrorResponse struct {
+	Errors []ErrorObject `json:"errors"`
+}
+
+type ErrorObject struct {
+	Status string         `json:"status"`
+	Code   string         `json:"code,omitempty"`
+	Title  string         `json:"title"`
+	Detail string         `json:"detail,omitempty"`
+	Source *ErrorSource   `json:"source,omitempty"`
+	Meta   map[string]any `json:"meta,omitempty"`
+}
+
+type ErrorSource struct {
+	Pointer string `json:"pointer"`
+}
+
+// NewValidationErrorResponse creates an error object for each property of a thing that does not conform to the schema of its type
+func NewValidationErrorResponse(ve *things.ValidationError) ErrorResponse {
+	errs := make([]ErrorObject, 0, len(ve.Errors))
+
+	for _, fe := range ve.Errors {
+		errs = append(errs, ErrorObject{
+			Status: strconv.Itoa(http.StatusBadRequest),
+			Code:   "invalid-property",
+			Title:  "Invalid property",
+			Detail: fe.Detail,
+			Source: &ErrorSource{Pointer: fe.Pointer},
+			Meta:   map[string]any{"id": ve.ID},
+		})
+	}
+
+	return ErrorResponse{Errors: errs}
+}
+
+func (r ErrorResponse) Byte() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// BatchResponse is the result of each thing in a batch, in the order of the batch
+type BatchResponse struct {
+	Meta BatchMeta    `json:"meta"`
+	Data []BatchEntry `json:"data"`
+}
+
+type BatchMeta struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+type BatchEntry struct {
+	Index  int           `json:"index"`
+	ID     string        `json:"id,omitempty"`
+	Status string        `json:"status"`
+	Errors []ErrorObject `json:"errors,omitempty"`
+}
+
+func NewBatchResponse(results []app.BatchResult) BatchResponse {
+	response := BatchResponse{
+		Meta: BatchMeta{Total: len(results)},
+		Data: make([]BatchEntry, 0, len(results)),
+	}
+
+	for _, result := range results {
+		status := batchItemStatus(result)
+
+		entry := BatchEntry{
+			Index:  result.Index,
+			ID:     result.ID,
+			Status: strconv.Itoa(status),
+		}
+
+		if result.Err == nil {
+			response.Meta.Succeeded++
+		} else {
+			entry.Errors = newErrorObjects(status, result.Err)
+			response.Meta.Failed++
+		}
+
+		response.Data = append(response.Data, entry)
+	}
+
+	return response
+}
+
+func (r BatchResponse) Byte() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// SeedResponse is the result of each row in a file with things, in the order of the file
+type SeedResponse struct {
+	Meta SeedMeta    `json:"meta"`
+	Data []SeedEntry `json:"data"`
+}
+
+type SeedMeta struct {
+	DryRun    bool `json:"dryRun"`
+	Rows      int  `json:"rows"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Failed    int  `json:"failed"`
+}
+
+type SeedEntry struct {
+	Row      int             `json:"row"`
+	ID       string          `json:"id,omitempty"`
+	Action   string          `json:"action,omitempty"`
+	Diff     json.RawMessage `json:"diff,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Errors   []ErrorObject   `json:"errors,omitempty"`
+}
+
+func NewSeedResponse(report app.SeedReport) SeedResponse {
+	response := SeedResponse{
+		Meta: SeedMeta{
+			DryRun:    report.DryRun,
+			Rows:      len(report.Rows),
+			Created:   report.Count(app.SeedCreate),
+			Updated:   report.Count(app.SeedUpdate),
+			Unchanged: report.Count(app.SeedUnchanged),
+			Failed:    report.Failed(),
+		},
+		Data: make([]SeedEntry, 0, len(report.Rows)),
+	}
+
+	for _, row := range report.Rows {
+		entry := SeedEntry{
+			Row:      row.Row,
+			ID:       row.ID,
+			Action:   string(row.Action),
+			Diff:     row.Diff,
+			Warnings: row.Warnings,
+		}
+
+		for _, err := range row.Errors {
+			entry.Errors = append(entry.Errors, newErrorObjects(http.StatusBadRequest, err)...)
+		}
+
+		response.Data = append(response.Data, entry)
+	}
+
+	return response
+}
+
+func (r SeedResponse) Byte() []byte {
+	b, _ := json.Marshal(r)
+	return b
+}
+
+// newErrorObjects creates an error object for each invalid property if err is a validation error, otherwise a single error object
+func newErrorObjects(status int, err error) []ErrorObject {
+	var ve *things.ValidationError
+	if errors.As(err, &ve) {
+		return NewValidationErrorResponse(ve).Errors
+	}
+
+	return []ErrorObject{{
+		Status: strconv.Itoa(status),
+		Title:  http.StatusText(status),
+		Detail: err.Error(),
+	}}
+}
+
+// NewLinkHeaders creates RFC 8288 Link header values for paging, i.e. <url>; rel="next"
+func NewLinkHeaders(r *http.Request, count, total, offset, limit uint64) []string {
+	links := createLinks(r.URL, newMeta(count, total, offset, limit))
+	if links == nil {
+		return []string{}
+	}
+
+	headers := []string{}
+
+	add := func(rel string, u *string) {
+		if u != nil {
+			headers = append(headers, fmt.Sprintf("<%s>; rel=\"%s\"", *u, rel))
+		}
+	}
+
+	add("self", links.Self)
+	add("first", links.First)
+	add("prev", links.Prev)
+	add("next", links.Next)
+	add("last", links.Last)
+
+	return headers
+}
+
+func newMeta(count, total, offset, limit uint64) *meta {
 	meta := &meta{
 		TotalRecords: total,
 	}
@@ -65,18 +333,7 @@ func NewApiResponse(r *http.Request, data any, count, total, offset, limit uint6
 		meta.Count = &count
 	}
 
-	links := createLinks(r.URL, meta)
-
-	return ApiResponse{
-		Meta:  meta,
-		Data:  data,
-		Links: links,
-	}
-}
-
-func (r ApiResponse) Byte() []byte {
-	b, _ := json.Marshal(r)
-	return b
+	return meta
 }
 
 func createLinks(u *url.URL, m *meta) *links {
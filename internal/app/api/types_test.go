@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/matryer/is"
+)
+
+func TestNewFeatureWithLocation(t *testing.T) {
+	is := is.New(t)
+
+	c := things.NewContainer("container-001", things.Location{Latitude: 62.39, Longitude: 17.31}, "default")
+
+	f, err := NewFeature(c.Byte(), map[string]any{"type": "Container"})
+	is.NoErr(err)
+
+	is.Equal(f.ID, "container-001")
+	is.Equal(f.Type, "Feature")
+	is.Equal(f.Geometry.Type, "Point")
+	is.Equal(f.Geometry.Coordinates, []float64{17.31, 62.39})
+	is.Equal(f.Properties["type"], "Container")
+}
+
+func TestNewFeatureWithArea(t *testing.T) {
+	is := is.New(t)
+
+	line := `{"id":"passage-001","type":"Passage","location":{"latitude":62,"longitude":17},"area":[[[17.1,62.1],[17.2,62.2]]]}`
+	f, err := NewFeature([]byte(line), nil)
+	is.NoErr(err)
+	is.Equal(f.Geometry.Type, "LineString")
+	is.Equal(f.Geometry.Coordinates, things.Line{{17.1, 62.1}, {17.2, 62.2}})
+
+	multiLine := `{"id":"passage-002","type":"Passage","location":{"latitude":62,"longitude":17},"area":[[[17.1,62.1],[17.2,62.2]],[[17.2,62.2],[17.3,62.3]]]}`
+	f, err = NewFeature([]byte(multiLine), nil)
+	is.NoErr(err)
+	is.Equal(f.Geometry.Type, "MultiLineString")
+}
+
+func TestNewFeatureCollectionIsNeverNull(t *testing.T) {
+	is := is.New(t)
+
+	fc := NewFeatureCollection(nil)
+	is.Equal(string(fc.Byte()), `{"type":"FeatureCollection","features":[]}`)
+}
+
+func TestNewLinkHeaders(t *testing.T) {
+	is := is.New(t)
+
+	r := httptest.NewRequest("GET", "/api/v0/things?type=Container&offset=10&limit=10", nil)
+
+	headers := NewLinkHeaders(r, 10, 30, 10, 10)
+	is.Equal(len(headers), 5)
+	is.Equal(headers[0], `</api/v0/things?limit=10&offset=10&type=Container>; rel="self"`)
+	is.Equal(headers[2], `</api/v0/things?limit=10&offset=0&type=Container>; rel="prev"`)
+	is.Equal(headers[3], `</api/v0/things?limit=10&offset=20&type=Container>; rel="next"`)
+
+	r = httptest.NewRequest("GET", "/api/v0/things", nil)
+	is.Equal(len(NewLinkHeaders(r, 3, 3, 0, 100)), 0)
+}
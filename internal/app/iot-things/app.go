@@ -2,20 +2,16 @@ package iotthings
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"maps"
 	"slices"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/diwise/iot-things/internal/app/iot-things/things"
-	"github.com/diwise/iot-things/pkg/types"
 	"github.com/diwise/messaging-golang/pkg/messaging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"gopkg.in/yaml.v2"
@@ -25,51 +21,112 @@ import (
 type ThingsApp interface {
 	HandleMeasurements(ctx context.Context, measurements []things.Measurement)
 
-	AddThing(ctx context.Context, b []byte) error
-	DeleteThing(ctx context.Context, thingID string, tenants []string) error
-	MergeThing(ctx context.Context, thingID string, b []byte, tenants []string) error
-	QueryThings(ctx context.Context, params map[string][]string) (QueryResult, error)
-	UpdateThing(ctx context.Context, b []byte, tenants []string) error
+	AddThing(ctx context.Context, b []byte, tenants []string) error
+	AddThings(ctx context.Context, items [][]byte, mode BatchMode, atomic bool, tenants []string) ([]BatchResult, error)
+	ConnectThing(ctx context.Context, parentID string, b []byte, tenants []string) error
+	AttachDevice(ctx context.Context, thingID, deviceID string, allowShared bool, version int64, tenants []string) error
+	DetachDevice(ctx context.Context, thingID, deviceID string, version int64, tenants []string) error
+	DeleteThing(ctx context.Context, thingID string, version int64, tenants []string) error
+	MergeThing(ctx context.Context, thingID string, b []byte, version int64, tenants []string) error
+	PatchThing(ctx context.Context, thingID string, b []byte, version int64, tenants []string) error
+	PurgeThing(ctx context.Context, thingID string, version int64, tenants []string) error
+	RestoreThing(ctx context.Context, thingID string, version int64, tenants []string) error
+	QueryThings(ctx context.Context, params map[string][]string, tenants []string) (QueryResult, error)
+	QueryHistory(ctx context.Context, thingID string, params map[string][]string, tenants []string) (QueryResult, error)
+	UpdateThing(ctx context.Context, b []byte, version int64, tenants []string) error
 
 	AddValue(ctx context.Context, t things.Thing, m things.Value) error
-	QueryValues(ctx context.Context, params map[string][]string) (QueryResult, error)
+	QueryValues(ctx context.Context, params map[string][]string, tenants []string) (QueryResult, error)
 
 	GetTags(ctx context.Context, tenants []string) ([]string, error)
 	GetTypes(ctx context.Context, tenants []string) ([]things.ThingType, error)
 
 	LoadConfig(ctx context.Context, r io.Reader) error
-	Seed(ctx context.Context, r io.Reader) error
+	Seed(ctx context.Context, r io.Reader, format SeedFormat, dryRun bool, tenants []string) (SeedReport, error)
 }
 
 //go:generate moq -rm -out reader_mock.go . ThingsReader
 type ThingsReader interface {
 	QueryThings(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error)
 	QueryValues(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error)
+	QueryHistory(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error)
 	GetTags(ctx context.Context, tenants []string) ([]string, error)
 }
 
+// ThingsWriter writes things to storage. Events are added to the outbox in the same transaction as the change.
+// A thing is only updated, or deleted, if its current version is the given version, otherwise ErrVersionConflict is returned.
+//
 //go:generate moq -rm -out writer_mock.go . ThingsWriter
 type ThingsWriter interface {
-	AddThing(ctx context.Context, t things.Thing) error
-	UpdateThing(ctx context.Context, t things.Thing) error
-	DeleteThing(ctx context.Context, thingID string) error
+	AddThing(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error
+	UpdateThing(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error
+	DeleteThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
+	RestoreThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
+	PurgeThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
+	PurgeDeletedThings(ctx context.Context, deletedBefore time.Time) (int, error)
 	AddValue(ctx context.Context, t things.Thing, m things.Value) error
 }
 
+// ThingsTransactor calls fn with a reader and writer bound to a single transaction. The transaction is committed
+// if fn returns nil, otherwise it is rolled back.
+type ThingsTransactor interface {
+	InTransaction(ctx context.Context, fn func(r ThingsReader, w ThingsWriter) error) error
+}
+
 var (
 	ErrThingNotFound      = errors.New("thing not found")
 	ErrAlreadyExists      = errors.New("thing already exists")
 	ErrMissingThingID     = errors.New("thing ID must be provided")
 	ErrMissingThingTenant = errors.New("tenant must be provided")
 	ErrMissingThingType   = errors.New("thing type must be provided")
+	ErrTenantNotAllowed   = errors.New("tenant not allowed")
+	ErrVersionConflict    = errors.New("thing has been modified")
+	ErrDeviceAttached     = errors.New("device is attached to another thing of the same type")
+	ErrDeviceNotAttached  = errors.New("device is not attached to thing")
 )
 
 type app struct {
-	reader ThingsReader
-	writer ThingsWriter
-	cfg    *config
+	reader  ThingsReader
+	writer  ThingsWriter
+	outbox  ThingsOutbox
+	tx      ThingsTransactor
+	cfg     *config
+	workers *workers
+
+	numberOfWorkers int
+	queueSize       int
+	retention       time.Duration
+}
+
+type Option func(*app)
+
+// WithWorkers sets the number of workers handling measurements and the size of each worker queue
+func WithWorkers(numberOfWorkers, queueSize int) Option {
+	return func(a *app) {
+		a.numberOfWorkers = numberOfWorkers
+		a.queueSize = queueSize
+	}
+}
+
+// WithOutbox enables publishing of thing.updated for changes added to the outbox
+func WithOutbox(outbox ThingsOutbox) Option {
+	return func(a *app) {
+		a.outbox = outbox
+	}
+}
 
-	pub chan string
+// WithTransactions enables batches of things that are added, or updated, in a single transaction
+func WithTransactions(tx ThingsTransactor) Option {
+	return func(a *app) {
+		a.tx = tx
+	}
+}
+
+// WithRetention permanently removes things, including their history and values, that have been deleted for longer than period
+func WithRetention(period time.Duration) Option {
+	return func(a *app) {
+		a.retention = period
+	}
 }
 
 type config struct {
@@ -81,15 +138,28 @@ type typeConfig struct {
 	SubTypes []string `json:"subTypes" yaml:"subTypes"`
 }
 
-func New(ctx context.Context, r ThingsReader, w ThingsWriter, msgCtx messaging.MsgContext) ThingsApp {
+func New(ctx context.Context, r ThingsReader, w ThingsWriter, msgCtx messaging.MsgContext, opts ...Option) ThingsApp {
 	a := &app{
 		reader: r,
 		writer: w,
 
-		pub: make(chan string),
+		numberOfWorkers: DefaultNumberOfWorkers,
+		queueSize:       DefaultQueueSize,
+	}
+
+	for _, opt := range opts {
+		opt(a)
 	}
 
-	go publisher(ctx, a.reader, msgCtx, a.pub)
+	a.workers = newWorkers(ctx, a.numberOfWorkers, a.queueSize, a.handle)
+
+	if a.outbox != nil {
+		go relay(ctx, a.reader, a.outbox, msgCtx)
+	}
+
+	if a.retention > 0 {
+		go purgeDeleted(ctx, a.writer, a.retention)
+	}
 
 	return a
 }
@@ -101,136 +171,123 @@ func (a *app) LoadConfig(ctx context.Context, r io.Reader) error {
 		return err
 	}
 
+	// only types, and subtypes, with a registered implementation can be configured
+	errs := []error{}
+	for _, t := range c.Types {
+		errs = append(errs, things.ValidateTypes(t.Type, t.SubTypes))
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return err
+	}
+
 	a.cfg = &c
 
 	return nil
 }
 
-var mu = sync.Mutex{}
-
 func (a *app) HandleMeasurements(ctx context.Context, measurements []things.Measurement) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	changedThings := []string{}
-
-	for _, m := range measurements {
-		changedThings = append(changedThings, a.handle(ctx, m)...)
-	}
-
-	if len(changedThings) > 0 {
-		for _, thingID := range unique(changedThings) {
-			a.pub <- thingID
-		}
-	}
-}
-
-func (a *app) handle(ctx context.Context, m things.Measurement) []string {
-	connectedThings, err := a.getConnectedThings(ctx, m.DeviceID())
-	if err != nil {
-		return []string{}
-	}
+	log := logging.GetFromContext(ctx)
 
-	changedThings := []string{}
+	// the parents of the things are aggregated once, when all measurements have been handled
+	jobCtx, parents := withRollups(ctx)
 
-	for _, t := range connectedThings {
-		measurements := []things.Measurement{m}
-		err := t.Handle(measurements, func(m things.ValueProvider) error {
-			var errs []error
+	jobs := []job{}
 
-			for _, v := range m.Values() {
-				errs = append(errs, a.AddValue(ctx, t, v)) // add value to storage. A value is a measurement with the thingID instead of the deviceID
-			}
-
-			return errors.Join(errs...)
-		})
+	for _, m := range measurements {
+		connectedThings, err := a.getConnectedThings(ctx, m.DeviceID())
 		if err != nil {
 			continue
 		}
 
-		t.SetLastObserved(measurements) // adds the current measurement to its (ref)device and ObservedAt if the timestamp is newer
+		for _, t := range connectedThings {
+			jobs = append(jobs, job{ctx: jobCtx, thingID: t.ID(), measurement: m})
+		}
+	}
 
-		err = a.saveThing(ctx, t)
+	done := make(chan struct{}, len(jobs))
+	queued := 0
+	for _, j := range jobs {
+		j.done = done
+		err := a.workers.enqueue(ctx, j)
 		if err != nil {
-			continue
+			log.Error("could not queue measurement", "thingID", j.thingID, "err", err.Error())
+			break
 		}
+		queued++
+	}
 
-		changedThings = append(changedThings, t.ID())
+	// wait for the workers so that the measurements are handled when this func returns
+	for range queued {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+		}
 	}
 
-	return changedThings
+	parents.aggregate(ctx, a)
 }
 
-func publisher(ctx context.Context, r ThingsReader, msgCtx messaging.MsgContext, in chan string) {
-	log := logging.GetFromContext(ctx)
+// maxHandleAttempts is the number of times a measurement is handled if the thing is modified while the measurement is handled
+const maxHandleAttempts = 3
 
-	thingsToPub := new(sync.Map)
-	pub := make(chan string)
-
-	go func() {
-		for thingID := range pub {
-			result, err := r.QueryThings(ctx, WithID(thingID))
-			if err != nil {
-				log.Error("could not query thing", "err", err.Error())
-				continue
-			}
+// handle is called by a worker and handles a measurement for a single thing. If the thing is modified, e.g. via
+// the API, before it is saved the measurement is handled again using the modified thing.
+func (a *app) handle(ctx context.Context, thingID string, m things.Measurement) {
+	ctx = WithSource(ctx, SourceMeasurement)
 
-			if len(result.Data) != 1 {
-				log.Debug("thing not found", "thingID", thingID, slog.Int("count", len(result.Data)))
-				continue
-			}
+	for attempt := 1; attempt <= maxHandleAttempts; attempt++ {
+		err := a.handleMeasurement(ctx, thingID, m)
+		if !errors.Is(err, ErrVersionConflict) {
+			return
+		}
+		logging.GetFromContext(ctx).Debug("thing was modified while handling measurement", "thingID", thingID, "attempt", attempt)
+	}
+}
 
-			t, err := things.ConvToThing(result.Data[0])
-			if err != nil {
-				log.Error("could not convert thing", "err", err.Error())
-				continue
-			}
+// handleMeasurement reads the thing again since it may have been changed by a measurement handled before this one.
+// Values are added with ON CONFLICT DO NOTHING so handling the same measurement again does not add duplicates.
+func (a *app) handleMeasurement(ctx context.Context, thingID string, m things.Measurement) error {
+	t, version := a.getThingByID(ctx, thingID)
+	if t == nil {
+		return nil
+	}
 
-			msg := &types.ThingUpdated{ // for each updated connected thing, publish thing.updated
-				ID:        t.ID(),
-				Type:      t.Type(),
-				Thing:     stripFields(t),
-				Tenant:    t.Tenant(),
-				Timestamp: time.Now().UTC(),
-			}
+	before := stripFields(t)
 
-			err = msgCtx.PublishOnTopic(ctx, msg)
-			if err != nil {
-				log.Error("could not publish message", "err", err.Error())
-				continue
-			}
+	measurements := []things.Measurement{m}
+	err := t.Handle(measurements, func(m things.ValueProvider) error {
+		var errs []error
 
-			thingsToPub.Delete(thingID)
+		for _, v := range m.Values() {
+			errs = append(errs, a.AddValue(ctx, t, v)) // add value to storage. A value is a measurement with the thingID instead of the deviceID
 		}
-	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
+		return errors.Join(errs...)
+	})
+	if errors.Is(err, things.ErrNotChanged) {
+		return nil // the values are stored, but the thing is not saved so that thing.updated is not published
+	}
+	if err != nil {
+		return nil
+	}
 
-		case thingID := <-in:
-			pubAfter := time.Now().Add(2 * time.Second)
-			thingsToPub.Store(thingID, pubAfter)
-
-		case ts := <-time.Tick(2 * time.Second):
-			thingsToPub.Range(func(key, value any) bool {
-				t, ok := value.(time.Time)
-				if ok {
-					if t.Before(ts) {
-						thingID, ok := key.(string)
-						if ok {
-							pub <- thingID
-						}
-					}
-				}
-				return true
-			})
-		}
+	t.SetLastObserved(measurements) // adds the current measurement to its (ref)device and ObservedAt if the timestamp is newer
+
+	err = a.saveThing(ctx, t, version) // saving the thing adds it to the outbox, i.e. thing.updated will be published
+	if err != nil {
+		logging.GetFromContext(ctx).Debug("could not save thing", "thingID", t.ID(), "err", err.Error())
+		return err
 	}
+
+	a.rollup(ctx, t.Parent(), changedProperties(before, stripFields(t)))
+
+	return nil
 }
 
-func (a *app) AddThing(ctx context.Context, b []byte) error {
+func (a *app) AddThing(ctx context.Context, b []byte, tenants []string) error {
 	t, err := things.ConvToThing(b)
 	if err != nil {
 		return err
@@ -245,16 +302,33 @@ func (a *app) AddThing(ctx context.Context, b []byte) error {
 	if t.Type() == "" {
 		return ErrMissingThingType
 	}
+	if !slices.Contains(tenants, t.Tenant()) {
+		return ErrTenantNotAllowed
+	}
+
+	err = things.Validate(b)
+	if err != nil {
+		return err
+	}
 
-	err = a.writer.AddThing(ctx, t)
+	err = a.checkParent(ctx, t)
 	if err != nil {
 		return err
 	}
 
+	err = a.writer.AddThing(ctx, t, newThingCreated(t))
+	if err != nil {
+		return err
+	}
+
+	a.aggregate(ctx, t.Parent())
+
 	return nil
 }
 
-func (a *app) UpdateThing(ctx context.Context, b []byte, tenants []string) error {
+// UpdateThing replaces a thing. If version is not 0 the thing is only updated if that is its current version.
+// ErrProtectedProperty is returned if the type or tenant of the thing is changed.
+func (a *app) UpdateThing(ctx context.Context, b []byte, version int64, tenants []string) error {
 	if len(tenants) == 0 {
 		return errors.New("tenants must be provided")
 	}
@@ -274,6 +348,11 @@ func (a *app) UpdateThing(ctx context.Context, b []byte, tenants []string) error
 		return ErrMissingThingType
 	}
 
+	err = things.Validate(b)
+	if err != nil {
+		return err
+	}
+
 	result, err := a.reader.QueryThings(ctx, WithID(t.ID()), WithTenants(tenants))
 	if err != nil {
 		return err
@@ -282,15 +361,38 @@ func (a *app) UpdateThing(ctx context.Context, b []byte, tenants []string) error
 		return ErrThingNotFound
 	}
 
-	err = a.writer.UpdateThing(ctx, t)
+	_, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
+	current, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return err
+	}
+
+	if current.Type() != t.Type() || current.Tenant() != t.Tenant() {
+		return ErrProtectedProperty
+	}
+
+	if parentChanged(current, t) {
+		err = a.checkParent(ctx, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.writer.UpdateThing(ctx, t, version, devicesChanged(current, t)...)
 	if err != nil {
 		return err
 	}
 
+	a.aggregate(ctx, current.Parent(), t.Parent())
+
 	return nil
 }
 
-func (a *app) saveThing(ctx context.Context, t things.Thing) error {
+func (a *app) saveThing(ctx context.Context, t things.Thing, version int64) error {
 	if t.ID() == "" {
 		return ErrMissingThingID
 	}
@@ -301,7 +403,7 @@ func (a *app) saveThing(ctx context.Context, t things.Thing) error {
 		return ErrMissingThingType
 	}
 
-	err := a.writer.UpdateThing(ctx, t)
+	err := a.writer.UpdateThing(ctx, t, version)
 	if err != nil {
 		return err
 	}
@@ -309,16 +411,40 @@ func (a *app) saveThing(ctx context.Context, t things.Thing) error {
 	return nil
 }
 
-func (a *app) MergeThing(ctx context.Context, thingID string, b []byte, tenants []string) error {
+// MergeThing applies a JSON Merge Patch (RFC 7396) to a thing. If version is not 0 the thing is only patched if that is its current version.
+func (a *app) MergeThing(ctx context.Context, thingID string, b []byte, version int64, tenants []string) error {
+	var patch any
+	err := json.Unmarshal(b, &patch)
+	if err != nil {
+		return fmt.Errorf("%w, %s", ErrInvalidPatch, err.Error())
+	}
+
+	return a.patchThing(ctx, thingID, version, tenants, func(doc any) (any, error) {
+		return mergePatch(doc, patch), nil
+	})
+}
+
+// PatchThing applies a JSON Patch (RFC 6902) to a thing. If version is not 0 the thing is only patched if that is its current version.
+func (a *app) PatchThing(ctx context.Context, thingID string, b []byte, version int64, tenants []string) error {
+	return a.patchThing(ctx, thingID, version, tenants, func(doc any) (any, error) {
+		return jsonPatch(doc, b)
+	})
+}
+
+// patchThing applies patch to the current thing, validates the patched thing and saves it. A patch without a version
+// is applied again if the thing is modified before the patched thing is saved.
+func (a *app) patchThing(ctx context.Context, thingID string, version int64, tenants []string, patch func(doc any) (any, error)) error {
 	if len(tenants) == 0 {
 		return ErrMissingThingTenant
 	}
 
-	patch := make(map[string]any)
-	err := json.Unmarshal(b, &patch)
-	if err != nil {
-		return err
-	}
+	return retryOnConflict(ctx, thingID, version, func() error {
+		return a.patchCurrent(ctx, thingID, version, tenants, patch)
+	})
+}
+
+// patchCurrent applies patch to the current version of the thing and saves it as long as that is still the current version
+func (a *app) patchCurrent(ctx context.Context, thingID string, version int64, tenants []string, patch func(doc any) (any, error)) error {
 
 	result, err := a.reader.QueryThings(ctx, WithID(thingID), WithTenants(tenants))
 	if err != nil {
@@ -328,20 +454,39 @@ func (a *app) MergeThing(ctx context.Context, thingID string, b []byte, tenants
 		return ErrThingNotFound
 	}
 
+	version, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
 	current := make(map[string]any)
 	err = json.Unmarshal(result.Data[0], &current)
 	if err != nil {
 		return err
 	}
 
-	for k, v := range patch {
-		if slices.Contains([]string{"id", "type"}, k) {
-			continue
-		}
-		current[k] = v
+	// patch a copy of the thing, so that protected properties can be compared afterwards
+	var doc any
+	err = json.Unmarshal(result.Data[0], &doc)
+	if err != nil {
+		return err
 	}
 
-	v, err := json.Marshal(current)
+	patched, err := patch(doc)
+	if err != nil {
+		return err
+	}
+
+	if protectedPropertiesChanged(current, patched) {
+		return ErrProtectedProperty
+	}
+
+	v, err := json.Marshal(patched)
+	if err != nil {
+		return err
+	}
+
+	err = things.Validate(v)
 	if err != nil {
 		return err
 	}
@@ -351,15 +496,30 @@ func (a *app) MergeThing(ctx context.Context, thingID string, b []byte, tenants
 		return err
 	}
 
-	err = a.writer.UpdateThing(ctx, patchedThing)
+	currentThing, err := things.ConvToThing(result.Data[0])
 	if err != nil {
 		return err
 	}
 
+	if parentChanged(currentThing, patchedThing) {
+		err = a.checkParent(ctx, patchedThing)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.writer.UpdateThing(ctx, patchedThing, version, devicesChanged(currentThing, patchedThing)...)
+	if err != nil {
+		return err
+	}
+
+	a.aggregate(ctx, currentThing.Parent(), patchedThing.Parent())
+
 	return nil
 }
 
-func (a *app) DeleteThing(ctx context.Context, thingID string, tenants []string) error {
+// DeleteThing deletes a thing. If version is not 0 the thing is only deleted if that is its current version.
+func (a *app) DeleteThing(ctx context.Context, thingID string, version int64, tenants []string) error {
 	if len(tenants) == 0 {
 		return ErrMissingThingTenant
 	}
@@ -372,45 +532,209 @@ func (a *app) DeleteThing(ctx context.Context, thingID string, tenants []string)
 		return ErrThingNotFound
 	}
 
-	err = a.writer.DeleteThing(ctx, thingID)
+	_, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
+	t, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return err
+	}
+
+	err = a.writer.DeleteThing(ctx, thingID, version, newThingDeleted(t))
+	if err != nil {
+		return err
+	}
+
+	a.aggregate(ctx, t.Parent())
+
+	return nil
+}
+
+// RestoreThing restores a deleted thing. If version is not 0 the thing is only restored if that is its current version.
+// The restored thing is published as thing.created.
+func (a *app) RestoreThing(ctx context.Context, thingID string, version int64, tenants []string) error {
+	if len(tenants) == 0 {
+		return ErrMissingThingTenant
+	}
+
+	result, err := a.reader.QueryThings(ctx, WithID(thingID), WithTenants(tenants), WithDeleted(true))
+	if err != nil {
+		return err
+	}
+	if len(result.Data) != 1 {
+		return ErrThingNotFound
+	}
+
+	_, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
+	t, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return err
+	}
+
+	err = a.writer.RestoreThing(ctx, thingID, version, newThingCreated(t))
 	if err != nil {
 		return err
 	}
 
+	a.aggregate(ctx, t.Parent())
+
 	return nil
 }
 
-func (a *app) QueryThings(ctx context.Context, params map[string][]string) (QueryResult, error) {
-	result, err := a.reader.QueryThings(ctx, WithParams(params)...)
+// PurgeThing permanently removes a thing, deleted or not, with its history and values. If version is not 0 the thing
+// is only removed if that is its current version. thing.deleted is published if the thing was not already deleted.
+func (a *app) PurgeThing(ctx context.Context, thingID string, version int64, tenants []string) error {
+	if len(tenants) == 0 {
+		return ErrMissingThingTenant
+	}
+
+	var events []messaging.TopicMessage
+	var parentID string
+
+	result, err := a.reader.QueryThings(ctx, WithID(thingID), WithTenants(tenants))
+	if err != nil {
+		return err
+	}
+	if len(result.Data) == 1 {
+		t, err := things.ConvToThing(result.Data[0])
+		if err != nil {
+			return err
+		}
+		events = append(events, newThingDeleted(t))
+		parentID = t.Parent()
+	} else {
+		result, err = a.reader.QueryThings(ctx, WithID(thingID), WithTenants(tenants), WithDeleted(true))
+		if err != nil {
+			return err
+		}
+		if len(result.Data) != 1 {
+			return ErrThingNotFound
+		}
+	}
+
+	_, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
+	err = a.writer.PurgeThing(ctx, thingID, version, events...)
+	if err != nil {
+		return err
+	}
+
+	a.aggregate(ctx, parentID)
+
+	return nil
+}
+
+func (a *app) QueryThings(ctx context.Context, params map[string][]string, tenants []string) (QueryResult, error) {
+	err := validateGeometry(params)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	allowed := allowedTenants(params, tenants)
+	if len(allowed) == 0 {
+		return QueryResult{Data: [][]byte{}}, nil
+	}
+
+	conditions := append(WithParams(params), WithTenants(allowed))
+
+	result, err := a.reader.QueryThings(ctx, conditions...)
 	if err != nil {
 		return QueryResult{}, err
 	}
 	return result, nil
 }
 
-func (a *app) QueryValues(ctx context.Context, params map[string][]string) (QueryResult, error) {
-	result, err := a.reader.QueryValues(ctx, WithParams(params)...)
+func (a *app) QueryValues(ctx context.Context, params map[string][]string, tenants []string) (QueryResult, error) {
+	allowed := allowedTenants(params, tenants)
+	if len(allowed) == 0 {
+		return QueryResult{Data: [][]byte{}}, nil
+	}
+
+	conditions := append(WithParams(params), WithTenants(allowed))
+
+	result, err := a.reader.QueryValues(ctx, conditions...)
 	if err != nil {
 		return QueryResult{}, err
 	}
 	return result, nil
 }
 
-func (a *app) getThingByID(ctx context.Context, thingID string) things.Thing {
+// allowedTenants returns the requested tenants (if any) that the caller is allowed to read, or all allowed tenants if none were requested
+func allowedTenants(params map[string][]string, tenants []string) []string {
+	requested := []string{}
+	for k, v := range params {
+		if strings.ToLower(k) == "tenant" {
+			requested = append(requested, v...)
+		}
+	}
+
+	if len(requested) == 0 {
+		return tenants
+	}
+
+	allowed := []string{}
+	for _, t := range requested {
+		if slices.Contains(tenants, t) && !slices.Contains(allowed, t) {
+			allowed = append(allowed, t)
+		}
+	}
+
+	return allowed
+}
+
+// retryOnConflict calls fn, that changes the current version of a thing, again if the thing was modified before it
+// was saved. fn is only called once if the caller expects a specific version, i.e. version is not 0.
+func retryOnConflict(ctx context.Context, thingID string, version int64, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if version != 0 || attempt >= maxHandleAttempts || !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+		logging.GetFromContext(ctx).Debug("thing was modified while it was changed", "thingID", thingID, "attempt", attempt)
+	}
+}
+
+// checkVersion returns the version of the thing in result, or ErrVersionConflict if it is not the expected version. An expected version of 0 matches any version.
+func checkVersion(result QueryResult, expected int64) (int64, error) {
+	var version int64
+	if len(result.Versions) > 0 {
+		version = result.Versions[0]
+	}
+
+	if expected != 0 && expected != version {
+		return 0, ErrVersionConflict
+	}
+
+	return version, nil
+}
+
+// getThingByID returns the thing and its version, or nil if the thing could not be found
+func (a *app) getThingByID(ctx context.Context, thingID string) (things.Thing, int64) {
 	result, err := a.reader.QueryThings(ctx, WithID(thingID))
 	if err != nil {
-		return nil
+		return nil, 0
 	}
 	if len(result.Data) != 1 {
-		return nil
+		return nil, 0
 	}
 
 	t, err := things.ConvToThing(result.Data[0])
 	if err != nil {
-		return nil
+		return nil, 0
 	}
 
-	return t
+	version, _ := checkVersion(result, 0)
+
+	return t, version
 }
 
 func (a *app) getConnectedThings(ctx context.Context, deviceID string) ([]things.Thing, error) {
@@ -454,174 +778,46 @@ func (a *app) AddValue(ctx context.Context, t things.Thing, m things.Value) erro
 	return a.writer.AddValue(ctx, t, m)
 }
 
-func (a *app) Seed(ctx context.Context, r io.Reader) error {
-	f := csv.NewReader(r)
-	f.Comma = ';'
-	rowNum := 0
-
-	location := func(s string) things.Location {
-		parts := strings.Split(s, ",")
-		if len(parts) != 2 {
-			return things.Location{}
-		}
-
-		parse := func(s string) float64 {
-			f, err := strconv.ParseFloat(s, 64)
-			if err != nil {
-				return 0.0
-			}
-			return f
-		}
-
-		return things.Location{
-			Latitude:  parse(parts[0]),
-			Longitude: parse(parts[1]),
-		}
-	}
-
-	tags := func(t string) []string {
-		if t == "" {
-			return []string{}
-		}
-		if !strings.Contains(t, ",") {
-			return []string{t}
-		}
-		tags := strings.Split(t, ",")
-		return tags
-	}
-
-	refDevices := func(t string) []things.Device {
-		if t == "" {
-			return nil
-		}
-		if !strings.Contains(t, ",") {
-			return []things.Device{{DeviceID: t}}
-		}
-		devices := []things.Device{}
-		for _, s := range strings.Split(t, ",") {
-			devices = append(devices, things.Device{DeviceID: s})
-		}
-		return devices
-	}
+func (a *app) GetTypes(ctx context.Context, tenants []string) ([]things.ThingType, error) {
+	types := make([]things.ThingType, 0)
 
-	args := func(t string) map[string]any {
-		m := make(map[string]any)
-		if t == "" {
-			return nil
-		}
-		t = strings.ReplaceAll(t, "'", "\"")
-		err := json.Unmarshal([]byte(t), &m)
-		if err != nil {
-			return nil
+	// without a config all registered types are available
+	cfg := a.cfg
+	if cfg == nil {
+		cfg = &config{}
+		for _, r := range things.Registrations() {
+			subTypes := slices.Sorted(maps.Keys(r.SubTypes))
+			cfg.Types = append(cfg.Types, typeConfig{Type: r.Type, SubTypes: subTypes})
 		}
-		return m
 	}
 
-	tenants := []string{"default"}
-
-	for {
-		record, err := f.Read()
-		if err == io.EOF {
-			break
-		}
-
-		if rowNum == 0 {
-			rowNum++
+	for _, t := range cfg.Types {
+		r, ok := things.Registered(t.Type)
+		if !ok {
 			continue
 		}
 
-		//  0	 1      2      3         4           5       6      7       8         9
-		// id, type, subType, name, decsription, location, tenant, tags, refDevices, args
-
-		id_ := record[0]
-		type_ := record[1]
-		subType_ := record[2]
-		name_ := record[3]
-		description_ := record[4]
-		location_ := location(record[5])
-		tenant_ := record[6]
-		tags_ := tags(record[7])
-		refDevices_ := refDevices(record[8])
-
-		m := make(map[string]any)
-
-		current := a.getThingByID(ctx, id_)
-		if current != nil {
-			err := json.Unmarshal(current.Byte(), &m)
-			if err != nil {
-				return err
-			}
-		} else {
-			m["id"] = id_
-			m["type"] = type_
-		}
-
-		if subType_ != "" {
-			m["subType"] = subType_
-		} else {
-			delete(m, "subType")
-		}
-
-		m["name"] = name_
-		m["description"] = description_
-		m["location"] = location_
-		m["tenant"] = tenant_
-
-		if len(tags_) > 0 {
-			m["tags"] = tags_
-		} else {
-			delete(m, "tags")
-		}
-
-		if len(refDevices_) > 0 {
-			m["refDevices"] = refDevices_
-		} else {
-			delete(m, "refDevices")
-		}
-
-		for k, v := range args(record[9]) {
-			m[k] = v
-		}
-
-		b, err := json.Marshal(m)
-		if err != nil {
-			return err
-		}
-
-		if !slices.Contains(tenants, tenant_) {
-			tenants = append(tenants, tenant_)
-		}
-
-		if current == nil {
-			err = a.AddThing(ctx, b)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = a.UpdateThing(ctx, b, tenants)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-func (a *app) GetTypes(ctx context.Context, tenants []string) ([]things.ThingType, error) {
-	types := make([]things.ThingType, 0)
-
-	for _, t := range a.cfg.Types {
+		c := r.CapabilitiesOf("")
 		types = append(types, things.ThingType{
-			Type: t.Type,
-			Name: t.Type,
+			Type:       r.Type,
+			Name:       r.Type,
+			URNs:       c.URNs,
+			Properties: c.Properties,
 		})
 
 		for _, s := range t.SubTypes {
+			subType, ok := r.SubType(s)
+			if !ok {
+				continue
+			}
+
+			c := r.CapabilitiesOf(subType)
 			types = append(types, things.ThingType{
-				Type:    t.Type,
-				SubType: s,
-				Name:    fmt.Sprintf("%s-%s", t.Type, s),
+				Type:       r.Type,
+				SubType:    subType,
+				Name:       fmt.Sprintf("%s-%s", r.Type, subType),
+				URNs:       c.URNs,
+				Properties: c.Properties,
 			})
 		}
 	}
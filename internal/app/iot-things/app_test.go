@@ -2,10 +2,16 @@ package iotthings
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/messaging-golang/pkg/messaging"
 	"github.com/matryer/is"
 )
 
@@ -20,13 +26,13 @@ func TestSeed(t *testing.T) {
 		},
 	}
 	w := &ThingsWriterMock{
-		AddThingFunc: func(ctx context.Context, t things.Thing) error {
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 			return nil
 		},
 	}
 
 	app := New(ctx, r, w, msgCtxMock())
-	app.Seed(ctx, strings.NewReader(csvData))
+	app.Seed(ctx, strings.NewReader(csvData), SeedCSV, false, nil)
 }
 
 func TestSeedUpdate(t *testing.T) {
@@ -56,16 +62,16 @@ func TestSeedUpdate(t *testing.T) {
 		},
 	}
 	w := &ThingsWriterMock{
-		AddThingFunc: func(ctx context.Context, t things.Thing) error {
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 			return nil
 		},
-		UpdateThingFunc: func(ctx context.Context, t things.Thing) error {
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
 			return nil
 		},
 	}
 
 	app := New(ctx,r, w, msgCtxMock())
-	app.Seed(ctx, strings.NewReader(csvData))
+	app.Seed(ctx, strings.NewReader(csvData), SeedCSV, false, nil)
 }
 
 func TestLoadConfig(t *testing.T) {
@@ -80,27 +86,259 @@ func TestLoadConfig(t *testing.T) {
 		},
 	}
 	w := &ThingsWriterMock{
-		AddThingFunc: func(ctx context.Context, t things.Thing) error {
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 			return nil
 		},
 	}
 
 	yamlConfig := `
 types:
+  - type: "Container"
+    subTypes:
+      - "WasteContainer"
+      - "Sandstorage"
+  - type: "Pumpingstation"
+  - type: "Room"
+`
+
+	app := New(ctx,r, w, msgCtxMock())
+	err := app.LoadConfig(ctx, strings.NewReader(yamlConfig))
+	is.NoErr(err)
+
+	types, err := app.GetTypes(ctx, []string{"default"})
+	is.NoErr(err)
+	is.Equal(len(types), 5)
+	is.Equal(types[1].Name, "Container-WasteContainer")
+	is.Equal(types[1].URNs, []string{things.DistanceURN})
+	is.Equal(types[1].Properties, []string{"currentLevel", "percent", "volume", "lastEmptiedAt", "fillRate", "predictedFullAt"})
+	is.Equal(types[3].Type, "PumpingStation") // type names are those of the registered types
+}
+
+func TestLoadConfigWithUnknownTypes(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	yamlConfig := `
+types:
   - type: "exampleType1"
+  - type: "Container"
     subTypes:
       - "subType1A"
-      - "subType1B"
-  - type: "exampleType2"
-    subTypes:
-      - "subType2A"
-      - "subType2B"
-      - "subType2C"
 `
 
-	app := New(ctx,r, w, msgCtxMock())
+	app := New(ctx, &ThingsReaderMock{}, &ThingsWriterMock{}, msgCtxMock())
 	err := app.LoadConfig(ctx, strings.NewReader(yamlConfig))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "unknown thing type [exampleType1]"))
+	is.True(strings.Contains(err.Error(), "unknown subtype [subType1A] of thing type [Container]"))
+}
+
+func TestHandleMeasurementsPreservesOrderPerThing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	r, w, store := benchmarkMocks(10, 0)
+	a := New(ctx, r, w, msgCtxMock(), WithWorkers(4, 10))
+
+	measurements := []things.Measurement{}
+	for i := range 100 {
+		v := float64(i)
+		measurements = append(measurements, things.Measurement{
+			ID:        "device-0/3303/5700",
+			Urn:       things.TemperatureURN,
+			Value:     &v,
+			Timestamp: time.Now().Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	a.HandleMeasurements(ctx, measurements)
+
+	last := store.get("room-0").Refs()[0].Measurements["device-0/3303/5700"]
+	is.Equal(*last.Value, 99.0)
+}
+
+func TestHandleMeasurementsRetriesWhenThingIsModified(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	r, w, store := benchmarkMocks(1, 0)
+
+	// the thing is modified, e.g. via the API, while the first measurement is handled
+	update := w.UpdateThingFunc
+	w.UpdateThingFunc = func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+		if len(w.UpdateThingCalls()) == 1 {
+			room := store.get("room-0").(*things.Room)
+			room.Name = "modified"
+			is.NoErr(update(ctx, room, 0))
+		}
+		return update(ctx, t, version, events...)
+	}
+
+	a := New(ctx, r, w, msgCtxMock(), WithWorkers(1, 10))
+
+	v := 21.0
+	a.HandleMeasurements(ctx, []things.Measurement{{
+		ID:        "device-0/3303/5700",
+		Urn:       things.TemperatureURN,
+		Value:     &v,
+		Timestamp: time.Now(),
+	}})
+
+	is.Equal(len(w.UpdateThingCalls()), 2) // the measurement is handled again using the modified thing
+
+	room := store.get("room-0").(*things.Room)
+	is.Equal(room.Name, "modified")
+	is.Equal(*room.Refs()[0].Measurements["device-0/3303/5700"].Value, 21.0)
+	is.Equal(store.versions["room-0"], int64(3))
+}
+
+func TestUpdateThingWithOtherVersionIsConflict(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	r, w, store := benchmarkMocks(1, 0)
+	a := New(ctx, r, w, msgCtxMock())
+
+	room := store.get("room-0")
+
+	err := a.UpdateThing(ctx, room.Byte(), 2, []string{"default"})
+	is.True(errors.Is(err, ErrVersionConflict))
+	is.Equal(len(w.UpdateThingCalls()), 0)
+
+	err = a.MergeThing(ctx, room.ID(), []byte(`{"name":"room"}`), 1, []string{"default"})
 	is.NoErr(err)
+	is.Equal(w.UpdateThingCalls()[0].Version, int64(1))
+
+	err = a.PatchThing(ctx, room.ID(), []byte(`[{"op":"replace","path":"/name","value":"room 0"}]`), 1, []string{"default"})
+	is.True(errors.Is(err, ErrVersionConflict))
+}
+
+func TestChangeWithoutVersion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	r, w, store := benchmarkMocks(1, 0)
+	a := New(ctx, r, w, msgCtxMock())
+
+	room := store.get("room-0")
+
+	// a thing that is replaced without a version is saved regardless of its current version
+	is.NoErr(a.UpdateThing(ctx, room.Byte(), 0, []string{"default"}))
+	is.Equal(w.UpdateThingCalls()[0].Version, int64(0))
+
+	// the thing is modified, e.g. by a measurement, while it is patched
+	update := w.UpdateThingFunc
+	w.UpdateThingFunc = func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+		if len(w.UpdateThingCalls()) == 2 {
+			is.NoErr(update(ctx, store.get("room-0"), 0))
+		}
+		return update(ctx, t, version, events...)
+	}
+
+	is.NoErr(a.MergeThing(ctx, room.ID(), []byte(`{"name":"patched"}`), 0, []string{"default"}))
+	is.Equal(len(w.UpdateThingCalls()), 3) // the patch is applied again to the modified thing
+	is.Equal(store.get("room-0").(*things.Room).Name, "patched")
+}
+
+func BenchmarkHandleMeasurements(b *testing.B) {
+	for _, n := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers-%d", n), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r, w, _ := benchmarkMocks(100, time.Millisecond)
+			a := New(ctx, r, w, msgCtxMock(), WithWorkers(n, DefaultQueueSize))
+
+			var i atomic.Int64
+
+			b.SetParallelism(16)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := i.Add(1)
+					v := float64(n % 40)
+					a.HandleMeasurements(ctx, []things.Measurement{{
+						ID:        fmt.Sprintf("device-%d/3303/5700", n%100),
+						Urn:       things.TemperatureURN,
+						Value:     &v,
+						Timestamp: time.Now(),
+					}})
+				}
+			})
+
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "measurements/s")
+		})
+	}
+}
+
+type thingStore struct {
+	mu       sync.RWMutex
+	things   map[string][]byte
+	versions map[string]int64
+}
+
+func (s *thingStore) get(thingID string) things.Thing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, _ := things.ConvToThing(s.things[thingID])
+	return t
+}
+
+// benchmarkMocks creates mocks for n rooms, room-0 to room-n, each connected to a device (device-0 to device-n).
+// Writes to storage are delayed by latency.
+func benchmarkMocks(n int, latency time.Duration) (*ThingsReaderMock, *ThingsWriterMock, *thingStore) {
+	store := &thingStore{things: map[string][]byte{}, versions: map[string]int64{}}
+
+	for i := range n {
+		room := things.NewRoom(fmt.Sprintf("room-%d", i), things.DefaultLocation, "default")
+		room.AddDevice(fmt.Sprintf("device-%d", i))
+		store.things[room.ID()] = room.Byte()
+		store.versions[room.ID()] = 1
+	}
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			c := newConditions(conditions...)
+
+			store.mu.RLock()
+			defer store.mu.RUnlock()
+
+			thingID, ok := c["id"].(string)
+			if !ok {
+				deviceID := c["refdevice"].(string)
+				thingID = "room-" + strings.TrimPrefix(deviceID, "device-")
+			}
+
+			return QueryResult{Data: [][]byte{store.things[thingID]}, Versions: []int64{store.versions[thingID]}}, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		AddValueFunc: func(ctx context.Context, t things.Thing, m things.Value) error {
+			return nil
+		},
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			time.Sleep(latency)
+
+			store.mu.Lock()
+			defer store.mu.Unlock()
+
+			if version != 0 && version != store.versions[t.ID()] {
+				return ErrVersionConflict
+			}
+
+			store.things[t.ID()] = t.Byte()
+			store.versions[t.ID()]++
+
+			return nil
+		},
+	}
+
+	return r, w, store
 }
 
 func newConditions(conditions ...ConditionFunc) map[string]any {
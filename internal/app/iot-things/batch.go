@@ -0,0 +1,149 @@
+package iotthings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+// BatchMode decides how things in a batch that already exist are handled
+type BatchMode string
+
+const (
+	// BatchCreate only adds things, a thing that already exists is an error
+	BatchCreate BatchMode = "create"
+	// BatchUpsert adds things, or merges them into existing things as a JSON Merge Patch
+	BatchUpsert BatchMode = "upsert"
+	// BatchReplace adds things, or replaces existing things
+	BatchReplace BatchMode = "replace"
+)
+
+var (
+	ErrInvalidBatchMode   = errors.New("batch mode must be create, upsert or replace")
+	ErrInvalidBatchItem   = errors.New("item is not a thing")
+	ErrBatchRolledBack    = errors.New("item was not saved since another item in the batch failed")
+	ErrBatchNotAtomic     = errors.New("batches can not be saved in a single transaction")
+	errBatchItemsNotSaved = errors.New("one or more items in the batch failed")
+)
+
+// BatchResult is the outcome of an item in a batch. Created is true if the thing was added, Err is nil if the item was saved.
+type BatchResult struct {
+	Index   int
+	ID      string
+	Created bool
+	Err     error
+}
+
+// AddThings adds, or updates, each thing in items according to mode. If atomic is true all things are saved in a single
+// transaction, and none of them are saved if any item fails. Otherwise each item is saved on its own.
+func (a *app) AddThings(ctx context.Context, items [][]byte, mode BatchMode, atomic bool, tenants []string) ([]BatchResult, error) {
+	if !slices.Contains([]BatchMode{BatchCreate, BatchUpsert, BatchReplace}, mode) {
+		return nil, ErrInvalidBatchMode
+	}
+	if len(tenants) == 0 {
+		return nil, ErrMissingThingTenant
+	}
+
+	if !atomic {
+		return a.addThings(ctx, items, mode, tenants), nil
+	}
+
+	if a.tx == nil {
+		return nil, ErrBatchNotAtomic
+	}
+
+	var results []BatchResult
+
+	err := a.tx.InTransaction(ctx, func(r ThingsReader, w ThingsWriter) error {
+		results = a.withStorage(r, w).addThings(ctx, items, mode, tenants)
+
+		for _, result := range results {
+			if result.Err != nil {
+				return errBatchItemsNotSaved
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchItemsNotSaved) {
+		return nil, err
+	}
+
+	if err != nil {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Created = false
+				results[i].Err = ErrBatchRolledBack
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// withStorage returns a copy of the app that reads and writes using r and w, e.g. in a transaction
+func (a *app) withStorage(r ThingsReader, w ThingsWriter) *app {
+	c := *a
+	c.reader = r
+	c.writer = w
+	return &c
+}
+
+func (a *app) addThings(ctx context.Context, items [][]byte, mode BatchMode, tenants []string) []BatchResult {
+	results := make([]BatchResult, 0, len(items))
+
+	for i, b := range items {
+		id, created, err := a.addOrUpdateThing(ctx, b, mode, tenants)
+		results = append(results, BatchResult{Index: i, ID: id, Created: created, Err: err})
+	}
+
+	return results
+}
+
+// addOrUpdateThing adds a thing, or updates an existing thing if mode is not BatchCreate, and returns its id and if it was added
+func (a *app) addOrUpdateThing(ctx context.Context, b []byte, mode BatchMode, tenants []string) (string, bool, error) {
+	t := struct {
+		ID string `json:"id"`
+	}{}
+	err := json.Unmarshal(b, &t)
+	if err != nil {
+		return "", false, ErrInvalidBatchItem
+	}
+	if t.ID == "" {
+		return "", false, ErrMissingThingID
+	}
+
+	exists := false
+
+	if mode != BatchCreate {
+		result, err := a.reader.QueryThings(ctx, WithID(t.ID), WithTenants(tenants))
+		if err != nil {
+			return t.ID, false, err
+		}
+		exists = len(result.Data) == 1
+	}
+
+	if exists && mode == BatchUpsert {
+		return t.ID, false, a.MergeThing(ctx, t.ID, b, 0, tenants)
+	}
+
+	// validate first so that properties of the wrong type are reported as validation errors
+	err = things.Validate(b)
+	if err != nil {
+		return t.ID, false, err
+	}
+
+	if exists {
+		return t.ID, false, a.UpdateThing(ctx, b, 0, tenants)
+	}
+
+	err = a.AddThing(ctx, b, tenants)
+	if err != nil {
+		return t.ID, false, err
+	}
+
+	return t.ID, true, nil
+}
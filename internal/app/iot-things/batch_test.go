@@ -0,0 +1,113 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestAddThings(t *testing.T) {
+	tests := map[BatchMode][]error{
+		BatchCreate:  {nil, ErrAlreadyExists, ErrMissingThingID},
+		BatchUpsert:  {nil, nil, ErrMissingThingID},
+		BatchReplace: {nil, nil, ErrMissingThingID},
+	}
+
+	for mode, errs := range tests {
+		t.Run(string(mode), func(t *testing.T) {
+			ctx := context.Background()
+			is := is.New(t)
+
+			r, w, store := partsMocks(`{"id":"room-001","type":"Room","tenant":"default","name":"Room 1","description":"first room"}`)
+			a := New(ctx, r, w, msgCtxMock())
+
+			results, err := a.AddThings(ctx, [][]byte{
+				[]byte(`{"id":"room-002","type":"Room","tenant":"default"}`),
+				[]byte(`{"id":"room-001","type":"Room","tenant":"default","name":"Room one"}`),
+				[]byte(`{"type":"Room","tenant":"default"}`),
+			}, mode, false, []string{"default"})
+			is.NoErr(err)
+			is.Equal(len(results), 3)
+
+			for i, result := range results {
+				is.Equal(result.Index, i)
+				is.True(errors.Is(result.Err, errs[i]))
+			}
+
+			is.True(results[0].Created)
+			is.True(!results[1].Created)
+
+			room := string(store.get("room-001").Byte())
+
+			switch mode {
+			case BatchCreate:
+				is.True(strings.Contains(room, `"name":"Room 1"`))
+			case BatchUpsert:
+				is.True(strings.Contains(room, `"name":"Room one"`))
+				is.True(strings.Contains(room, `"description":"first room"`))
+			case BatchReplace:
+				is.True(strings.Contains(room, `"name":"Room one"`))
+				is.True(!strings.Contains(room, `"description":"first room"`))
+			}
+		})
+	}
+}
+
+func TestAddThingsInTransaction(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(`{"id":"room-001","type":"Room","tenant":"default"}`)
+	tx := &transactorMock{r: r, w: w}
+
+	a := New(ctx, r, w, msgCtxMock(), WithTransactions(tx))
+
+	results, err := a.AddThings(ctx, [][]byte{
+		[]byte(`{"id":"room-002","type":"Room","tenant":"default"}`),
+		[]byte(`{"id":"room-001","type":"Room","tenant":"default"}`),
+	}, BatchCreate, true, []string{"default"})
+	is.NoErr(err)
+
+	is.True(errors.Is(tx.err, errBatchItemsNotSaved)) // the transaction is rolled back
+	is.True(errors.Is(results[0].Err, ErrBatchRolledBack))
+	is.True(!results[0].Created)
+	is.True(errors.Is(results[1].Err, ErrAlreadyExists))
+
+	_, err = New(ctx, r, w, msgCtxMock()).AddThings(ctx, [][]byte{}, BatchCreate, true, []string{"default"})
+	is.True(errors.Is(err, ErrBatchNotAtomic))
+
+	_, err = a.AddThings(ctx, [][]byte{}, "merge", false, []string{"default"})
+	is.True(errors.Is(err, ErrInvalidBatchMode))
+}
+
+// transactorMock calls fn with the reader and writer and keeps the error returned by fn
+type transactorMock struct {
+	r   ThingsReader
+	w   ThingsWriter
+	err error
+}
+
+func (m *transactorMock) InTransaction(ctx context.Context, fn func(r ThingsReader, w ThingsWriter) error) error {
+	m.err = fn(m.r, m.w)
+	return m.err
+}
+
+func TestWithStorageKeepsTheApp(t *testing.T) {
+	is := is.New(t)
+
+	r, w, _ := partsMocks()
+	a := &app{reader: &ThingsReaderMock{}, writer: &ThingsWriterMock{}, outbox: &ThingsOutboxMock{}, cfg: &config{}, retention: time.Hour}
+
+	tx := a.withStorage(r, w)
+
+	is.Equal(tx.reader, r)
+	is.Equal(tx.writer, w)
+	is.Equal(tx.outbox, a.outbox)
+	is.Equal(tx.cfg, a.cfg)
+	is.Equal(tx.retention, time.Hour)
+	is.True(a.reader != tx.reader) // the app itself is not changed
+}
@@ -1,6 +1,8 @@
 package iotthings
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
@@ -8,10 +10,13 @@ import (
 	"time"
 )
 
+var ErrInvalidGeometry = errors.New("invalid geometry")
+
 type ConditionFunc func(map[string]any) map[string]any
 
 type QueryResult struct {
 	Data       [][]byte
+	Versions   []int64 // version of each thing in Data, not set for values
 	Count      int
 	Limit      int
 	Offset     int
@@ -60,6 +65,35 @@ func WithRefDevice(refDevice string) ConditionFunc {
 	}
 }
 
+// WithRefParent queries the things that are parts of a thing, i.e. the things with refParent
+func WithRefParent(refParent string) ConditionFunc {
+	return func(m map[string]any) map[string]any {
+		m["refparent"] = refParent
+		return m
+	}
+}
+
+// WithHasPart queries the thing that a thing is a part of
+func WithHasPart(hasPart string) ConditionFunc {
+	return func(m map[string]any) map[string]any {
+		m["haspart"] = hasPart
+		return m
+	}
+}
+
+// WithRelation queries things with a named relation, to relatedTo if it is not empty
+func WithRelation(relation, relatedTo string) ConditionFunc {
+	return func(m map[string]any) map[string]any {
+		if relation != "" {
+			m["relation"] = relation
+		}
+		if relatedTo != "" {
+			m["relatedto"] = relatedTo
+		}
+		return m
+	}
+}
+
 func WithOffset(offset int) ConditionFunc {
 	return func(m map[string]any) map[string]any {
 		m["offset"] = offset
@@ -126,6 +160,31 @@ func WithEndTimeAt(endTimeAt string) ConditionFunc {
 	}
 }
 
+// WithDeleted queries deleted things instead of things that are not deleted
+func WithDeleted(deleted bool) ConditionFunc {
+	return func(m map[string]any) map[string]any {
+		if deleted {
+			m["deleted"] = true
+		}
+		return m
+	}
+}
+
+// WithAsOf queries things as they were at the given time, asOf must be RFC3339
+func WithAsOf(asOf string) ConditionFunc {
+	ts, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["asof"] = ts
+		return m
+	}
+}
+
 func WithOperator(operator string) ConditionFunc {
 	return func(m map[string]any) map[string]any {
 		operator = strings.ToLower(operator)
@@ -171,10 +230,90 @@ func WithValueName(n string) ConditionFunc {
 	}
 }
 
+// WithTimeUnit groups values into buckets of hour, day, week, month or n units, e.g. 15m, 6h, 2d or 1w
 func WithTimeUnit(timeUnit string) ConditionFunc {
 	return func(m map[string]any) map[string]any {
-		if slices.Contains([]string{"hour", "day"}, timeUnit) {
-			m["timeunit"] = timeUnit
+		if interval, ok := bucketInterval(timeUnit); ok {
+			m["timeunit"] = interval
+		}
+		return m
+	}
+}
+
+var bucketUnits = map[string]string{
+	"s": "seconds",
+	"m": "minutes",
+	"h": "hours",
+	"d": "days",
+	"w": "weeks",
+}
+
+// bucketInterval converts a time unit to a postgres interval, i.e. 15m to 15 minutes and day to 1 day
+func bucketInterval(timeUnit string) (string, bool) {
+	timeUnit = strings.ToLower(strings.TrimSpace(timeUnit))
+
+	if slices.Contains([]string{"minute", "hour", "day", "week", "month", "year"}, timeUnit) {
+		return "1 " + timeUnit, true
+	}
+
+	if len(timeUnit) < 2 {
+		return "", false
+	}
+
+	unit, ok := bucketUnits[timeUnit[len(timeUnit)-1:]]
+	if !ok {
+		return "", false
+	}
+
+	n, err := strconv.Atoi(timeUnit[:len(timeUnit)-1])
+	if err != nil || n < 1 {
+		return "", false
+	}
+
+	return fmt.Sprintf("%d %s", n, unit), true
+}
+
+// WithAggregates calculates avg, min, max, sum, first, last and/or delta of values per time bucket
+func WithAggregates(aggr []string) ConditionFunc {
+	aggregates := []string{}
+	for _, a := range aggr {
+		for _, s := range strings.Split(a, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if slices.Contains([]string{"avg", "min", "max", "sum", "first", "last", "delta"}, s) && !slices.Contains(aggregates, s) {
+				aggregates = append(aggregates, s)
+			}
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		if len(aggregates) > 0 {
+			m["aggr"] = aggregates
+		}
+		return m
+	}
+}
+
+// WithTimeZone sets the time zone, e.g. Europe/Stockholm, used to align time buckets
+func WithTimeZone(timeZone string) ConditionFunc {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["timezone"] = loc.String()
+		return m
+	}
+}
+
+// WithGroupBy groups aggregated values per value id (default) or per ref
+func WithGroupBy(groupBy string) ConditionFunc {
+	return func(m map[string]any) map[string]any {
+		groupBy = strings.ToLower(groupBy)
+		if slices.Contains([]string{"id", "ref"}, groupBy) {
+			m["groupby"] = groupBy
 		}
 		return m
 	}
@@ -195,9 +334,170 @@ func WithShowLatest(showLatest bool) ConditionFunc {
 	}
 }
 
-func WithParams(query map[string][]string) []ConditionFunc {
-	conditions := make([]ConditionFunc, 0)
+// WithBBox filters things located within a bounding box given as minLon,minLat,maxLon,maxLat
+func WithBBox(bbox string) ConditionFunc {
+	f, err := parseBBox(bbox)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["bbox"] = f
+		return m
+	}
+}
+
+// WithNear orders things by distance from a point given as lat,lon
+func WithNear(near string) ConditionFunc {
+	f, err := parseNear(near)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["near"] = f
+		return m
+	}
+}
 
+// WithMaxDistance limits a near query to things within maxDistance metres
+func WithMaxDistance(maxDistance string) ConditionFunc {
+	d, err := parseMaxDistance(maxDistance)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["maxdistance"] = d
+		return m
+	}
+}
+
+// WithinPolygon filters things located within a GeoJSON polygon, i.e. {"type":"Polygon","coordinates":[[[lon,lat],...]]}
+func WithinPolygon(geometry string) ConditionFunc {
+	ring, err := parsePolygon(geometry)
+	if err != nil {
+		return func(m map[string]any) map[string]any {
+			return m
+		}
+	}
+
+	return func(m map[string]any) map[string]any {
+		m["within"] = ring
+		return m
+	}
+}
+
+func parseBBox(bbox string) ([]float64, error) {
+	f, ok := parseFloats(bbox, 4)
+	if !ok || f[0] > f[2] || f[1] > f[3] {
+		return nil, fmt.Errorf("%w, bbox must be minLon,minLat,maxLon,maxLat", ErrInvalidGeometry)
+	}
+	return f, nil
+}
+
+func parseNear(near string) ([]float64, error) {
+	f, ok := parseFloats(near, 2)
+	if !ok {
+		return nil, fmt.Errorf("%w, near must be lat,lon", ErrInvalidGeometry)
+	}
+	return f, nil
+}
+
+func parseMaxDistance(maxDistance string) (float64, error) {
+	d, err := strconv.ParseFloat(maxDistance, 64)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w, maxDistance must be a positive number of metres", ErrInvalidGeometry)
+	}
+	return d, nil
+}
+
+// parsePolygon returns the exterior ring of a GeoJSON polygon, holes are ignored
+func parsePolygon(geometry string) ([][]float64, error) {
+	polygon := struct {
+		Type        string        `json:"type"`
+		Coordinates [][][]float64 `json:"coordinates"`
+	}{}
+
+	err := json.Unmarshal([]byte(geometry), &polygon)
+	if err != nil || polygon.Type != "Polygon" || len(polygon.Coordinates) == 0 || len(polygon.Coordinates[0]) < 3 {
+		return nil, fmt.Errorf("%w, geometry must be a GeoJSON polygon", ErrInvalidGeometry)
+	}
+
+	ring := polygon.Coordinates[0]
+	for _, p := range ring {
+		if len(p) < 2 {
+			return nil, fmt.Errorf("%w, geometry must be a GeoJSON polygon", ErrInvalidGeometry)
+		}
+	}
+
+	return ring, nil
+}
+
+// validateGeometry returns ErrInvalidGeometry if a geo-query parameter can not be parsed, since dropping
+// the condition would widen the query
+func validateGeometry(query map[string][]string) error {
+	params := normalizeParams(query)
+
+	if bbox, ok := params["bbox"]; ok {
+		if _, err := parseBBox(bbox[0]); err != nil {
+			return err
+		}
+	}
+
+	if near, ok := params["near"]; ok {
+		if _, err := parseNear(near[0]); err != nil {
+			return err
+		}
+		if maxDistance, ok := params["maxdistance"]; ok {
+			if _, err := parseMaxDistance(maxDistance[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if georel, ok := params["georel"]; ok {
+		if strings.ToLower(georel[0]) != "within" {
+			return fmt.Errorf("%w, georel must be within", ErrInvalidGeometry)
+		}
+		geometry, ok := params["geometry"]
+		if !ok {
+			return fmt.Errorf("%w, georel within requires a geometry", ErrInvalidGeometry)
+		}
+		if _, err := parsePolygon(geometry[0]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseFloats(s string, n int) ([]float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+
+	f := make([]float64, n)
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, false
+		}
+		f[i] = v
+	}
+
+	return f, true
+}
+
+// normalizeParams lower cases the keys of query and removes underscores, v is an alias for value
+func normalizeParams(query map[string][]string) map[string][]string {
 	params := map[string][]string{}
 	for k, v := range query {
 		key := strings.ReplaceAll(strings.ToLower(k), "_", "")
@@ -206,6 +506,13 @@ func WithParams(query map[string][]string) []ConditionFunc {
 		}
 		params[key] = v
 	}
+	return params
+}
+
+func WithParams(query map[string][]string) []ConditionFunc {
+	conditions := make([]ConditionFunc, 0)
+
+	params := normalizeParams(query)
 
 	for key, values := range params {
 		switch key {
@@ -221,6 +528,20 @@ func WithParams(query map[string][]string) []ConditionFunc {
 			conditions = append(conditions, WithTags(values))
 		case "refdevice":
 			conditions = append(conditions, WithRefDevice(values[0]))
+		case "refparent":
+			conditions = append(conditions, WithRefParent(values[0]))
+		case "haspart":
+			conditions = append(conditions, WithHasPart(values[0]))
+		case "relation":
+			relatedTo := ""
+			if r, ok := params["relatedto"]; ok {
+				relatedTo = r[0]
+			}
+			conditions = append(conditions, WithRelation(values[0], relatedTo))
+		case "relatedto":
+			if _, ok := params["relation"]; !ok {
+				conditions = append(conditions, WithRelation("", values[0]))
+			}
 		case "offset":
 			if i, err := strconv.Atoi(values[0]); err == nil {
 				conditions = append(conditions, WithOffset(i))
@@ -241,6 +562,10 @@ func WithParams(query map[string][]string) []ConditionFunc {
 			if endTimeAt, ok := params["endtimeat"]; ok {
 				conditions = append(conditions, WithEndTimeAt(endTimeAt[0]))
 			}
+		case "asof":
+			conditions = append(conditions, WithAsOf(values[0]))
+		case "deleted":
+			conditions = append(conditions, WithDeleted(values[0] == "true"))
 		case "op":
 			conditions = append(conditions, WithOperator(values[0]))
 		case "value":
@@ -254,6 +579,25 @@ func WithParams(query map[string][]string) []ConditionFunc {
 			conditions = append(conditions, WithValueName(values[0]))
 		case "timeunit":
 			conditions = append(conditions, WithTimeUnit(values[0]))
+		case "aggr":
+			conditions = append(conditions, WithAggregates(values))
+		case "timezone":
+			conditions = append(conditions, WithTimeZone(values[0]))
+		case "groupby":
+			conditions = append(conditions, WithGroupBy(values[0]))
+		case "bbox":
+			conditions = append(conditions, WithBBox(values[0]))
+		case "near":
+			conditions = append(conditions, WithNear(values[0]))
+			if maxDistance, ok := params["maxdistance"]; ok {
+				conditions = append(conditions, WithMaxDistance(maxDistance[0]))
+			}
+		case "georel":
+			if strings.ToLower(values[0]) == "within" {
+				if geometry, ok := params["geometry"]; ok {
+					conditions = append(conditions, WithinPolygon(geometry[0]))
+				}
+			}
 		case "latest":
 			if values[0] == "true" {
 				if _, ok := params["thingid"]; ok {
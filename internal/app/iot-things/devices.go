@@ -0,0 +1,108 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+type sharedDevicesContextKey struct{}
+
+// WithSharedDevice returns a copy of ctx where deviceID may be attached to more than one thing of the same type. The
+// writer returns ErrDeviceAttached if a thing is saved with a device that is attached to another thing of the same type
+// in the tenant, unless the device is shared or was already attached to the thing.
+func WithSharedDevice(ctx context.Context, deviceID string) context.Context {
+	shared := slices.Clone(SharedDevicesFromContext(ctx))
+	return context.WithValue(ctx, sharedDevicesContextKey{}, append(shared, deviceID))
+}
+
+// SharedDevicesFromContext returns the devices that may be attached to more than one thing of the same type
+func SharedDevicesFromContext(ctx context.Context) []string {
+	shared, _ := ctx.Value(sharedDevicesContextKey{}).([]string)
+	return shared
+}
+
+// AttachDevice connects a device to a thing. A device can only be attached to one thing of each type in a tenant, unless
+// allowShared is true. If version is not 0 the device is only attached if that is the current version of the thing.
+func (a *app) AttachDevice(ctx context.Context, thingID, deviceID string, allowShared bool, version int64, tenants []string) error {
+	if deviceID == "" {
+		return errors.New("device ID must be provided")
+	}
+
+	if allowShared {
+		ctx = WithSharedDevice(ctx, deviceID)
+	}
+
+	return a.updateDevices(ctx, thingID, version, tenants, func(t things.Thing) error {
+		if slices.ContainsFunc(t.Refs(), func(d things.Device) bool { return d.DeviceID == deviceID }) {
+			return nil
+		}
+
+		t.AddDevice(deviceID)
+
+		return nil
+	})
+}
+
+// DetachDevice disconnects a device from a thing. If version is not 0 the device is only detached if that is the current version of the thing.
+func (a *app) DetachDevice(ctx context.Context, thingID, deviceID string, version int64, tenants []string) error {
+	return a.updateDevices(ctx, thingID, version, tenants, func(t things.Thing) error {
+		if !t.RemoveDevice(deviceID) {
+			return ErrDeviceNotAttached
+		}
+		return nil
+	})
+}
+
+// updateDevices applies change to the connected devices of a thing and saves the thing if the devices changed. A change
+// without a version is applied again if the thing is modified before it is saved.
+func (a *app) updateDevices(ctx context.Context, thingID string, version int64, tenants []string, change func(t things.Thing) error) error {
+	if len(tenants) == 0 {
+		return ErrMissingThingTenant
+	}
+
+	return retryOnConflict(ctx, thingID, version, func() error {
+		return a.changeDevices(ctx, thingID, version, tenants, change)
+	})
+}
+
+// changeDevices changes the devices of the current version of a thing and saves it as long as that is still the current version
+func (a *app) changeDevices(ctx context.Context, thingID string, version int64, tenants []string, change func(t things.Thing) error) error {
+
+	result, err := a.reader.QueryThings(ctx, WithID(thingID), WithTenants(tenants))
+	if err != nil {
+		return err
+	}
+	if len(result.Data) != 1 {
+		return ErrThingNotFound
+	}
+
+	version, err = checkVersion(result, version)
+	if err != nil {
+		return err
+	}
+
+	current, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return err
+	}
+
+	t, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return err
+	}
+
+	err = change(t)
+	if err != nil {
+		return err
+	}
+
+	events := devicesChanged(current, t)
+	if len(events) == 0 {
+		return nil
+	}
+
+	return a.writer.UpdateThing(ctx, t, version, events...)
+}
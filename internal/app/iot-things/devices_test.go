@@ -0,0 +1,82 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/pkg/types"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/matryer/is"
+)
+
+func TestAttachAndDetachDevice(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	room1 := things.NewRoom("room-001", things.DefaultLocation, "default")
+	room2 := things.NewRoom("room-002", things.DefaultLocation, "default")
+	room2.AddDevice("device-2")
+
+	store := []things.Thing{room1, room2}
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			c := newConditions(conditions...)
+			data := [][]byte{}
+			for _, t := range store {
+				if id, ok := c["id"]; ok && id != t.ID() {
+					continue
+				}
+				if ref, ok := c["refdevice"]; ok && !slices.ContainsFunc(t.Refs(), func(d things.Device) bool { return d.DeviceID == ref }) {
+					continue
+				}
+				if types, ok := c["types"]; ok && !slices.Contains(types.([]string), t.Type()) {
+					continue
+				}
+				data = append(data, t.Byte())
+			}
+			return QueryResult{Data: data, Versions: slices.Repeat([]int64{1}, len(data))}, nil
+		},
+	}
+	// the writer checks that a device is not attached to another thing of the same type, unless it is shared
+	w := &ThingsWriterMock{
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			for _, d := range t.Refs() {
+				for _, other := range store {
+					attached := slices.ContainsFunc(other.Refs(), func(o things.Device) bool { return o.DeviceID == d.DeviceID })
+					if other.ID() != t.ID() && other.Type() == t.Type() && attached && !slices.Contains(SharedDevicesFromContext(ctx), d.DeviceID) {
+						return ErrDeviceAttached
+					}
+				}
+			}
+			return nil
+		},
+	}
+
+	a := New(ctx, r, w, msgCtxMock())
+	tenants := []string{"default"}
+
+	is.NoErr(a.AttachDevice(ctx, "room-001", "device-1", false, 0, tenants))
+	updated := w.UpdateThingCalls()[0]
+	is.Equal(updated.T.Refs()[0].DeviceID, "device-1")
+	is.Equal(updated.Events[0].(*types.ThingDevicesChanged).After, []string{"device-1"})
+
+	// device-2 is attached to another room
+	is.True(errors.Is(a.AttachDevice(ctx, "room-001", "device-2", false, 0, tenants), ErrDeviceAttached))
+	is.NoErr(a.AttachDevice(ctx, "room-001", "device-2", true, 0, tenants))
+	is.Equal(len(w.UpdateThingCalls()), 3)
+
+	// attaching a device that is already attached does not change the thing
+	is.NoErr(a.AttachDevice(ctx, "room-002", "device-2", false, 0, tenants))
+	is.Equal(len(w.UpdateThingCalls()), 3)
+
+	is.NoErr(a.DetachDevice(ctx, "room-002", "device-2", 1, tenants))
+	is.Equal(len(w.UpdateThingCalls()[3].T.Refs()), 0)
+
+	is.True(errors.Is(a.DetachDevice(ctx, "room-001", "device-3", 0, tenants), ErrDeviceNotAttached))
+	is.True(errors.Is(a.DetachDevice(ctx, "room-001", "device-1", 2, tenants), ErrVersionConflict))
+	is.True(errors.Is(a.AttachDevice(ctx, "room-003", "device-1", false, 0, tenants), ErrThingNotFound))
+}
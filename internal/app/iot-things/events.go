@@ -0,0 +1,60 @@
+package iotthings
+
+import (
+	"slices"
+	"time"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/pkg/types"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+)
+
+func newThingCreated(t things.Thing) messaging.TopicMessage {
+	return &types.ThingCreated{
+		ID:        t.ID(),
+		Type:      t.Type(),
+		Thing:     stripFields(t),
+		Tenant:    t.Tenant(),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func newThingDeleted(t things.Thing) messaging.TopicMessage {
+	return &types.ThingDeleted{
+		ID:        t.ID(),
+		Type:      t.Type(),
+		Thing:     stripFields(t),
+		Tenant:    t.Tenant(),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// devicesChanged returns a thing.devicesChanged event if the connected devices differ between current and updated
+func devicesChanged(current, updated things.Thing) []messaging.TopicMessage {
+	before := deviceIDs(current)
+	after := deviceIDs(updated)
+
+	if slices.Equal(before, after) {
+		return nil
+	}
+
+	return []messaging.TopicMessage{
+		&types.ThingDevicesChanged{
+			ID:        updated.ID(),
+			Type:      updated.Type(),
+			Tenant:    updated.Tenant(),
+			Before:    before,
+			After:     after,
+			Timestamp: time.Now().UTC(),
+		},
+	}
+}
+
+func deviceIDs(t things.Thing) []string {
+	ids := []string{}
+	for _, d := range t.Refs() {
+		ids = append(ids, d.DeviceID)
+	}
+	slices.Sort(ids)
+	return ids
+}
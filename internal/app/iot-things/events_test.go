@@ -0,0 +1,153 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/pkg/types"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/matryer/is"
+)
+
+func TestUpdateThingWithChangedDevicesAddsDevicesChangedEvent(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	current := things.NewRoom("room-001", things.DefaultLocation, "default")
+	current.AddDevice("device-01")
+
+	updated := things.NewRoom("room-001", things.DefaultLocation, "default")
+	updated.AddDevice("device-02")
+	updated.AddDevice("device-01")
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{current.Byte()}}, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+	}
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	err := a.UpdateThing(ctx, updated.Byte(), 0, []string{"default"})
+	is.NoErr(err)
+
+	events := w.UpdateThingCalls()[0].Events
+	is.Equal(len(events), 1)
+
+	e := events[0].(*types.ThingDevicesChanged)
+	is.Equal(e.TopicName(), "thing.devicesChanged")
+	is.Equal(e.Before, []string{"device-01"})
+	is.Equal(e.After, []string{"device-01", "device-02"})
+}
+
+func TestUpdateThingWithSameDevicesAddsNoEvents(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	current := things.NewRoom("room-001", things.DefaultLocation, "default")
+	current.AddDevice("device-01")
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{current.Byte()}}, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+	}
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	err := a.UpdateThing(ctx, current.Byte(), 0, []string{"default"})
+	is.NoErr(err)
+	is.Equal(len(w.UpdateThingCalls()[0].Events), 0)
+}
+
+func TestAddAndDeleteThingAddsLifecycleEvents(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	room := things.NewRoom("room-001", things.DefaultLocation, "default")
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{room.Byte()}}, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
+			return nil
+		},
+		DeleteThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+	}
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	err := a.AddThing(ctx, room.Byte(), []string{"default"})
+	is.NoErr(err)
+	is.Equal(w.AddThingCalls()[0].Events[0].TopicName(), "thing.created")
+
+	err = a.DeleteThing(ctx, room.ID(), 0, []string{"default"})
+	is.NoErr(err)
+
+	deleted := w.DeleteThingCalls()[0].Events[0].(*types.ThingDeleted)
+	is.Equal(deleted.TopicName(), "thing.deleted")
+	is.Equal(deleted.ID, "room-001")
+	is.Equal(deleted.Tenant, "default")
+}
+
+func TestRestoreAndPurgeThingAddsLifecycleEvents(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	room := things.NewRoom("room-001", things.DefaultLocation, "default")
+	deleted := true
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			_, queryDeleted := newConditions(conditions...)["deleted"]
+			if queryDeleted != deleted {
+				return QueryResult{Data: [][]byte{}}, nil
+			}
+			return QueryResult{Data: [][]byte{room.Byte()}, Versions: []int64{2}}, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		RestoreThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+		PurgeThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+			return nil
+		},
+	}
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	// a deleted thing is restored, and published, as created
+	is.NoErr(a.RestoreThing(ctx, room.ID(), 2, []string{"default"}))
+	is.Equal(w.RestoreThingCalls()[0].Version, int64(2))
+	is.Equal(w.RestoreThingCalls()[0].Events[0].TopicName(), "thing.created")
+
+	// a deleted thing is purged without events
+	is.NoErr(a.PurgeThing(ctx, room.ID(), 0, []string{"default"}))
+	is.Equal(len(w.PurgeThingCalls()[0].Events), 0)
+
+	// a thing that is not deleted can not be restored, but is deleted when purged
+	deleted = false
+	is.True(errors.Is(a.RestoreThing(ctx, room.ID(), 0, []string{"default"}), ErrThingNotFound))
+	is.True(errors.Is(a.PurgeThing(ctx, room.ID(), 1, []string{"default"}), ErrVersionConflict))
+	is.NoErr(a.PurgeThing(ctx, room.ID(), 0, []string{"default"}))
+	is.Equal(w.PurgeThingCalls()[1].Events[0].TopicName(), "thing.deleted")
+	is.Equal(len(w.PurgeThingCalls()), 2)
+}
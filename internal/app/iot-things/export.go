@@ -0,0 +1,128 @@
+package iotthings
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+// The version of a CSV file with things is given by its header row. Version 1, with a "decsription" column, has args
+// as JSON where ' is used instead of ", files without a header row are version 1. Version 2, with a "description"
+// column, has args as JSON with every configurable property of the thing that is not a column.
+var csvHeader = []string{"id", "type", "subType", "name", "description", "location", "tenant", "tags", "refDevices", "args"}
+
+// csvVersion returns the version of a CSV file with things from its header row
+func csvVersion(header []string) int {
+	if len(header) > 4 && strings.EqualFold(header[4], csvHeader[4]) {
+		return 2
+	}
+	return 1
+}
+
+// ExportCSV writes things as a version 2 CSV file, quoted according to RFC 4180, that can be seeded without loss
+func ExportCSV(w io.Writer, data [][]byte) error {
+	f := csv.NewWriter(w)
+	f.Comma = ';'
+
+	err := f.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range data {
+		record, err := csvRecord(b)
+		if err != nil {
+			return err
+		}
+
+		err = f.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Flush()
+
+	return f.Error()
+}
+
+// csvRecord returns the columns of a thing. Tags, and devices, that can not be joined by , are written to args.
+func csvRecord(b []byte) ([]string, error) {
+	t := struct {
+		ID          string          `json:"id"`
+		Type        string          `json:"type"`
+		SubType     string          `json:"subType"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Location    things.Location `json:"location"`
+		Tenant      string          `json:"tenant"`
+		Tags        []string        `json:"tags"`
+		RefDevices  []things.Device `json:"refDevices"`
+	}{}
+	err := json.Unmarshal(b, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := things.Registered(t.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w [%s]", things.ErrUnknownType, t.Type)
+	}
+
+	args := make(map[string]any)
+	for _, k := range r.Configurable() {
+		if v, ok := m[k]; ok && v != nil && !slices.Contains(csvHeader, k) {
+			args[k] = v
+		}
+	}
+
+	tags := strings.Join(t.Tags, ",")
+	if !joinable(t.Tags) {
+		tags = ""
+		args["tags"] = t.Tags
+	}
+
+	deviceIDs := make([]string, 0, len(t.RefDevices))
+	for _, d := range t.RefDevices {
+		deviceIDs = append(deviceIDs, d.DeviceID)
+	}
+
+	refDevices := strings.Join(deviceIDs, ",")
+	if !joinable(deviceIDs) {
+		refDevices = ""
+		args["refDevices"] = m["refDevices"]
+	}
+
+	location := strconv.FormatFloat(t.Location.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(t.Location.Longitude, 'f', -1, 64)
+
+	record := []string{t.ID, t.Type, t.SubType, t.Name, t.Description, location, t.Tenant, tags, refDevices, ""}
+
+	if len(args) > 0 {
+		a, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		record[9] = string(a)
+	}
+
+	return record, nil
+}
+
+// joinable returns true if values can be joined by , and split into the same values
+func joinable(values []string) bool {
+	return !slices.ContainsFunc(values, func(s string) bool {
+		return s == "" || strings.Contains(s, ",")
+	})
+}
@@ -0,0 +1,50 @@
+package iotthings
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestExportCSVCanBeSeeded(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	tt := []string{
+		`{"id":"building-001","type":"Building","tenant":"default","name":"Building","alternativeName":"Main \"building\"","location":{"latitude":62.390956137,"longitude":17.317279091},"relations":{"servedBy":["pumpingstation-001"]}}`,
+		`{"id":"room-001","type":"Room","tenant":"default","name":"Room; first floor","description":"first\nfloor","refParent":"building-001","tags":["floor 1","a,b"]}`,
+		`{"id":"container-001","type":"Container","subType":"WasteContainer","tenant":"secret","maxd":0.94,"maxl":0.79,"angle":12.5,"refDevices":[{"deviceID":"device-1"},{"deviceID":"device-2"}],"tags":["x"]}`,
+		`{"id":"beach-001","type":"PointOfInterest","subType":"Beach","tenant":"default","name":"O'Brien's beach","area":[[[17.1,62.1],[17.2,62.2]]]}`,
+	}
+
+	export := func(r *ThingsReaderMock) string {
+		result, err := r.QueryThings(ctx)
+		is.NoErr(err)
+
+		var buf bytes.Buffer
+		is.NoErr(ExportCSV(&buf, result.Data))
+
+		return buf.String()
+	}
+
+	r, w, _ := partsMocks(tt...)
+	exported := export(r)
+
+	is.True(strings.HasPrefix(exported, "id;type;subType;name;description;location;tenant;tags;refDevices;args\n"))
+	is.True(strings.Contains(exported, `;62.390956137,17.317279091;`))
+	is.True(strings.Contains(exported, `"{""alternativeName"":""Main \""building\"""",""relations"":{""servedBy"":[""pumpingstation-001""]}}"`))
+
+	// seeding an export of things does not change them
+	report, err := New(ctx, r, w, msgCtxMock()).Seed(ctx, strings.NewReader(exported), SeedCSV, true, nil)
+	is.NoErr(err)
+	is.Equal(report.Count(SeedUnchanged), len(tt))
+
+	// an export of seeded things is identical to the seeded export
+	r2, w2, _ := partsMocks()
+	_, err = New(ctx, r2, w2, msgCtxMock()).Seed(ctx, strings.NewReader(exported), SeedCSV, false, nil)
+	is.NoErr(err)
+	is.Equal(export(r2), exported)
+}
@@ -20,6 +20,7 @@ type LevelConfig struct {
 	MeanLevel   *float64 `json:"meanl,omitempty"`
 	Offset      *float64 `json:"offset,omitempty"`
 	Angle       *float64 `json:"angle,omitempty"`
+	Tank        *Tank    `json:"tank,omitempty"`
 }
 
 type level struct {
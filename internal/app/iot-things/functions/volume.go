@@ -0,0 +1,138 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Shapes of tanks that the volume can be calculated for
+const (
+	VerticalCylinder   string = "verticalCylinder"
+	HorizontalCylinder string = "horizontalCylinder"
+	Cuboid             string = "cuboid"
+	Cone               string = "cone"
+)
+
+// Tank describes the geometry of a tank, dimensions are in m. A cone stands on its tip, i.e. Diameter is the
+// diameter at Height. If Table is set it is used instead of the shape.
+type Tank struct {
+	Shape    string        `json:"shape,omitempty"`
+	Diameter *float64      `json:"diameter,omitempty"`
+	Length   *float64      `json:"length,omitempty"`
+	Width    *float64      `json:"width,omitempty"`
+	Height   *float64      `json:"height,omitempty"`
+	Table    []VolumePoint `json:"table,omitempty"`
+}
+
+// VolumePoint is the volume, in litres, of a tank at a level, in m
+type VolumePoint struct {
+	Level  float64 `json:"level"`
+	Volume float64 `json:"volume"`
+}
+
+// Volume returns the volume, in litres, of the content of a tank at level. Levels outside the tank are limited to the
+// bottom, or the top, of the tank.
+func Volume(t Tank, level float64) (float64, error) {
+	level = math.Max(level, 0)
+
+	if len(t.Table) > 0 {
+		return interpolate(t.Table, level), nil
+	}
+
+	dimension := func(name string, v *float64) (float64, error) {
+		if v == nil || *v <= 0 {
+			return 0, fmt.Errorf("%s of %s tank must be greater than 0", name, t.Shape)
+		}
+		return *v, nil
+	}
+
+	var m3 float64
+
+	switch t.Shape {
+	case VerticalCylinder:
+		d, err := dimension("diameter", t.Diameter)
+		if err != nil {
+			return 0, err
+		}
+		if t.Height != nil {
+			level = math.Min(level, *t.Height)
+		}
+		m3 = math.Pi * d * d / 4 * level
+	case HorizontalCylinder:
+		d, err := dimension("diameter", t.Diameter)
+		if err != nil {
+			return 0, err
+		}
+		l, err := dimension("length", t.Length)
+		if err != nil {
+			return 0, err
+		}
+		r := d / 2
+		h := math.Min(level, d)
+		// the area of the circular segment below the level
+		m3 = l * (r*r*math.Acos((r-h)/r) - (r-h)*math.Sqrt(2*r*h-h*h))
+	case Cuboid:
+		l, err := dimension("length", t.Length)
+		if err != nil {
+			return 0, err
+		}
+		w, err := dimension("width", t.Width)
+		if err != nil {
+			return 0, err
+		}
+		if t.Height != nil {
+			level = math.Min(level, *t.Height)
+		}
+		m3 = l * w * level
+	case Cone:
+		d, err := dimension("diameter", t.Diameter)
+		if err != nil {
+			return 0, err
+		}
+		height, err := dimension("height", t.Height)
+		if err != nil {
+			return 0, err
+		}
+		h := math.Min(level, height)
+		r := d / 2 * h / height
+		m3 = math.Pi * r * r * h / 3
+	case "":
+		return 0, errors.New("tank must have a shape or a table")
+	default:
+		return 0, fmt.Errorf("unknown tank shape %s", t.Shape)
+	}
+
+	return math.Round(m3*1000*100) / 100, nil
+}
+
+// interpolate returns the volume at level by linear interpolation between the points of a table
+func interpolate(table []VolumePoint, level float64) float64 {
+	points := slices.Clone(table)
+	slices.SortFunc(points, func(a, b VolumePoint) int {
+		switch {
+		case a.Level < b.Level:
+			return -1
+		case a.Level > b.Level:
+			return 1
+		}
+		return 0
+	})
+
+	if level <= points[0].Level {
+		return points[0].Volume
+	}
+
+	for i := 1; i < len(points); i++ {
+		p0, p1 := points[i-1], points[i]
+		if level <= p1.Level {
+			if p1.Level == p0.Level {
+				return p1.Volume
+			}
+			return p0.Volume + (p1.Volume-p0.Volume)*(level-p0.Level)/(p1.Level-p0.Level)
+		}
+	}
+
+	return points[len(points)-1].Volume
+}
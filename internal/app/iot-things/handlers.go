@@ -66,20 +66,6 @@ func NewMeasurementsHandler(app ThingsApp, msgCtx messaging.MsgContext) messagin
 	}
 }
 
-func unique(arr []string) []string {
-	unique := make(map[string]struct{})
-	for _, s := range arr {
-		unique[s] = struct{}{}
-	}
-
-	result := make([]string, 0, len(unique))
-	for s := range unique {
-		result = append(result, s)
-	}
-
-	return result
-}
-
 func stripFields(t things.Thing) map[string]any {
 	m := make(map[string]any)
 	b, err := json.Marshal(t)
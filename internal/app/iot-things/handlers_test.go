@@ -29,6 +29,38 @@ func TestRoomTemperature(t *testing.T) {
 	is.Equal(s[r.ID()].(*things.Room).Temperature, 21.0)
 }
 
+func TestBeachOutsideBathingSeasonIsNotSaved(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(
+		`{"id":"beach-001","type":"PointOfInterest","subType":"Beach","tenant":"default","bathingSeason":{"start":"06-01","end":"08-31","timeZone":"Europe/Stockholm"},"refDevices":[{"deviceID":"device-1"}]}`,
+	)
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	temperature := 12.0
+	a.HandleMeasurements(ctx, []things.Measurement{{
+		ID:        "device-1/3303/5700",
+		Urn:       things.TemperatureURN,
+		Value:     &temperature,
+		Timestamp: time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC),
+	}})
+
+	is.Equal(len(w.AddValueCalls()), 1)
+	is.Equal(len(w.UpdateThingCalls()), 0) // no outbox entry, i.e. thing.updated is not published
+
+	a.HandleMeasurements(ctx, []things.Measurement{{
+		ID:        "device-1/3303/5700",
+		Urn:       things.TemperatureURN,
+		Value:     &temperature,
+		Timestamp: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}})
+
+	is.Equal(len(w.AddValueCalls()), 2)
+	is.Equal(len(w.UpdateThingCalls()), 1)
+}
+
 func TestContainerDistance(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -152,7 +184,7 @@ func appMock(ctx context.Context, t things.Thing, store map[string]things.Thing,
 			}
 			return nil
 		},
-		UpdateThingFunc: func(ctx context.Context, u things.Thing) error {
+		UpdateThingFunc: func(ctx context.Context, u things.Thing, version int64, events ...messaging.TopicMessage) error {
 			if store != nil {
 				store[u.ID()] = u
 			}
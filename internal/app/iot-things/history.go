@@ -0,0 +1,52 @@
+package iotthings
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Sources of a change to a thing, recorded in the history of the thing
+const (
+	SourceAPI         = "api"
+	SourceSeed        = "seed"
+	SourceMeasurement = "measurement"
+)
+
+// HistoryEntry is a version of a thing. Diff is a JSON Merge Patch (RFC 7396) from the previous version.
+type HistoryEntry struct {
+	ThingID   string          `json:"thingID"`
+	Version   int64           `json:"version"`
+	ChangedOn time.Time       `json:"changedOn"`
+	Source    string          `json:"source"`
+	Actor     string          `json:"actor,omitempty"`
+	Deleted   bool            `json:"deleted"`
+	Diff      json.RawMessage `json:"diff"`
+}
+
+type sourceContextKey struct{}
+
+// WithSource returns a copy of ctx with the source of changes made using ctx
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
+
+// SourceFromContext returns the source of changes made using ctx, SourceAPI if no source is set
+func SourceFromContext(ctx context.Context) string {
+	source, ok := ctx.Value(sourceContextKey{}).(string)
+	if !ok || source == "" {
+		return SourceAPI
+	}
+	return source
+}
+
+func (a *app) QueryHistory(ctx context.Context, thingID string, params map[string][]string, tenants []string) (QueryResult, error) {
+	allowed := allowedTenants(params, tenants)
+	if len(allowed) == 0 {
+		return QueryResult{Data: [][]byte{}}, nil
+	}
+
+	conditions := append(WithParams(params), WithID(thingID), WithTenants(allowed))
+
+	return a.reader.QueryHistory(ctx, conditions...)
+}
@@ -0,0 +1,41 @@
+package iotthings
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSourceFromContext(t *testing.T) {
+	is := is.New(t)
+
+	ctx := context.Background()
+	is.Equal(SourceFromContext(ctx), SourceAPI)
+	is.Equal(SourceFromContext(WithSource(ctx, SourceSeed)), SourceSeed)
+}
+
+func TestQueryHistoryIsScopedToAllowedTenants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	r := &ThingsReaderMock{
+		QueryHistoryFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{}}, nil
+		},
+	}
+	a := New(ctx, r, &ThingsWriterMock{}, msgCtxMock())
+
+	_, err := a.QueryHistory(ctx, "room-001", map[string][]string{"tenant": {"secret"}}, []string{"default"})
+	is.NoErr(err)
+	is.Equal(len(r.QueryHistoryCalls()), 0)
+
+	_, err = a.QueryHistory(ctx, "room-001", map[string][]string{"limit": {"10"}}, []string{"default"})
+	is.NoErr(err)
+
+	c := newConditions(r.QueryHistoryCalls()[0].Conditions...)
+	is.Equal(c["id"], "room-001")
+	is.Equal(c["tenants"], []string{"default"})
+	is.Equal(c["limit"], 10)
+}
@@ -0,0 +1,202 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/pkg/types"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// ThingsOutbox stores the events to be published. GetPendingOutboxEntries claims the entries it returns for a
+// while, so that relays in other replicas do not publish them too. An entry is not returned while an earlier entry
+// of the same thing is claimed or waiting for its next attempt, so that the events of a thing are published in order.
+//
+//go:generate moq -rm -out outbox_mock.go . ThingsOutbox
+type ThingsOutbox interface {
+	GetPendingOutboxEntries(ctx context.Context, createdBefore time.Time, limit int) ([]OutboxEntry, error)
+	MarkOutboxEntryDelivered(ctx context.Context, e OutboxEntry) error
+	MarkOutboxEntryFailed(ctx context.Context, e OutboxEntry, nextAttempt time.Time) error
+	DeleteDeliveredOutboxEntries(ctx context.Context, deliveredBefore time.Time) error
+}
+
+// OutboxEntry is either all undelivered thing.updated changes of a thing, up to and including ID,
+// or a single event, e.g. thing.created, with a body to be published as is.
+type OutboxEntry struct {
+	ID          int64
+	ThingID     string
+	Topic       string
+	ContentType string
+	Body        []byte
+	Attempts    int
+}
+
+// outboxMessage publishes the stored body of an outbox entry as is
+type outboxMessage struct {
+	topic       string
+	contentType string
+	body        []byte
+}
+
+func (m outboxMessage) Body() []byte {
+	return m.body
+}
+
+func (m outboxMessage) ContentType() string {
+	return m.contentType
+}
+
+func (m outboxMessage) TopicName() string {
+	return m.topic
+}
+
+const (
+	outboxDebounce      time.Duration = 2 * time.Second
+	outboxPollInterval  time.Duration = 1 * time.Second
+	outboxBatchSize     int           = 100
+	outboxMaxBackoff    time.Duration = 5 * time.Minute
+	outboxRetention     time.Duration = 24 * time.Hour
+	outboxPurgeInterval time.Duration = 1 * time.Hour
+	outboxMaxAttempts   int           = 5
+)
+
+// errNotPublishable is returned for outbox entries that will fail however many times they are attempted, e.g. the
+// thing is of a type that is no longer registered. Such entries are dropped after outboxMaxAttempts attempts so that
+// they do not block later events of the thing.
+var errNotPublishable = errors.New("outbox entry can not be published")
+
+// relay publishes thing.updated for every thing with undelivered changes, and stored events such as thing.created,
+// in the outbox. Changes are debounced so that several changes within a short period of time result in a single event. Entries are marked as delivered once
+// published, i.e. entries left undelivered by a restart are published when the relay starts again.
+func relay(ctx context.Context, r ThingsReader, o ThingsOutbox, msgCtx messaging.MsgContext) {
+	log := logging.GetFromContext(ctx)
+
+	n := publishPending(ctx, r, o, msgCtx, time.Now())
+	if n > 0 {
+		log.Info("recovered undelivered outbox entries", slog.Int("count", n))
+	}
+
+	poll := time.NewTicker(outboxPollInterval)
+	defer poll.Stop()
+
+	purge := time.NewTicker(outboxPurgeInterval)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ts := <-poll.C:
+			publishPending(ctx, r, o, msgCtx, ts.Add(-outboxDebounce))
+		case ts := <-purge.C:
+			err := o.DeleteDeliveredOutboxEntries(ctx, ts.Add(-outboxRetention))
+			if err != nil {
+				log.Error("could not delete delivered outbox entries", "err", err.Error())
+			}
+		}
+	}
+}
+
+func publishPending(ctx context.Context, r ThingsReader, o ThingsOutbox, msgCtx messaging.MsgContext, createdBefore time.Time) int {
+	log := logging.GetFromContext(ctx)
+
+	entries, err := o.GetPendingOutboxEntries(ctx, createdBefore, outboxBatchSize)
+	if err != nil {
+		log.Error("could not get pending outbox entries", "err", err.Error())
+		return 0
+	}
+
+	// later entries of a thing are not published if an earlier entry failed, they are claimed again after its next attempt
+	failed := map[string]bool{}
+
+	for _, e := range entries {
+		if failed[e.ThingID] {
+			continue
+		}
+
+		err := publishEntry(ctx, r, msgCtx, e)
+		if errors.Is(err, errNotPublishable) && e.Attempts+1 >= outboxMaxAttempts {
+			log.Error("dropping outbox entry that can not be published", "topic", e.Topic, "thingID", e.ThingID, slog.Int("attempts", e.Attempts+1), "err", err.Error())
+
+			err = o.MarkOutboxEntryDelivered(ctx, e)
+			if err != nil {
+				log.Error("could not mark outbox entry as delivered", "thingID", e.ThingID, "err", err.Error())
+			}
+
+			continue
+		}
+		if err != nil {
+			log.Error("could not publish outbox entry", "topic", e.Topic, "thingID", e.ThingID, slog.Int("attempts", e.Attempts+1), "err", err.Error())
+
+			failed[e.ThingID] = true
+
+			err = o.MarkOutboxEntryFailed(ctx, e, time.Now().Add(backoff(e.Attempts)))
+			if err != nil {
+				log.Error("could not mark outbox entry as failed", "thingID", e.ThingID, "err", err.Error())
+			}
+
+			continue
+		}
+
+		err = o.MarkOutboxEntryDelivered(ctx, e)
+		if err != nil {
+			log.Error("could not mark outbox entry as delivered", "thingID", e.ThingID, "err", err.Error())
+		}
+	}
+
+	return len(entries)
+}
+
+func publishEntry(ctx context.Context, r ThingsReader, msgCtx messaging.MsgContext, e OutboxEntry) error {
+	if e.Body == nil {
+		return publishThingUpdated(ctx, r, msgCtx, e.ThingID)
+	}
+
+	return msgCtx.PublishOnTopic(ctx, outboxMessage{
+		topic:       e.Topic,
+		contentType: e.ContentType,
+		body:        e.Body,
+	})
+}
+
+func publishThingUpdated(ctx context.Context, r ThingsReader, msgCtx messaging.MsgContext, thingID string) error {
+	log := logging.GetFromContext(ctx)
+
+	result, err := r.QueryThings(ctx, WithID(thingID))
+	if err != nil {
+		return err
+	}
+
+	// the thing has been deleted since it was changed, there is nothing to publish
+	if len(result.Data) != 1 {
+		log.Debug("thing not found", "thingID", thingID, slog.Int("count", len(result.Data)))
+		return nil
+	}
+
+	t, err := things.ConvToThing(result.Data[0])
+	if err != nil {
+		return fmt.Errorf("%w, %s", errNotPublishable, err.Error())
+	}
+
+	msg := &types.ThingUpdated{
+		ID:        t.ID(),
+		Type:      t.Type(),
+		Thing:     stripFields(t),
+		Tenant:    t.Tenant(),
+		Timestamp: time.Now().UTC(),
+	}
+
+	return msgCtx.PublishOnTopic(ctx, msg)
+}
+
+// backoff returns the time to wait before the next attempt, 1s, 2s, 4s ... up to outboxMaxBackoff
+func backoff(attempts int) time.Duration {
+	d := time.Duration(math.Pow(2, float64(min(attempts, 16)))) * time.Second
+	return min(d, outboxMaxBackoff)
+}
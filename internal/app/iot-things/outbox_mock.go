@@ -0,0 +1,244 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package iotthings
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Ensure, that ThingsOutboxMock does implement ThingsOutbox.
+// If this is not the case, regenerate this file with moq.
+var _ ThingsOutbox = &ThingsOutboxMock{}
+
+// ThingsOutboxMock is a mock implementation of ThingsOutbox.
+//
+//	func TestSomethingThatUsesThingsOutbox(t *testing.T) {
+//
+//		// make and configure a mocked ThingsOutbox
+//		mockedThingsOutbox := &ThingsOutboxMock{
+//			DeleteDeliveredOutboxEntriesFunc: func(ctx context.Context, deliveredBefore time.Time) error {
+//				panic("mock out the DeleteDeliveredOutboxEntries method")
+//			},
+//			GetPendingOutboxEntriesFunc: func(ctx context.Context, createdBefore time.Time, limit int) ([]OutboxEntry, error) {
+//				panic("mock out the GetPendingOutboxEntries method")
+//			},
+//			MarkOutboxEntryDeliveredFunc: func(ctx context.Context, e OutboxEntry) error {
+//				panic("mock out the MarkOutboxEntryDelivered method")
+//			},
+//			MarkOutboxEntryFailedFunc: func(ctx context.Context, e OutboxEntry, nextAttempt time.Time) error {
+//				panic("mock out the MarkOutboxEntryFailed method")
+//			},
+//		}
+//
+//		// use mockedThingsOutbox in code that requires ThingsOutbox
+//		// and then make assertions.
+//
+//	}
+type ThingsOutboxMock struct {
+	// DeleteDeliveredOutboxEntriesFunc mocks the DeleteDeliveredOutboxEntries method.
+	DeleteDeliveredOutboxEntriesFunc func(ctx context.Context, deliveredBefore time.Time) error
+
+	// GetPendingOutboxEntriesFunc mocks the GetPendingOutboxEntries method.
+	GetPendingOutboxEntriesFunc func(ctx context.Context, createdBefore time.Time, limit int) ([]OutboxEntry, error)
+
+	// MarkOutboxEntryDeliveredFunc mocks the MarkOutboxEntryDelivered method.
+	MarkOutboxEntryDeliveredFunc func(ctx context.Context, e OutboxEntry) error
+
+	// MarkOutboxEntryFailedFunc mocks the MarkOutboxEntryFailed method.
+	MarkOutboxEntryFailedFunc func(ctx context.Context, e OutboxEntry, nextAttempt time.Time) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// DeleteDeliveredOutboxEntries holds details about calls to the DeleteDeliveredOutboxEntries method.
+		DeleteDeliveredOutboxEntries []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DeliveredBefore is the deliveredBefore argument value.
+			DeliveredBefore time.Time
+		}
+		// GetPendingOutboxEntries holds details about calls to the GetPendingOutboxEntries method.
+		GetPendingOutboxEntries []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// CreatedBefore is the createdBefore argument value.
+			CreatedBefore time.Time
+			// Limit is the limit argument value.
+			Limit int
+		}
+		// MarkOutboxEntryDelivered holds details about calls to the MarkOutboxEntryDelivered method.
+		MarkOutboxEntryDelivered []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// E is the e argument value.
+			E OutboxEntry
+		}
+		// MarkOutboxEntryFailed holds details about calls to the MarkOutboxEntryFailed method.
+		MarkOutboxEntryFailed []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// E is the e argument value.
+			E OutboxEntry
+			// NextAttempt is the nextAttempt argument value.
+			NextAttempt time.Time
+		}
+	}
+	lockDeleteDeliveredOutboxEntries sync.RWMutex
+	lockGetPendingOutboxEntries      sync.RWMutex
+	lockMarkOutboxEntryDelivered     sync.RWMutex
+	lockMarkOutboxEntryFailed        sync.RWMutex
+}
+
+// DeleteDeliveredOutboxEntries calls DeleteDeliveredOutboxEntriesFunc.
+func (mock *ThingsOutboxMock) DeleteDeliveredOutboxEntries(ctx context.Context, deliveredBefore time.Time) error {
+	if mock.DeleteDeliveredOutboxEntriesFunc == nil {
+		panic("ThingsOutboxMock.DeleteDeliveredOutboxEntriesFunc: method is nil but ThingsOutbox.DeleteDeliveredOutboxEntries was just called")
+	}
+	callInfo := struct {
+		Ctx             context.Context
+		DeliveredBefore time.Time
+	}{
+		Ctx:             ctx,
+		DeliveredBefore: deliveredBefore,
+	}
+	mock.lockDeleteDeliveredOutboxEntries.Lock()
+	mock.calls.DeleteDeliveredOutboxEntries = append(mock.calls.DeleteDeliveredOutboxEntries, callInfo)
+	mock.lockDeleteDeliveredOutboxEntries.Unlock()
+	return mock.DeleteDeliveredOutboxEntriesFunc(ctx, deliveredBefore)
+}
+
+// DeleteDeliveredOutboxEntriesCalls gets all the calls that were made to DeleteDeliveredOutboxEntries.
+// Check the length with:
+//
+//	len(mockedThingsOutbox.DeleteDeliveredOutboxEntriesCalls())
+func (mock *ThingsOutboxMock) DeleteDeliveredOutboxEntriesCalls() []struct {
+	Ctx             context.Context
+	DeliveredBefore time.Time
+} {
+	var calls []struct {
+		Ctx             context.Context
+		DeliveredBefore time.Time
+	}
+	mock.lockDeleteDeliveredOutboxEntries.RLock()
+	calls = mock.calls.DeleteDeliveredOutboxEntries
+	mock.lockDeleteDeliveredOutboxEntries.RUnlock()
+	return calls
+}
+
+// GetPendingOutboxEntries calls GetPendingOutboxEntriesFunc.
+func (mock *ThingsOutboxMock) GetPendingOutboxEntries(ctx context.Context, createdBefore time.Time, limit int) ([]OutboxEntry, error) {
+	if mock.GetPendingOutboxEntriesFunc == nil {
+		panic("ThingsOutboxMock.GetPendingOutboxEntriesFunc: method is nil but ThingsOutbox.GetPendingOutboxEntries was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		CreatedBefore time.Time
+		Limit         int
+	}{
+		Ctx:           ctx,
+		CreatedBefore: createdBefore,
+		Limit:         limit,
+	}
+	mock.lockGetPendingOutboxEntries.Lock()
+	mock.calls.GetPendingOutboxEntries = append(mock.calls.GetPendingOutboxEntries, callInfo)
+	mock.lockGetPendingOutboxEntries.Unlock()
+	return mock.GetPendingOutboxEntriesFunc(ctx, createdBefore, limit)
+}
+
+// GetPendingOutboxEntriesCalls gets all the calls that were made to GetPendingOutboxEntries.
+// Check the length with:
+//
+//	len(mockedThingsOutbox.GetPendingOutboxEntriesCalls())
+func (mock *ThingsOutboxMock) GetPendingOutboxEntriesCalls() []struct {
+	Ctx           context.Context
+	CreatedBefore time.Time
+	Limit         int
+} {
+	var calls []struct {
+		Ctx           context.Context
+		CreatedBefore time.Time
+		Limit         int
+	}
+	mock.lockGetPendingOutboxEntries.RLock()
+	calls = mock.calls.GetPendingOutboxEntries
+	mock.lockGetPendingOutboxEntries.RUnlock()
+	return calls
+}
+
+// MarkOutboxEntryDelivered calls MarkOutboxEntryDeliveredFunc.
+func (mock *ThingsOutboxMock) MarkOutboxEntryDelivered(ctx context.Context, e OutboxEntry) error {
+	if mock.MarkOutboxEntryDeliveredFunc == nil {
+		panic("ThingsOutboxMock.MarkOutboxEntryDeliveredFunc: method is nil but ThingsOutbox.MarkOutboxEntryDelivered was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		E   OutboxEntry
+	}{
+		Ctx: ctx,
+		E:   e,
+	}
+	mock.lockMarkOutboxEntryDelivered.Lock()
+	mock.calls.MarkOutboxEntryDelivered = append(mock.calls.MarkOutboxEntryDelivered, callInfo)
+	mock.lockMarkOutboxEntryDelivered.Unlock()
+	return mock.MarkOutboxEntryDeliveredFunc(ctx, e)
+}
+
+// MarkOutboxEntryDeliveredCalls gets all the calls that were made to MarkOutboxEntryDelivered.
+// Check the length with:
+//
+//	len(mockedThingsOutbox.MarkOutboxEntryDeliveredCalls())
+func (mock *ThingsOutboxMock) MarkOutboxEntryDeliveredCalls() []struct {
+	Ctx context.Context
+	E   OutboxEntry
+} {
+	var calls []struct {
+		Ctx context.Context
+		E   OutboxEntry
+	}
+	mock.lockMarkOutboxEntryDelivered.RLock()
+	calls = mock.calls.MarkOutboxEntryDelivered
+	mock.lockMarkOutboxEntryDelivered.RUnlock()
+	return calls
+}
+
+// MarkOutboxEntryFailed calls MarkOutboxEntryFailedFunc.
+func (mock *ThingsOutboxMock) MarkOutboxEntryFailed(ctx context.Context, e OutboxEntry, nextAttempt time.Time) error {
+	if mock.MarkOutboxEntryFailedFunc == nil {
+		panic("ThingsOutboxMock.MarkOutboxEntryFailedFunc: method is nil but ThingsOutbox.MarkOutboxEntryFailed was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		E           OutboxEntry
+		NextAttempt time.Time
+	}{
+		Ctx:         ctx,
+		E:           e,
+		NextAttempt: nextAttempt,
+	}
+	mock.lockMarkOutboxEntryFailed.Lock()
+	mock.calls.MarkOutboxEntryFailed = append(mock.calls.MarkOutboxEntryFailed, callInfo)
+	mock.lockMarkOutboxEntryFailed.Unlock()
+	return mock.MarkOutboxEntryFailedFunc(ctx, e, nextAttempt)
+}
+
+// MarkOutboxEntryFailedCalls gets all the calls that were made to MarkOutboxEntryFailed.
+// Check the length with:
+//
+//	len(mockedThingsOutbox.MarkOutboxEntryFailedCalls())
+func (mock *ThingsOutboxMock) MarkOutboxEntryFailedCalls() []struct {
+	Ctx         context.Context
+	E           OutboxEntry
+	NextAttempt time.Time
+} {
+	var calls []struct {
+		Ctx         context.Context
+		E           OutboxEntry
+		NextAttempt time.Time
+	}
+	mock.lockMarkOutboxEntryFailed.RLock()
+	calls = mock.calls.MarkOutboxEntryFailed
+	mock.lockMarkOutboxEntryFailed.RUnlock()
+	return calls
+}
@@ -0,0 +1,182 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/iot-things/pkg/types"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/matryer/is"
+)
+
+func TestPublishPendingMarksEntriesAsDelivered(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	room := things.NewRoom("room-001", things.DefaultLocation, "default")
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{room.Byte()}}, nil
+		},
+	}
+	o := outboxMock(OutboxEntry{ID: 3, ThingID: room.ID()})
+	m := msgCtxMock()
+
+	n := publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(n, 1)
+	is.Equal(len(m.PublishOnTopicCalls()), 1)
+	is.Equal(m.PublishOnTopicCalls()[0].Message.(*types.ThingUpdated).ID, "room-001")
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 1)
+	is.Equal(o.MarkOutboxEntryDeliveredCalls()[0].E.ID, int64(3))
+	is.Equal(len(o.MarkOutboxEntryFailedCalls()), 0)
+}
+
+func TestPublishPendingRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	room := things.NewRoom("room-001", things.DefaultLocation, "default")
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{room.Byte()}}, nil
+		},
+	}
+	o := outboxMock(OutboxEntry{ID: 3, ThingID: room.ID(), Attempts: 2})
+	m := &messaging.MsgContextMock{
+		PublishOnTopicFunc: func(ctx context.Context, message messaging.TopicMessage) error {
+			return errors.New("connection lost")
+		},
+	}
+
+	before := time.Now()
+	publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 0)
+	is.Equal(len(o.MarkOutboxEntryFailedCalls()), 1)
+
+	nextAttempt := o.MarkOutboxEntryFailedCalls()[0].NextAttempt
+	is.True(nextAttempt.Sub(before) >= 4*time.Second) // 2^2 seconds after two failed attempts
+}
+
+func TestPublishPendingDropsEntryThatCanNotBePublished(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{[]byte(`{"id":"spaceship-001","type":"Spaceship","tenant":"default"}`)}}, nil
+		},
+	}
+	m := msgCtxMock()
+
+	o := outboxMock(OutboxEntry{ID: 3, ThingID: "spaceship-001", Attempts: 0})
+	publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(len(o.MarkOutboxEntryFailedCalls()), 1) // retried a few times in case the type is registered again
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 0)
+
+	o = outboxMock(
+		OutboxEntry{ID: 3, ThingID: "spaceship-001", Attempts: outboxMaxAttempts - 1},
+		OutboxEntry{ID: 4, ThingID: "spaceship-001", Topic: "thing.deleted", Body: []byte(`{}`)},
+	)
+	publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(len(o.MarkOutboxEntryFailedCalls()), 0)
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 2) // the entry is dropped and later events are published
+	is.Equal(len(m.PublishOnTopicCalls()), 1)
+}
+
+func TestPublishPendingKeepsOrderOfThing(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r := &ThingsReaderMock{}
+	o := outboxMock(
+		OutboxEntry{ID: 1, ThingID: "room-001", Topic: "thing.created", Body: []byte(`{"id":"room-001"}`)},
+		OutboxEntry{ID: 2, ThingID: "room-002", Topic: "thing.created", Body: []byte(`{"id":"room-002"}`)},
+		OutboxEntry{ID: 3, ThingID: "room-001", Topic: "thing.deleted", Body: []byte(`{"id":"room-001"}`)},
+	)
+	m := &messaging.MsgContextMock{
+		PublishOnTopicFunc: func(ctx context.Context, message messaging.TopicMessage) error {
+			if string(message.Body()) == `{"id":"room-001"}` {
+				return errors.New("connection lost")
+			}
+			return nil
+		},
+	}
+
+	publishPending(ctx, r, o, m, time.Now())
+
+	// the deletion of room-001 is not published before it has been created
+	is.Equal(len(m.PublishOnTopicCalls()), 2)
+	is.Equal(len(o.MarkOutboxEntryFailedCalls()), 1)
+	is.Equal(o.MarkOutboxEntryFailedCalls()[0].E.ID, int64(1))
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 1)
+	is.Equal(o.MarkOutboxEntryDeliveredCalls()[0].E.ID, int64(2))
+}
+
+func TestPublishPendingForDeletedThing(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			return QueryResult{Data: [][]byte{}}, nil
+		},
+	}
+	o := outboxMock(OutboxEntry{ID: 1, ThingID: "deleted"})
+	m := msgCtxMock()
+
+	publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(len(m.PublishOnTopicCalls()), 0)
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 1)
+}
+
+func TestPublishPendingStoredEvent(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r := &ThingsReaderMock{}
+	o := outboxMock(OutboxEntry{ID: 7, ThingID: "room-001", Topic: "thing.created", ContentType: "application/vnd.diwise.room+json", Body: []byte(`{"id":"room-001"}`)})
+	m := msgCtxMock()
+
+	publishPending(ctx, r, o, m, time.Now())
+
+	is.Equal(len(r.QueryThingsCalls()), 0) // stored events are published as is
+	is.Equal(len(m.PublishOnTopicCalls()), 1)
+
+	msg := m.PublishOnTopicCalls()[0].Message
+	is.Equal(msg.TopicName(), "thing.created")
+	is.Equal(msg.ContentType(), "application/vnd.diwise.room+json")
+	is.Equal(string(msg.Body()), `{"id":"room-001"}`)
+	is.Equal(len(o.MarkOutboxEntryDeliveredCalls()), 1)
+}
+
+func TestBackoff(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(backoff(0), 1*time.Second)
+	is.Equal(backoff(3), 8*time.Second)
+	is.Equal(backoff(100), outboxMaxBackoff)
+}
+
+func outboxMock(entries ...OutboxEntry) *ThingsOutboxMock {
+	return &ThingsOutboxMock{
+		GetPendingOutboxEntriesFunc: func(ctx context.Context, createdBefore time.Time, limit int) ([]OutboxEntry, error) {
+			return entries, nil
+		},
+		MarkOutboxEntryDeliveredFunc: func(ctx context.Context, e OutboxEntry) error {
+			return nil
+		},
+		MarkOutboxEntryFailedFunc: func(ctx context.Context, e OutboxEntry, nextAttempt time.Time) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,268 @@
+package iotthings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+var (
+	ErrParentNotFound = errors.New("parent thing not found")
+	ErrCircularParent = errors.New("thing can not be a part of itself")
+)
+
+// maxPartsDepth is the number of levels of parents that are checked for cycles and aggregated when a part changes
+const maxPartsDepth = 16
+
+// maxParts is the number of parts that are read when the parts of a thing are aggregated
+const maxParts = 1000
+
+// ConnectThing makes a thing a part of the thing parentID, i.e. sets its refParent. The thing is created from b if it does not exist.
+func (a *app) ConnectThing(ctx context.Context, parentID string, b []byte, tenants []string) error {
+	if len(tenants) == 0 {
+		return ErrMissingThingTenant
+	}
+
+	part := make(map[string]any)
+	err := json.Unmarshal(b, &part)
+	if err != nil {
+		return err
+	}
+
+	partID, _ := part["id"].(string)
+	if partID == "" {
+		return ErrMissingThingID
+	}
+
+	result, err := a.reader.QueryThings(ctx, WithID(parentID), WithTenants(tenants))
+	if err != nil {
+		return err
+	}
+	if len(result.Data) != 1 {
+		return ErrThingNotFound
+	}
+
+	result, err = a.reader.QueryThings(ctx, WithID(partID), WithTenants(tenants))
+	if err != nil {
+		return err
+	}
+
+	if len(result.Data) == 1 {
+		patch, err := json.Marshal(map[string]any{"refParent": parentID})
+		if err != nil {
+			return err
+		}
+		return a.MergeThing(ctx, partID, patch, 0, tenants)
+	}
+
+	part["refParent"] = parentID
+
+	b, err = json.Marshal(part)
+	if err != nil {
+		return err
+	}
+
+	return a.AddThing(ctx, b, tenants)
+}
+
+// checkParent returns ErrParentNotFound if the parent of t does not exist in the tenant of t, or ErrCircularParent if t
+// would become a part of itself
+func (a *app) checkParent(ctx context.Context, t things.Thing) error {
+	parentID := t.Parent()
+
+	for depth := 0; parentID != "" && depth < maxPartsDepth; depth++ {
+		if parentID == t.ID() {
+			return ErrCircularParent
+		}
+
+		result, err := a.reader.QueryThings(ctx, WithID(parentID), WithTenants([]string{t.Tenant()}))
+		if err != nil {
+			return err
+		}
+		if len(result.Data) != 1 {
+			if depth == 0 {
+				return ErrParentNotFound
+			}
+			return nil
+		}
+
+		parent := struct {
+			RefParent string `json:"refParent"`
+		}{}
+		err = json.Unmarshal(result.Data[0], &parent)
+		if err != nil {
+			return err
+		}
+
+		parentID = parent.RefParent
+	}
+
+	return nil
+}
+
+// parentChanged returns true if t has a parent that is not the parent of current
+func parentChanged(current, t things.Thing) bool {
+	return t.Parent() != "" && (current == nil || current.Parent() != t.Parent())
+}
+
+// aggregate updates the aggregated properties of the things, and of their parents, after a part of them has changed.
+// Aggregation is best effort, errors are logged and not returned.
+func (a *app) aggregate(ctx context.Context, thingIDs ...string) {
+	slices.Sort(thingIDs)
+
+	for _, id := range slices.Compact(thingIDs) {
+		a.aggregateChanged(ctx, id, nil)
+	}
+}
+
+// aggregateChanged aggregates the parts of a thing, if any of the changed properties of its parts are aggregated, and
+// then its parents. Nil properties aggregates the parts regardless of which properties have changed.
+func (a *app) aggregateChanged(ctx context.Context, thingID string, properties []string) {
+	id := thingID
+
+	for depth := 0; id != "" && depth < maxPartsDepth; depth++ {
+		parentID, err := a.aggregateParts(ctx, id, properties)
+		if err != nil {
+			logging.GetFromContext(ctx).Debug("could not aggregate parts", "thingID", id, "err", err.Error())
+			break
+		}
+
+		// the parent is aggregated since an aggregated property of its part was changed
+		id, properties = parentID, nil
+	}
+}
+
+// aggregateParts aggregates the parts of a thing, if it is an Aggregator that aggregates any of properties, and returns
+// the parent of the thing if it was changed
+func (a *app) aggregateParts(ctx context.Context, thingID string, properties []string) (string, error) {
+	for attempt := 1; attempt <= maxHandleAttempts; attempt++ {
+		t, version := a.getThingByID(ctx, thingID)
+		if t == nil {
+			return "", nil
+		}
+
+		aggregator, ok := t.(things.Aggregator)
+		if !ok {
+			return "", nil
+		}
+
+		if properties != nil && !slices.ContainsFunc(aggregator.AggregatedProperties(), func(p string) bool { return slices.Contains(properties, p) }) {
+			return "", nil
+		}
+
+		parts, err := a.getParts(ctx, t)
+		if err != nil {
+			return "", err
+		}
+
+		if !aggregator.Aggregate(parts) {
+			return "", nil
+		}
+
+		err = a.saveThing(ctx, t, version)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return t.Parent(), nil
+	}
+
+	return "", ErrVersionConflict
+}
+
+type rollupsContextKey struct{}
+
+// rollups collects the parents of things changed by a batch of measurements, together with the changed properties
+// of their parts, so that each parent is aggregated once when all measurements have been handled
+type rollups struct {
+	mu      sync.Mutex
+	parents map[string][]string
+}
+
+func withRollups(ctx context.Context) (context.Context, *rollups) {
+	r := &rollups{parents: map[string][]string{}}
+	return context.WithValue(ctx, rollupsContextKey{}, r), r
+}
+
+// rollup aggregates the parent of a thing, after properties of the thing were changed, or adds it to the rollups
+// in ctx to be aggregated once the batch of measurements has been handled
+func (a *app) rollup(ctx context.Context, parentID string, properties []string) {
+	if parentID == "" || len(properties) == 0 {
+		return
+	}
+
+	r, ok := ctx.Value(rollupsContextKey{}).(*rollups)
+	if !ok {
+		a.aggregateChanged(ctx, parentID, properties)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := append(r.parents[parentID], properties...)
+	slices.Sort(changed)
+	r.parents[parentID] = slices.Compact(changed)
+}
+
+// aggregate aggregates each parent that was collected
+func (r *rollups) aggregate(ctx context.Context, a *app) {
+	r.mu.Lock()
+	parents := maps.Clone(r.parents)
+	r.mu.Unlock()
+
+	for _, parentID := range slices.Sorted(maps.Keys(parents)) {
+		a.aggregateChanged(ctx, parentID, parents[parentID])
+	}
+}
+
+// changedProperties returns the properties of the thing, not including its devices, that differ between before and after
+func changedProperties(before, after map[string]any) []string {
+	changed := []string{}
+
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+
+	slices.Sort(changed)
+
+	return changed
+}
+
+// getParts returns the things that are parts of t
+func (a *app) getParts(ctx context.Context, t things.Thing) ([]things.Thing, error) {
+	result, err := a.reader.QueryThings(ctx, WithRefParent(t.ID()), WithTenants([]string{t.Tenant()}), WithLimit(maxParts))
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]things.Thing, 0, len(result.Data))
+
+	for _, b := range result.Data {
+		p, err := things.ConvToThing(b)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,229 @@
+package iotthings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/matryer/is"
+)
+
+func TestPresenceAtDeskIsAggregatedToRoomAndBuilding(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, store := partsMocks(
+		`{"id":"building-001","type":"Building","tenant":"default"}`,
+		`{"id":"room-001","type":"Room","tenant":"default","refParent":"building-001"}`,
+		`{"id":"desk-001","type":"Desk","tenant":"default","refParent":"room-001","refDevices":[{"deviceID":"device-1"}]}`,
+		`{"id":"desk-002","type":"Desk","tenant":"default","refParent":"room-001"}`,
+	)
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	presence := true
+	a.HandleMeasurements(ctx, []things.Measurement{{
+		ID:        "device-1/3302/5500",
+		Urn:       things.PresenceURN,
+		BoolValue: &presence,
+		Timestamp: time.Now(),
+	}})
+
+	room := store.get("room-001").(*things.Room)
+	is.Equal(*room.Occupancy, things.Occupancy{Desks: 2, Occupied: 1})
+
+	building := store.get("building-001").(*things.Building)
+	is.Equal(*building.Occupancy, things.Occupancy{Desks: 2, Occupied: 1})
+	is.True(building.RoomTemperature == nil) // the room has no temperature sensor
+}
+
+func TestRoomTemperatureIsAggregatedToBuilding(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, store := partsMocks(
+		`{"id":"building-001","type":"Building","tenant":"default"}`,
+		`{"id":"room-001","type":"Room","tenant":"default","refParent":"building-001","refDevices":[{"deviceID":"device-1"}]}`,
+		`{"id":"room-002","type":"Room","tenant":"default","refParent":"building-001","refDevices":[{"deviceID":"device-2"}]}`,
+	)
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	for i, v := range []float64{20, 22} {
+		a.HandleMeasurements(ctx, []things.Measurement{{
+			ID:        []string{"device-1", "device-2"}[i] + "/3303/5700",
+			Urn:       things.TemperatureURN,
+			Value:     &v,
+			Timestamp: time.Now(),
+		}})
+	}
+
+	building := store.get("building-001").(*things.Building)
+	is.Equal(*building.RoomTemperature, 21.0)
+	is.True(building.Occupancy == nil)
+}
+
+func TestPartsAreAggregatedOncePerBatchAndOnlyWhenChanged(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, store := partsMocks(
+		`{"id":"room-001","type":"Room","tenant":"default"}`,
+		`{"id":"desk-001","type":"Desk","tenant":"default","refParent":"room-001","refDevices":[{"deviceID":"device-1"}]}`,
+		`{"id":"desk-002","type":"Desk","tenant":"default","refParent":"room-001","refDevices":[{"deviceID":"device-2"}]}`,
+	)
+
+	a := New(ctx, r, w, msgCtxMock())
+
+	aggregations := func() int {
+		n := 0
+		for _, c := range r.QueryThingsCalls() {
+			if _, ok := newConditions(c.Conditions...)["refparent"]; ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	presence := true
+	measurements := []things.Measurement{
+		{ID: "device-1/3302/5500", Urn: things.PresenceURN, BoolValue: &presence, Timestamp: time.Now()},
+		{ID: "device-2/3302/5500", Urn: things.PresenceURN, BoolValue: &presence, Timestamp: time.Now()},
+	}
+
+	a.HandleMeasurements(ctx, measurements)
+	is.Equal(aggregations(), 1)
+
+	room := store.get("room-001").(*things.Room)
+	is.Equal(*room.Occupancy, things.Occupancy{Desks: 2, Occupied: 2})
+
+	// the presence has not changed, so the room is not aggregated again
+	a.HandleMeasurements(ctx, measurements)
+	is.Equal(aggregations(), 1)
+}
+
+func TestThingCanNotBePartOfItself(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(
+		`{"id":"building-001","type":"Building","tenant":"default"}`,
+		`{"id":"room-001","type":"Room","tenant":"default","refParent":"building-001"}`,
+	)
+
+	a := New(ctx, r, w, msgCtxMock())
+	tenants := []string{"default"}
+
+	err := a.MergeThing(ctx, "building-001", []byte(`{"refParent":"room-001"}`), 0, tenants)
+	is.True(errors.Is(err, ErrCircularParent))
+
+	err = a.AddThing(ctx, []byte(`{"id":"room-002","type":"Room","tenant":"default","refParent":"building-002"}`), tenants)
+	is.True(errors.Is(err, ErrParentNotFound))
+
+	is.NoErr(a.ConnectThing(ctx, "room-001", []byte(`{"id":"desk-001","type":"Desk","tenant":"default"}`), tenants))
+	is.Equal(w.AddThingCalls()[0].T.Parent(), "room-001")
+}
+
+type partsStore struct {
+	mu       sync.Mutex
+	things   []string
+	data     map[string][]byte
+	versions map[string]int64
+}
+
+func (s *partsStore) get(thingID string) things.Thing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, _ := things.ConvToThing(s.data[thingID])
+	return t
+}
+
+// partsMocks creates mocks, backed by a store, that query things by id, refdevice and refparent
+func partsMocks(tt ...string) (*ThingsReaderMock, *ThingsWriterMock, *partsStore) {
+	store := &partsStore{data: map[string][]byte{}, versions: map[string]int64{}}
+
+	save := func(t things.Thing) {
+		if _, ok := store.data[t.ID()]; !ok {
+			store.things = append(store.things, t.ID())
+		}
+		store.data[t.ID()] = t.Byte()
+		store.versions[t.ID()]++
+	}
+
+	for _, s := range tt {
+		t, _ := things.ConvToThing([]byte(s))
+		save(t)
+	}
+
+	r := &ThingsReaderMock{
+		QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+			c := newConditions(conditions...)
+
+			store.mu.Lock()
+			defer store.mu.Unlock()
+
+			result := QueryResult{Data: [][]byte{}}
+
+			for _, id := range store.things {
+				t := struct {
+					ID         string          `json:"id"`
+					RefParent  string          `json:"refParent"`
+					RefDevices []things.Device `json:"refDevices"`
+				}{}
+				json.Unmarshal(store.data[id], &t)
+
+				if thingID, ok := c["id"]; ok && thingID != t.ID {
+					continue
+				}
+				if refParent, ok := c["refparent"]; ok && refParent != t.RefParent {
+					continue
+				}
+				if ref, ok := c["refdevice"]; ok && !slices.ContainsFunc(t.RefDevices, func(d things.Device) bool { return d.DeviceID == ref }) {
+					continue
+				}
+
+				result.Data = append(result.Data, store.data[id])
+				result.Versions = append(result.Versions, store.versions[id])
+			}
+
+			return result, nil
+		},
+	}
+	w := &ThingsWriterMock{
+		AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+
+			if _, ok := store.data[t.ID()]; ok {
+				return ErrAlreadyExists
+			}
+
+			save(t)
+
+			return nil
+		},
+		AddValueFunc: func(ctx context.Context, t things.Thing, m things.Value) error {
+			return nil
+		},
+		UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+
+			if version != 0 && version != store.versions[t.ID()] {
+				return ErrVersionConflict
+			}
+
+			save(t)
+
+			return nil
+		},
+	}
+
+	return r, w, store
+}
@@ -0,0 +1,310 @@
+package iotthings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch      = errors.New("invalid patch document")
+	ErrPatchTestFailed   = errors.New("patch test operation failed")
+	ErrPatchNotPossible  = errors.New("patch could not be applied")
+	ErrProtectedProperty = errors.New("id, type and tenant can not be changed")
+)
+
+// protectedProperties can not be changed by a patch
+var protectedProperties = []string{"id", "type", "tenant"}
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to target. Members with a null value are removed and objects are merged recursively.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// createMergePatch returns the JSON Merge Patch (RFC 7396) that changes from into to, an empty object if they are equal
+func createMergePatch(from, to map[string]any) map[string]any {
+	patch := map[string]any{}
+
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			patch[k] = nil
+		}
+	}
+
+	for k, v := range to {
+		current, ok := from[k]
+		if ok && reflect.DeepEqual(current, v) {
+			continue
+		}
+
+		c, cok := current.(map[string]any)
+		m, mok := v.(map[string]any)
+		if cok && mok {
+			patch[k] = createMergePatch(c, m)
+			continue
+		}
+
+		patch[k] = v
+	}
+
+	return patch
+}
+
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// jsonPatch applies a JSON Patch (RFC 6902) with add, remove, replace and test operations to doc
+func jsonPatch(doc any, b []byte) (any, error) {
+	ops := []patchOperation{}
+	err := json.Unmarshal(b, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrInvalidPatch, err.Error())
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, fmt.Errorf("%w, operation %d has no path", ErrInvalidPatch, i)
+		}
+
+		if !slices.Contains([]string{"add", "remove", "replace", "test"}, op.Op) {
+			return nil, fmt.Errorf("%w, unsupported operation %q", ErrInvalidPatch, op.Op)
+		}
+
+		tokens, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if op.Value != nil {
+			err = json.Unmarshal(*op.Value, &value)
+			if err != nil {
+				return nil, fmt.Errorf("%w, %s", ErrInvalidPatch, err.Error())
+			}
+		} else if op.Op != "remove" {
+			return nil, fmt.Errorf("%w, operation %d has no value", ErrInvalidPatch, i)
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = update(doc, tokens, addValue(value))
+		case "remove":
+			doc, err = update(doc, tokens, removeValue)
+		case "replace":
+			doc, err = update(doc, tokens, replaceValue(value))
+		case "test":
+			err = testValue(doc, tokens, value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w (operation %d, path %q)", err, i, *op.Path)
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped reference tokens
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w, path %q must start with /", ErrInvalidPatch, path)
+	}
+
+	r := strings.NewReplacer("~1", "/", "~0", "~")
+
+	tokens := strings.Split(path[1:], "/")
+	for i := range tokens {
+		tokens[i] = r.Replace(tokens[i])
+	}
+
+	return tokens, nil
+}
+
+type leafFunc func(parent any, key string) (any, error)
+
+// update applies fn to the parent of the value referenced by tokens and returns the, possibly replaced, node
+func update(node any, tokens []string, fn leafFunc) (any, error) {
+	if len(tokens) == 0 {
+		return fn(nil, "")
+	}
+
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w, %q not found", ErrPatchNotPossible, tokens[0])
+		}
+		c, err := update(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = c
+		return n, nil
+	case []any:
+		i, err := arrayIndex(tokens[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		c, err := update(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = c
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%w, %q not found", ErrPatchNotPossible, tokens[0])
+	}
+}
+
+func addValue(value any) leafFunc {
+	return func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case nil:
+			return value, nil
+		case map[string]any:
+			p[key] = value
+			return p, nil
+		case []any:
+			if key == "-" {
+				return append(p, value), nil
+			}
+			i, err := arrayIndex(key, len(p))
+			if err != nil {
+				return nil, err
+			}
+			p = append(p[:i], append([]any{value}, p[i:]...)...)
+			return p, nil
+		default:
+			return nil, fmt.Errorf("%w, can not add %q to a value that is not an object or array", ErrPatchNotPossible, key)
+		}
+	}
+}
+
+func removeValue(parent any, key string) (any, error) {
+	switch p := parent.(type) {
+	case map[string]any:
+		if _, ok := p[key]; !ok {
+			return nil, fmt.Errorf("%w, %q not found", ErrPatchNotPossible, key)
+		}
+		delete(p, key)
+		return p, nil
+	case []any:
+		i, err := arrayIndex(key, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(p[:i], p[i+1:]...), nil
+	default:
+		return nil, fmt.Errorf("%w, can not remove %q", ErrPatchNotPossible, key)
+	}
+}
+
+func replaceValue(value any) leafFunc {
+	return func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case nil:
+			return value, nil
+		case map[string]any:
+			if _, ok := p[key]; !ok {
+				return nil, fmt.Errorf("%w, %q not found", ErrPatchNotPossible, key)
+			}
+			p[key] = value
+			return p, nil
+		case []any:
+			i, err := arrayIndex(key, len(p)-1)
+			if err != nil {
+				return nil, err
+			}
+			p[i] = value
+			return p, nil
+		default:
+			return nil, fmt.Errorf("%w, %q not found", ErrPatchNotPossible, key)
+		}
+	}
+}
+
+func testValue(doc any, tokens []string, value any) error {
+	current := doc
+
+	for _, t := range tokens {
+		switch n := current.(type) {
+		case map[string]any:
+			v, ok := n[t]
+			if !ok {
+				return fmt.Errorf("%w, %q not found", ErrPatchTestFailed, t)
+			}
+			current = v
+		case []any:
+			i, err := arrayIndex(t, len(n)-1)
+			if err != nil {
+				return ErrPatchTestFailed
+			}
+			current = n[i]
+		default:
+			return fmt.Errorf("%w, %q not found", ErrPatchTestFailed, t)
+		}
+	}
+
+	if !reflect.DeepEqual(current, value) {
+		return ErrPatchTestFailed
+	}
+
+	return nil
+}
+
+// arrayIndex parses an array index, the index must be in the range [0, maxIndex]
+func arrayIndex(token string, maxIndex int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > maxIndex || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w, index %q out of range", ErrPatchNotPossible, token)
+	}
+	return i, nil
+}
+
+// protectedPropertiesChanged reports whether id, type or tenant differ between current and patched
+func protectedPropertiesChanged(current map[string]any, patched any) bool {
+	p, ok := patched.(map[string]any)
+	if !ok {
+		return true
+	}
+
+	for _, k := range protectedProperties {
+		if !reflect.DeepEqual(current[k], p[k]) {
+			return true
+		}
+	}
+
+	return false
+}
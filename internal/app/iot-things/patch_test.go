@@ -0,0 +1,134 @@
+package iotthings
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396, appendix A
+	tests := []struct {
+		target, patch, result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.patch, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(string(mustMarshal(mergePatch(mustUnmarshal(tc.target), mustUnmarshal(tc.patch)))), tc.result)
+		})
+	}
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	tests := []struct {
+		from, to, patch string
+	}{
+		{`{"a":"b"}`, `{"a":"b"}`, `{}`},
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b","b":"c"}`, `{"b":"c"}`, `{"a":null}`},
+		{`{"a":{"b":"c","d":"e"}}`, `{"a":{"b":"d","d":"e"}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[1,2]}`, `{"a":[1]}`, `{"a":[1]}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.patch, func(t *testing.T) {
+			is := is.New(t)
+
+			from, to := mustUnmarshal(tc.from).(map[string]any), mustUnmarshal(tc.to).(map[string]any)
+			patch := createMergePatch(from, to)
+			is.Equal(string(mustMarshal(patch)), tc.patch)
+			is.Equal(string(mustMarshal(mergePatch(from, patch))), tc.to) // the patch changes from into to
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	doc := `{"id":"room-001","tags":["a","b"],"refDevices":[{"deviceID":"d1"},{"deviceID":"d2"}],"a/b":1,"m~n":2}`
+
+	tests := map[string]struct {
+		patch  string
+		result string
+		err    error
+	}{
+		"add member":          {`[{"op":"add","path":"/name","value":"Room 1"}]`, `"name":"Room 1"`, nil},
+		"add to array":        {`[{"op":"add","path":"/tags/1","value":"c"}]`, `"tags":["a","c","b"]`, nil},
+		"append to array":     {`[{"op":"add","path":"/tags/-","value":"c"}]`, `"tags":["a","b","c"]`, nil},
+		"add nested":          {`[{"op":"add","path":"/refDevices/1/deviceID","value":"d3"}]`, `"refDevices":[{"deviceID":"d1"},{"deviceID":"d3"}]`, nil},
+		"remove from array":   {`[{"op":"remove","path":"/refDevices/0"}]`, `"refDevices":[{"deviceID":"d2"}]`, nil},
+		"remove member":       {`[{"op":"remove","path":"/tags"}]`, `{"a/b":1,"id":"room-001","m~n":2,"refDevices"`, nil},
+		"replace":             {`[{"op":"replace","path":"/tags/0","value":"z"}]`, `"tags":["z","b"]`, nil},
+		"escaped pointer":     {`[{"op":"replace","path":"/a~1b","value":3},{"op":"replace","path":"/m~0n","value":4}]`, `"a/b":3`, nil},
+		"test then replace":   {`[{"op":"test","path":"/tags/1","value":"b"},{"op":"replace","path":"/tags/1","value":"c"}]`, `"tags":["a","c"]`, nil},
+		"test failed":         {`[{"op":"test","path":"/tags/1","value":"x"}]`, "", ErrPatchTestFailed},
+		"remove missing":      {`[{"op":"remove","path":"/missing"}]`, "", ErrPatchNotPossible},
+		"replace missing":     {`[{"op":"replace","path":"/missing","value":1}]`, "", ErrPatchNotPossible},
+		"index out of range":  {`[{"op":"add","path":"/tags/5","value":"c"}]`, "", ErrPatchNotPossible},
+		"missing parent":      {`[{"op":"add","path":"/missing/a","value":1}]`, "", ErrPatchNotPossible},
+		"unsupported op":      {`[{"op":"move","from":"/tags","path":"/labels"}]`, "", ErrInvalidPatch},
+		"invalid pointer":     {`[{"op":"add","path":"tags","value":1}]`, "", ErrInvalidPatch},
+		"missing value":       {`[{"op":"add","path":"/name"}]`, "", ErrInvalidPatch},
+		"not a patch":         {`{"op":"add"}`, "", ErrInvalidPatch},
+		"leading zero index":  {`[{"op":"remove","path":"/tags/01"}]`, "", ErrPatchNotPossible},
+		"test array in order": {`[{"op":"test","path":"/tags","value":["a","b"]}]`, `"tags":["a","b"]`, nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+
+			result, err := jsonPatch(mustUnmarshal(doc), []byte(tc.patch))
+			if tc.err != nil {
+				is.True(errors.Is(err, tc.err))
+				return
+			}
+
+			is.NoErr(err)
+			is.True(strings.Contains(string(mustMarshal(result)), tc.result))
+		})
+	}
+}
+
+func TestProtectedPropertiesChanged(t *testing.T) {
+	is := is.New(t)
+
+	current := mustUnmarshal(`{"id":"room-001","type":"Room","tenant":"default"}`).(map[string]any)
+
+	is.True(!protectedPropertiesChanged(current, mustUnmarshal(`{"id":"room-001","type":"Room","tenant":"default","name":"x"}`)))
+	is.True(protectedPropertiesChanged(current, mustUnmarshal(`{"id":"room-001","type":"Room","tenant":"secret"}`)))
+	is.True(protectedPropertiesChanged(current, mustUnmarshal(`{"id":"room-001","tenant":"default"}`)))
+	is.True(protectedPropertiesChanged(current, mustUnmarshal(`["room-001"]`)))
+}
+
+func mustUnmarshal(s string) any {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func mustMarshal(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
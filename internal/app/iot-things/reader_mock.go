@@ -21,6 +21,9 @@ var _ ThingsReader = &ThingsReaderMock{}
 //			GetTagsFunc: func(ctx context.Context, tenants []string) ([]string, error) {
 //				panic("mock out the GetTags method")
 //			},
+//			QueryHistoryFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+//				panic("mock out the QueryHistory method")
+//			},
 //			QueryThingsFunc: func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
 //				panic("mock out the QueryThings method")
 //			},
@@ -37,6 +40,9 @@ type ThingsReaderMock struct {
 	// GetTagsFunc mocks the GetTags method.
 	GetTagsFunc func(ctx context.Context, tenants []string) ([]string, error)
 
+	// QueryHistoryFunc mocks the QueryHistory method.
+	QueryHistoryFunc func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error)
+
 	// QueryThingsFunc mocks the QueryThings method.
 	QueryThingsFunc func(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error)
 
@@ -52,6 +58,13 @@ type ThingsReaderMock struct {
 			// Tenants is the tenants argument value.
 			Tenants []string
 		}
+		// QueryHistory holds details about calls to the QueryHistory method.
+		QueryHistory []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Conditions is the conditions argument value.
+			Conditions []ConditionFunc
+		}
 		// QueryThings holds details about calls to the QueryThings method.
 		QueryThings []struct {
 			// Ctx is the ctx argument value.
@@ -67,9 +80,10 @@ type ThingsReaderMock struct {
 			Conditions []ConditionFunc
 		}
 	}
-	lockGetTags     sync.RWMutex
-	lockQueryThings sync.RWMutex
-	lockQueryValues sync.RWMutex
+	lockGetTags      sync.RWMutex
+	lockQueryHistory sync.RWMutex
+	lockQueryThings  sync.RWMutex
+	lockQueryValues  sync.RWMutex
 }
 
 // GetTags calls GetTagsFunc.
@@ -108,6 +122,42 @@ func (mock *ThingsReaderMock) GetTagsCalls() []struct {
 	return calls
 }
 
+// QueryHistory calls QueryHistoryFunc.
+func (mock *ThingsReaderMock) QueryHistory(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
+	if mock.QueryHistoryFunc == nil {
+		panic("ThingsReaderMock.QueryHistoryFunc: method is nil but ThingsReader.QueryHistory was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		Conditions []ConditionFunc
+	}{
+		Ctx:        ctx,
+		Conditions: conditions,
+	}
+	mock.lockQueryHistory.Lock()
+	mock.calls.QueryHistory = append(mock.calls.QueryHistory, callInfo)
+	mock.lockQueryHistory.Unlock()
+	return mock.QueryHistoryFunc(ctx, conditions...)
+}
+
+// QueryHistoryCalls gets all the calls that were made to QueryHistory.
+// Check the length with:
+//
+//	len(mockedThingsReader.QueryHistoryCalls())
+func (mock *ThingsReaderMock) QueryHistoryCalls() []struct {
+	Ctx        context.Context
+	Conditions []ConditionFunc
+} {
+	var calls []struct {
+		Ctx        context.Context
+		Conditions []ConditionFunc
+	}
+	mock.lockQueryHistory.RLock()
+	calls = mock.calls.QueryHistory
+	mock.lockQueryHistory.RUnlock()
+	return calls
+}
+
 // QueryThings calls QueryThingsFunc.
 func (mock *ThingsReaderMock) QueryThings(ctx context.Context, conditions ...ConditionFunc) (QueryResult, error) {
 	if mock.QueryThingsFunc == nil {
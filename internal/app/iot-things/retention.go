@@ -0,0 +1,35 @@
+package iotthings
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+const retentionInterval time.Duration = 1 * time.Hour
+
+// purgeDeleted permanently removes things that have been deleted for longer than retention, once every retentionInterval
+func purgeDeleted(ctx context.Context, w ThingsWriter, retention time.Duration) {
+	log := logging.GetFromContext(ctx)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := w.PurgeDeletedThings(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Error("could not purge deleted things", "err", err.Error())
+				continue
+			}
+			if n > 0 {
+				log.Info("purged deleted things", slog.Int("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package iotthings
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+// ErrSeedNotValid is returned if one or more rows in a file with things have errors, nothing is seeded from the file
+var ErrSeedNotValid = errors.New("file with things is not valid")
+
+// SeedAction is the change a row in a file with things makes to the thing
+type SeedAction string
+
+const (
+	SeedCreate    SeedAction = "create"
+	SeedUpdate    SeedAction = "update"
+	SeedUnchanged SeedAction = "unchanged"
+)
+
+// seedColumns is the number of columns in a file with things
+const seedColumns = 10
+
+// SeedRow is the result of a row in a file with things. Row is the line in the file, or the number of the feature in
+// a GeoJSON file, and 0 for errors in the file as a whole. Diff is a JSON Merge Patch from the existing thing if the
+// row updates it. The row is not seeded if it has errors.
+type SeedRow struct {
+	Row      int
+	ID       string
+	Action   SeedAction
+	Diff     json.RawMessage
+	Errors   []error
+	Warnings []string
+
+	patch  map[string]any
+	thing  []byte
+	tenant string
+}
+
+func (row *SeedRow) fail(err error) {
+	row.Errors = append(row.Errors, err)
+}
+
+func (row *SeedRow) warn(format string, args ...any) {
+	row.Warnings = append(row.Warnings, fmt.Sprintf(format, args...))
+}
+
+// SeedReport is the result of each row in a file with things
+type SeedReport struct {
+	DryRun bool
+	Rows   []SeedRow
+}
+
+// Valid returns true if no row in the file has errors
+func (r SeedReport) Valid() bool {
+	return r.Failed() == 0
+}
+
+// Failed returns the number of rows with errors
+func (r SeedReport) Failed() int {
+	n := 0
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Count returns the number of rows, without errors, that make the change action
+func (r SeedReport) Count(action SeedAction) int {
+	n := 0
+	for _, row := range r.Rows {
+		if len(row.Errors) == 0 && row.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// SeedFormat is the content type of a file with things
+type SeedFormat string
+
+const (
+	SeedCSV     SeedFormat = "text/csv"
+	SeedGeoJSON SeedFormat = "application/geo+json"
+	SeedJSON    SeedFormat = "application/json"
+	SeedNDJSON  SeedFormat = "application/x-ndjson"
+)
+
+// SeedFormatOf returns the format of a file with things from its content type or, if the content type is not the
+// type of a format, from the extension of its name. Files are CSV unless another format is found.
+func SeedFormatOf(contentType, name string) SeedFormat {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "text/csv":
+		return SeedCSV
+	case "application/geo+json":
+		return SeedGeoJSON
+	case "application/json":
+		return SeedJSON
+	case "application/x-ndjson", "application/ndjson":
+		return SeedNDJSON
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".geojson":
+		return SeedGeoJSON
+	case ".json":
+		return SeedJSON
+	case ".ndjson", ".jsonl":
+		return SeedNDJSON
+	}
+
+	return SeedCSV
+}
+
+// Seed creates, or updates, the things in a file. Every row is read and validated before anything is seeded, and
+// nothing is seeded if a row has errors or if dryRun is true. Things that are unchanged are not updated. Rows with
+// things in a tenant that is not one of tenants have errors, a nil tenants allows every tenant and is only used for
+// the file with things that is seeded at startup.
+func (a *app) Seed(ctx context.Context, r io.Reader, format SeedFormat, dryRun bool, tenants []string) (SeedReport, error) {
+	ctx = WithSource(ctx, SourceSeed)
+
+	report, err := a.readSeed(ctx, r, format, tenants)
+	report.DryRun = dryRun
+	if err != nil {
+		return report, err
+	}
+
+	if !report.Valid() {
+		return report, ErrSeedNotValid
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if tenants == nil {
+		tenants = []string{"default"}
+		for _, row := range report.Rows {
+			if row.tenant != "" && !slices.Contains(tenants, row.tenant) {
+				tenants = append(tenants, row.tenant)
+			}
+		}
+	}
+
+	for _, row := range report.Rows {
+		switch row.Action {
+		case SeedCreate:
+			err = a.AddThing(ctx, row.thing, tenants)
+		case SeedUpdate:
+			err = a.UpdateThing(ctx, row.thing, 0, tenants)
+		default:
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("could not seed row %d, %w", row.Row, err)
+		}
+	}
+
+	return report, nil
+}
+
+// readSeed reads every row in a file with things and compares them to the existing things
+func (a *app) readSeed(ctx context.Context, r io.Reader, format SeedFormat, tenants []string) (SeedReport, error) {
+	var rows []SeedRow
+	var err error
+
+	switch format {
+	case SeedCSV, "":
+		rows, err = readCSV(r)
+	case SeedGeoJSON:
+		rows, err = readGeoJSON(r)
+	case SeedJSON:
+		rows, err = readJSON(r)
+	case SeedNDJSON:
+		rows, err = readNDJSON(r)
+	default:
+		err = fmt.Errorf("unknown format %s of file with things", format)
+	}
+	if err != nil {
+		return SeedReport{Rows: []SeedRow{}}, err
+	}
+
+	ids := map[string]int{}
+
+	for i := range rows {
+		row := &rows[i]
+
+		if row.patch == nil || len(row.Errors) > 0 {
+			continue
+		}
+
+		a.readSeedThing(ctx, row, tenants)
+
+		if row.ID != "" {
+			if other, ok := ids[row.ID]; ok {
+				row.fail(fmt.Errorf("thing %s is also on row %d", row.ID, other))
+			} else {
+				ids[row.ID] = row.Row
+			}
+		}
+	}
+
+	return SeedReport{Rows: rows}, nil
+}
+
+// readSeedThing merges the properties on a row with the existing thing and finds the change it makes to the existing thing
+func (a *app) readSeedThing(ctx context.Context, row *SeedRow, tenants []string) {
+	id, _ := row.patch["id"].(string)
+	type_, _ := row.patch["type"].(string)
+
+	row.ID = id
+
+	if id == "" {
+		row.fail(ErrMissingThingID)
+		return
+	}
+
+	m := make(map[string]any)
+
+	current, _ := a.getThingByID(ctx, id)
+	if current != nil && tenants != nil && !slices.Contains(tenants, current.Tenant()) {
+		row.fail(fmt.Errorf("%w, thing %s is in another tenant", ErrTenantNotAllowed, id))
+		return
+	}
+	if current != nil {
+		err := json.Unmarshal(current.Byte(), &m)
+		if err != nil {
+			row.fail(err)
+			return
+		}
+		if type_ != "" && !strings.EqualFold(current.Type(), type_) {
+			row.warn("type %s is ignored, the thing is a %s", type_, current.Type())
+		}
+		delete(row.patch, "type")
+	} else if type_ == "" {
+		row.fail(ErrMissingThingType)
+		return
+	}
+
+	m, _ = mergePatch(m, row.patch).(map[string]any)
+
+	row.tenant, _ = m["tenant"].(string)
+	if row.tenant == "" {
+		row.fail(ErrMissingThingTenant)
+		return
+	}
+	if tenants != nil && !slices.Contains(tenants, row.tenant) {
+		row.fail(fmt.Errorf("%w, %s", ErrTenantNotAllowed, row.tenant))
+		return
+	}
+	if current != nil && current.Tenant() != row.tenant {
+		row.fail(fmt.Errorf("%w, thing %s is in tenant %s", ErrProtectedProperty, id, current.Tenant()))
+		return
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		row.fail(err)
+		return
+	}
+
+	err = things.Validate(b)
+	if err != nil {
+		row.fail(err)
+		return
+	}
+
+	t, err := things.ConvToThing(b)
+	if err != nil {
+		row.fail(err)
+		return
+	}
+
+	row.thing = b
+
+	if current == nil {
+		row.Action = SeedCreate
+		return
+	}
+
+	from, to := make(map[string]any), make(map[string]any)
+	json.Unmarshal(current.Byte(), &from)
+	json.Unmarshal(t.Byte(), &to)
+
+	patch := createMergePatch(from, to)
+	if len(patch) == 0 {
+		row.Action = SeedUnchanged
+		return
+	}
+
+	row.Action = SeedUpdate
+	row.Diff, _ = json.Marshal(patch)
+}
+
+// readCSV reads a semicolon separated file with things, the header row is optional
+func readCSV(r io.Reader) ([]SeedRow, error) {
+	rows := []SeedRow{}
+	version := 1
+
+	f := csv.NewReader(r)
+	f.Comma = ';'
+	f.FieldsPerRecord = -1
+
+	for first := true; ; first = false {
+		record, err := f.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			rows = append(rows, SeedRow{Row: pe.StartLine, Errors: []error{pe.Err}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := f.FieldPos(0)
+		row := SeedRow{Row: line}
+
+		if isSeedHeader(record) {
+			if first {
+				version = csvVersion(record)
+			} else {
+				row.warn("header row is skipped")
+				rows = append(rows, row)
+			}
+			continue
+		}
+
+		row.patch = csvPatch(record, version, &row)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvPatch returns the properties of the thing on a row as a JSON Merge Patch, i.e. empty columns remove properties
+func csvPatch(record []string, version int, row *SeedRow) map[string]any {
+	if len(record) < seedColumns {
+		row.fail(fmt.Errorf("row has %d columns, expected %d", len(record), seedColumns))
+		return nil
+	}
+	if len(record) > seedColumns {
+		row.warn("%d columns after args are ignored", len(record)-seedColumns)
+	}
+
+	//  0	 1      2      3         4           5       6      7       8         9
+	// id, type, subType, name, decsription, location, tenant, tags, refDevices, args
+
+	patch := map[string]any{
+		"id":          record[0],
+		"type":        record[1],
+		"subType":     nil,
+		"name":        record[3],
+		"description": record[4],
+		"tenant":      record[6],
+		"tags":        nil,
+		"refDevices":  nil,
+	}
+
+	if record[2] != "" {
+		patch["subType"] = record[2]
+	}
+
+	location, err := seedLocation(record[5])
+	if err != nil {
+		row.fail(err)
+	}
+	if record[5] == "" {
+		row.warn("location is missing")
+	}
+	patch["location"] = location
+
+	if tags := seedTags(record[7]); len(tags) > 0 {
+		patch["tags"] = tags
+	}
+
+	if refDevices := seedRefDevices(record[8]); len(refDevices) > 0 {
+		patch["refDevices"] = refDevices
+	}
+
+	args, err := seedArgs(record[9], version)
+	if err != nil {
+		row.fail(err)
+	}
+
+	for k, v := range args {
+		patch[k] = v
+	}
+
+	return patch
+}
+
+// isSeedHeader returns true if record is the header of a file with things
+func isSeedHeader(record []string) bool {
+	return len(record) > 1 && strings.EqualFold(record[0], "id") && strings.EqualFold(record[1], "type")
+}
+
+func seedLocation(s string) (things.Location, error) {
+	if s == "" {
+		return things.Location{}, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return things.Location{}, fmt.Errorf("location %q must be latitude,longitude", s)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return things.Location{}, fmt.Errorf("location %q has an invalid latitude", s)
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return things.Location{}, fmt.Errorf("location %q has an invalid longitude", s)
+	}
+
+	return things.Location{
+		Latitude:  lat,
+		Longitude: lon,
+	}, nil
+}
+
+func seedTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func seedRefDevices(s string) []things.Device {
+	if s == "" {
+		return nil
+	}
+	devices := []things.Device{}
+	for _, deviceID := range strings.Split(s, ",") {
+		devices = append(devices, things.Device{DeviceID: deviceID})
+	}
+	return devices
+}
+
+// seedArgs reads the additional properties of a thing, a JSON object where ' is used instead of " in version 1 files
+func seedArgs(s string, version int) (map[string]any, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if version == 1 {
+		s = strings.ReplaceAll(s, "'", "\"")
+	}
+
+	m := make(map[string]any)
+	err := json.Unmarshal([]byte(s), &m)
+	if err != nil {
+		return nil, fmt.Errorf("args is not a JSON object, %s", err.Error())
+	}
+
+	for _, k := range protectedProperties {
+		if _, ok := m[k]; ok {
+			return nil, fmt.Errorf("args can not set %s", k)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,172 @@
+package iotthings
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/matryer/is"
+)
+
+func TestSeedDryRun(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(
+		`{"id":"room-001","type":"Room","tenant":"default","name":"Room 1","description":"","location":{"latitude":62.3,"longitude":17.3}}`,
+		`{"id":"room-002","type":"Room","tenant":"default","name":"Room 2","description":"","location":{"latitude":62.3,"longitude":17.3}}`,
+	)
+	a := New(ctx, r, w, msgCtxMock())
+
+	csv := `id;type;subType;name;decsription;location;tenant;tags;refDevices;args
+room-001;Room;;Room 1;;62.3,17.3;default;;;
+room-002;Room;;Room two;;62.3,17.3;default;;;
+room-003;Room;;Room 3;;;default;;;`
+
+	report, err := a.Seed(ctx, strings.NewReader(csv), SeedCSV, true, nil)
+	is.NoErr(err)
+	is.True(report.Valid())
+	is.Equal(len(report.Rows), 3)
+
+	is.Equal(report.Rows[0].Action, SeedUnchanged)
+	is.Equal(report.Rows[1].Action, SeedUpdate)
+	is.Equal(string(report.Rows[1].Diff), `{"name":"Room two"}`)
+	is.Equal(report.Rows[2].Action, SeedCreate)
+	is.Equal(report.Rows[2].Row, 4)
+	is.Equal(report.Rows[2].Warnings, []string{"location is missing"})
+
+	is.Equal(len(w.AddThingCalls()), 0) // nothing is seeded in a dry run
+	is.Equal(len(w.UpdateThingCalls()), 0)
+
+	_, err = a.Seed(ctx, strings.NewReader(csv), SeedCSV, false, nil)
+	is.NoErr(err)
+	is.Equal(len(w.AddThingCalls()), 1)
+	is.Equal(len(w.UpdateThingCalls()), 1) // unchanged things are not updated
+}
+
+func TestSeedIsNotWrittenIfFileIsNotValid(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks()
+	a := New(ctx, r, w, msgCtxMock())
+
+	csv := `room-001;Room;;Room 1;;62.3,17.3;default;;;
+room-002;Room;;Room 2;;north;default;;;
+room-003;Spaceship;;Room 3;;62.3,17.3;default;;;
+room-004;Room;;Room 4;;62.3,17.3;default;;;{'temperature':'warm'
+room-001;Room;;Room 1;;62.3,17.3;default;;;
+room-005;Room;;Room 5
+id;type;subType;name;decsription;location;tenant;tags;refDevices;args`
+
+	report, err := a.Seed(ctx, strings.NewReader(csv), SeedCSV, false, nil)
+	is.True(errors.Is(err, ErrSeedNotValid))
+	is.Equal(len(w.AddThingCalls()), 0)
+
+	is.Equal(len(report.Rows), 7) // a file without a header row is seeded from the first row
+	is.Equal(report.Failed(), 5)
+	is.Equal(report.Rows[0].Action, SeedCreate)
+	is.True(strings.Contains(report.Rows[1].Errors[0].Error(), "location"))
+	is.True(errors.Is(report.Rows[2].Errors[0], things.ErrUnknownType))
+	is.True(strings.Contains(report.Rows[3].Errors[0].Error(), "args"))
+	is.True(strings.Contains(report.Rows[4].Errors[0].Error(), "row 1"))
+	is.True(strings.Contains(report.Rows[5].Errors[0].Error(), "columns"))
+	is.Equal(report.Rows[6].Warnings, []string{"header row is skipped"})
+}
+
+func TestSeedGeoJSON(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, store := partsMocks(`{"id":"room-001","type":"Room","tenant":"default","name":"Room 1","location":{"latitude":62.3,"longitude":17.3}}`)
+	a := New(ctx, r, w, msgCtxMock())
+
+	geojson := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","id":"room-001","geometry":{"type":"Point","coordinates":[17.4,62.4]},"properties":{"name":"Room one"}},
+		{"type":"Feature","geometry":{"type":"LineString","coordinates":[[17.1,62.1,10],[17.2,62.2,10]]},"properties":{"id":"beach-001","type":"PointOfInterest","subType":"Beach","tenant":"default"}},
+		{"type":"Feature","id":"room-002","geometry":{"type":"Polygon","coordinates":[]},"properties":{"type":"Room","tenant":"default"}},
+		{"type":"Feature","id":"room-003","geometry":null,"properties":{"type":"Room","tenant":"default"}}
+	]}`
+
+	report, err := a.Seed(ctx, strings.NewReader(geojson), SeedGeoJSON, true, nil)
+	is.True(errors.Is(err, ErrSeedNotValid))
+	is.Equal(len(report.Rows), 4)
+
+	is.Equal(report.Rows[0].Action, SeedUpdate)
+	is.Equal(string(report.Rows[0].Diff), `{"location":{"latitude":62.4,"longitude":17.4},"name":"Room one"}`)
+	is.Equal(report.Rows[1].Action, SeedCreate)
+	is.True(strings.Contains(string(report.Rows[1].thing), `"area":[[[17.1,62.1],[17.2,62.2]]]`))
+	is.True(strings.Contains(report.Rows[2].Errors[0].Error(), "Polygon"))
+	is.Equal(report.Rows[3].Warnings, []string{"geometry is missing"})
+
+	_, err = a.Seed(ctx, strings.NewReader(`{"type":"Feature"}`), SeedGeoJSON, false, nil)
+	is.True(errors.Is(err, ErrSeedNotValid))
+
+	report, err = a.Seed(ctx, strings.NewReader(strings.Replace(geojson, `"Polygon","coordinates":[]`, `"Point","coordinates":[17.5,62.5]`, 1)), SeedGeoJSON, false, nil)
+	is.NoErr(err)
+	is.Equal(report.Count(SeedCreate), 3)
+
+	room := store.get("room-001").(*things.Room)
+	is.Equal(room.Name, "Room one")
+	is.Equal(room.Location, things.Location{Latitude: 62.4, Longitude: 17.4})
+}
+
+func TestSeedNDJSON(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(`{"id":"room-001","type":"Room","tenant":"default","name":"Room 1"}`)
+	a := New(ctx, r, w, msgCtxMock())
+
+	ndjson := "{\"id\":\"room-001\",\"name\":\"Room one\"}\n\n{\"id\":\"room-002\",\"type\":\"Room\",\"tenant\":\"default\"}\nnot json\n{\"id\":\"room-003\",\"tenant\":\"default\"}\n"
+
+	report, err := a.Seed(ctx, strings.NewReader(ndjson), SeedNDJSON, true, nil)
+	is.True(errors.Is(err, ErrSeedNotValid))
+	is.Equal(len(report.Rows), 4)
+
+	is.Equal(report.Rows[0].Action, SeedUpdate) // properties that are not in the document are kept
+	is.Equal(string(report.Rows[0].Diff), `{"name":"Room one"}`)
+	is.Equal(report.Rows[1].Row, 3)
+	is.Equal(report.Rows[1].Action, SeedCreate)
+	is.True(strings.Contains(report.Rows[2].Errors[0].Error(), "JSON"))
+	is.True(errors.Is(report.Rows[3].Errors[0], ErrMissingThingType))
+
+	report, err = a.Seed(ctx, strings.NewReader(`[{"id":"room-002","type":"Room","tenant":"default"}]`), SeedJSON, true, nil)
+	is.NoErr(err)
+	is.Equal(report.Rows[0].Action, SeedCreate)
+}
+
+func TestSeedFormatOf(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(SeedFormatOf("application/geo+json", "things"), SeedGeoJSON)
+	is.Equal(SeedFormatOf("application/x-ndjson; charset=utf-8", "things"), SeedNDJSON)
+	is.Equal(SeedFormatOf("application/octet-stream", "things.geojson"), SeedGeoJSON)
+	is.Equal(SeedFormatOf("", "/opt/diwise/config/things.json"), SeedJSON)
+	is.Equal(SeedFormatOf("", "things.jsonl"), SeedNDJSON)
+	is.Equal(SeedFormatOf("", "things.csv"), SeedCSV)
+	is.Equal(SeedFormatOf("", "things"), SeedCSV)
+}
+
+func TestSeedInOtherTenantIsNotValid(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	r, w, _ := partsMocks(
+		`{"id":"room-001","type":"Room","tenant":"secret","name":"Room 1"}`,
+	)
+	a := New(ctx, r, w, msgCtxMock())
+
+	csv := `room-001;Room;;Room 1;;62.3,17.3;default;;;
+room-002;Room;;Room 2;;62.3,17.3;secret;;;
+room-003;Room;;Room 3;;62.3,17.3;default;;;`
+
+	report, err := a.Seed(ctx, strings.NewReader(csv), SeedCSV, false, []string{"default"})
+	is.True(errors.Is(err, ErrSeedNotValid))
+	is.True(errors.Is(report.Rows[0].Errors[0], ErrTenantNotAllowed)) // the existing thing is in another tenant
+	is.True(errors.Is(report.Rows[1].Errors[0], ErrTenantNotAllowed))
+	is.Equal(report.Failed(), 2)
+	is.Equal(len(w.AddThingCalls()), 0)
+}
@@ -0,0 +1,190 @@
+package iotthings
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+// readJSON reads a JSON array of things
+func readJSON(r io.Reader) ([]SeedRow, error) {
+	items := []json.RawMessage{}
+
+	err := json.NewDecoder(r).Decode(&items)
+	if err != nil {
+		return fileError(fmt.Errorf("file is not a JSON array of things, %s", err.Error())), nil
+	}
+
+	rows := make([]SeedRow, 0, len(items))
+
+	for i, item := range items {
+		row := SeedRow{Row: i + 1}
+		row.patch = jsonPatchOf(item, &row)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readNDJSON reads a file with a thing on each line, empty lines are skipped
+func readNDJSON(r io.Reader) ([]SeedRow, error) {
+	rows := []SeedRow{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		row := SeedRow{Row: line}
+		row.patch = jsonPatchOf(b, &row)
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+type feature struct {
+	ID         any            `json:"id"`
+	Geometry   *geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// readGeoJSON reads a GeoJSON FeatureCollection where each feature is a thing. The properties of a feature are the
+// properties of the thing, a Point is the location of the thing and a LineString or MultiLineString its area.
+func readGeoJSON(r io.Reader) ([]SeedRow, error) {
+	fc := struct {
+		Type     string            `json:"type"`
+		Features []json.RawMessage `json:"features"`
+	}{}
+
+	err := json.NewDecoder(r).Decode(&fc)
+	if err != nil || fc.Type != "FeatureCollection" {
+		return fileError(errors.New("file is not a GeoJSON FeatureCollection")), nil
+	}
+
+	rows := make([]SeedRow, 0, len(fc.Features))
+
+	for i, b := range fc.Features {
+		row := SeedRow{Row: i + 1}
+
+		f := feature{}
+		err := json.Unmarshal(b, &f)
+		if err != nil {
+			row.fail(fmt.Errorf("feature is not valid, %s", err.Error()))
+			rows = append(rows, row)
+			continue
+		}
+
+		row.patch = f.Properties
+		if row.patch == nil {
+			row.patch = map[string]any{}
+		}
+
+		// the id of the feature is used if the properties have no id
+		if _, ok := row.patch["id"]; !ok {
+			switch id := f.ID.(type) {
+			case string:
+				row.patch["id"] = id
+			case float64:
+				row.patch["id"] = strconv.FormatFloat(id, 'f', -1, 64)
+			}
+		}
+
+		geometryPatch(f.Geometry, &row)
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// geometryPatch sets the location, and area, of the thing on a row from the geometry of a feature. GeoJSON positions
+// are [longitude, latitude], the location of a thing with an area is the first position of the area.
+func geometryPatch(g *geometry, row *SeedRow) {
+	if g == nil {
+		row.warn("geometry is missing")
+		return
+	}
+
+	var area things.LineSegments
+	var err error
+
+	switch g.Type {
+	case "Point":
+		p := things.Point{}
+		err = json.Unmarshal(g.Coordinates, &p)
+		if err == nil && len(p) < 2 {
+			err = errors.New("a position must have a longitude and latitude")
+		}
+		if err == nil {
+			row.patch["location"] = things.Location{Latitude: p[1], Longitude: p[0]}
+		}
+	case "LineString":
+		line := things.Line{}
+		err = json.Unmarshal(g.Coordinates, &line)
+		area = things.LineSegments{line}
+	case "MultiLineString":
+		err = json.Unmarshal(g.Coordinates, &area)
+	default:
+		row.fail(fmt.Errorf("geometry %s is not supported", g.Type))
+		return
+	}
+
+	if err != nil {
+		row.fail(fmt.Errorf("%s is not valid, %s", g.Type, err.Error()))
+		return
+	}
+
+	if area == nil {
+		return
+	}
+
+	for _, line := range area {
+		for i, p := range line {
+			if len(p) < 2 {
+				row.fail(fmt.Errorf("%s is not valid, a position must have a longitude and latitude", g.Type))
+				return
+			}
+			line[i] = p[:2] // altitude is not a part of an area
+		}
+	}
+
+	if len(area) > 0 && len(area[0]) > 0 {
+		row.patch["location"] = things.Location{Latitude: area[0][0][1], Longitude: area[0][0][0]}
+	}
+
+	row.patch["area"] = area
+}
+
+// jsonPatchOf returns a thing document as a JSON Merge Patch of the existing thing
+func jsonPatchOf(b []byte, row *SeedRow) map[string]any {
+	patch := make(map[string]any)
+
+	err := json.Unmarshal(b, &patch)
+	if err != nil {
+		row.fail(fmt.Errorf("row is not a JSON object, %s", err.Error()))
+		return nil
+	}
+
+	return patch
+}
+
+// fileError is the result of a file that could not be read
+func fileError(err error) []SeedRow {
+	return []SeedRow{{Row: 0, Errors: []error{err}}}
+}
@@ -5,11 +5,28 @@ import (
 	"errors"
 )
 
+var BuildingURNs = []string{EnergyURN, PowerURN, TemperatureURN}
+
+func init() {
+	Register(Registration{
+		Type: "Building",
+		Capabilities: Capabilities{
+			URNs:       BuildingURNs,
+			Properties: []string{"energy", "power", "temperature"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Building](),
+	})
+}
+
 type Building struct {
 	thingImpl
 	Energy      float64 `json:"energy"`
 	Power       float64 `json:"power"`
 	Temperature float64 `json:"temperature"`
+	// RoomTemperature is the average temperature of the rooms of the building
+	RoomTemperature *float64   `json:"roomTemperature,omitempty"`
+	Occupancy       *Occupancy `json:"occupancy,omitempty"`
 }
 
 func NewBuilding(id string, l Location, tenant string) Thing {
@@ -86,6 +103,42 @@ func (building *Building) handle(m Measurement, onchange func(m ValueProvider) e
 
 }
 
+// Aggregate calculates the average temperature of the rooms, that have a temperature sensor, and counts
+// the desks, and occupied desks, of the rooms and the desks that are parts of the building itself
+func (building *Building) Aggregate(parts []Thing) bool {
+	var roomTemperature *float64
+
+	t := 0.0
+	n := 0
+
+	for _, p := range parts {
+		if room, ok := p.(*Room); ok && hasMeasurement(room, hasTemperature) {
+			t += room.Temperature
+			n++
+		}
+	}
+
+	if n > 0 {
+		avg := t / float64(n)
+		roomTemperature = &avg
+	}
+
+	occupancy := occupancyOf(parts)
+
+	if !valueChanged(building.RoomTemperature, roomTemperature) && !occupancyChanged(building.Occupancy, occupancy) {
+		return false
+	}
+
+	building.RoomTemperature = roomTemperature
+	building.Occupancy = occupancy
+
+	return true
+}
+
+func (building *Building) AggregatedProperties() []string {
+	return []string{"temperature", "presence", "occupancy"}
+}
+
 func (building *Building) Byte() []byte {
 	b, _ := json.Marshal(building)
 	return b
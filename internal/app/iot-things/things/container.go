@@ -3,16 +3,57 @@ package things
 import (
 	"encoding/json"
 	"errors"
+	"log/slog"
+	"maps"
+	"time"
 
 	"github.com/diwise/iot-things/internal/app/iot-things/functions"
 )
 
+var ContainerURNs = []string{DistanceURN}
+
+func init() {
+	Register(Registration{
+		Type: "Container",
+		Capabilities: Capabilities{
+			URNs:       ContainerURNs,
+			Properties: []string{"currentLevel", "percent", "volume", "lastEmptiedAt", "fillRate", "predictedFullAt"},
+		},
+		SubTypes: map[string]Capabilities{
+			"WasteContainer": {},
+			"Sandstorage":    {},
+		},
+		Schema: schema(containerProperties),
+		New:    convTo[Container](),
+	})
+}
+
+var containerProperties = func() map[string]any {
+	p := maps.Clone(levelConfigProperties)
+	p["emptyingThreshold"] = map[string]any{"type": "number", "exclusiveMinimum": 0, "maximum": 100}
+	return p
+}()
+
+// defaultEmptyingThreshold is the drop in percent that is detected as an emptying of a container
+const defaultEmptyingThreshold float64 = 30
+
+// Container has a level computed from the distance to its content. A drop in percent of at least EmptyingThreshold is
+// detected as an emptying of the container. FillRate, in percent per day, is a least squares fit of the levels since
+// the container was last emptied and PredictedFullAt is when the container is full if it continues to fill at that rate.
+// Volume, in litres, is calculated from the level if the geometry of the container is configured as a Tank.
 type Container struct {
 	thingImpl
 	functions.LevelConfig
+	EmptyingThreshold *float64 `json:"emptyingThreshold,omitempty"`
+
+	CurrentLevel    float64    `json:"currentLevel"`
+	Percent         float64    `json:"percent"`
+	Volume          *float64   `json:"volume,omitempty"`
+	LastEmptiedAt   *time.Time `json:"lastEmptiedAt,omitempty"`
+	FillRate        *float64   `json:"fillRate,omitempty"`
+	PredictedFullAt *time.Time `json:"predictedFullAt,omitempty"`
 
-	CurrentLevel float64 `json:"currentLevel"`
-	Percent      float64 `json:"percent"`
+	Fill *regression `json:"_fill,omitempty"`
 }
 
 func NewContainer(id string, l Location, tenant string) Thing {
@@ -78,10 +119,87 @@ func (c *Container) handle(m Measurement, onchange func(m ValueProvider) error)
 	avg_level, _ := functions.NewLevel(c.Angle, c.MaxDistance, c.MaxLevel, c.MeanLevel, c.Offset, c.CurrentLevel)
 	avg_level.Calc(avg_distance, m.Timestamp)
 
+	previous := c.Percent
+
 	c.CurrentLevel = avg_level.Current()
 	c.Percent = avg_level.Percent()
 
-	return onchange(fillingLevel)
+	errs := []error{onchange(fillingLevel)}
+
+	c.Volume = volumeOf(c.ID(), c.Tank, c.CurrentLevel)
+	if c.Volume != nil {
+		errs = append(errs, onchange(NewVolume(c.ID(), m.ID, *c.Volume, m.Timestamp)))
+	}
+
+	// measurements older than the latest level are not used to detect emptying or to forecast
+	if c.Fill != nil && !m.Timestamp.After(c.Fill.Latest.Timestamp) {
+		return errors.Join(errs...)
+	}
+
+	if c.Fill != nil && previous-c.Percent >= c.emptyingThreshold() {
+		ts := m.Timestamp.UTC()
+		c.LastEmptiedAt = &ts
+		c.Fill = nil
+		errs = append(errs, onchange(NewContainerEmptied(c.ID(), m.ID, m.Timestamp)))
+	}
+
+	if c.Fill == nil {
+		c.Fill = &regression{}
+	}
+	c.Fill.add(Sample{Timestamp: m.Timestamp.UTC(), Value: c.Percent})
+
+	c.forecast()
+
+	return errors.Join(errs...)
+}
+
+// volumeOf returns the volume of a tank at level, or nil if no tank is configured. A tank that the volume can not be
+// calculated for is logged and ignored so that the level is still handled.
+func volumeOf(thingID string, tank *functions.Tank, level float64) *float64 {
+	if tank == nil {
+		return nil
+	}
+
+	volume, err := functions.Volume(*tank, level)
+	if err != nil {
+		slog.Warn("could not calculate volume", "thingID", thingID, "err", err.Error())
+		return nil
+	}
+
+	return &volume
+}
+
+func (c *Container) emptyingThreshold() float64 {
+	if c.EmptyingThreshold != nil {
+		return *c.EmptyingThreshold
+	}
+	return defaultEmptyingThreshold
+}
+
+// forecast calculates the fill rate from the levels since the container was last emptied and predicts when it is full
+func (c *Container) forecast() {
+	c.FillRate, c.PredictedFullAt = nil, nil
+
+	perHour, ok := c.Fill.slope()
+	if !ok {
+		return
+	}
+
+	fillRate := round(perHour * 24)
+	c.FillRate = &fillRate
+
+	if perHour <= 0 {
+		return
+	}
+
+	latest := c.Fill.Latest
+	hours := (100 - latest.Value) / perHour
+	if hours < 0 {
+		hours = 0
+	}
+
+	fullAt := latest.Timestamp.Add(time.Duration(hours * float64(time.Hour))).Truncate(time.Second)
+	c.PredictedFullAt = &fullAt
 }
 
 func (c *Container) Byte() []byte {
@@ -5,6 +5,20 @@ import (
 	"errors"
 )
 
+var DeskURNs = []string{DigitalInputURN, PresenceURN}
+
+func init() {
+	Register(Registration{
+		Type: "Desk",
+		Capabilities: Capabilities{
+			URNs:       DeskURNs,
+			Properties: []string{"presence"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Desk](),
+	})
+}
+
 type Desk struct {
 	thingImpl
 	Presence bool `json:"presence"`
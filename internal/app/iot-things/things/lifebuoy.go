@@ -5,6 +5,20 @@ import (
 	"errors"
 )
 
+var LifebuoyURNs = []string{DigitalInputURN, PresenceURN}
+
+func init() {
+	Register(Registration{
+		Type: "Lifebuoy",
+		Capabilities: Capabilities{
+			URNs:       LifebuoyURNs,
+			Properties: []string{"presence"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Lifebuoy](),
+	})
+}
+
 type Lifebuoy struct {
 	thingImpl
 	Presence bool `json:"presence"`
@@ -0,0 +1,196 @@
+package things
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/functions"
+)
+
+var ParkingSpaceURNs = []string{DigitalInputURN, PresenceURN}
+
+func init() {
+	Register(Registration{
+		Type: "ParkingSpace",
+		Capabilities: Capabilities{
+			URNs:       ParkingSpaceURNs,
+			Properties: []string{"occupied", "occupiedSince", "dwellTime", "overstay", "utilisation"},
+		},
+		SubTypes: map[string]Capabilities{
+			"Disabled":   {},
+			"EVCharging": {},
+			"Loading":    {},
+		},
+		Schema: schema(parkingSpaceProperties),
+		New:    convTo[ParkingSpace](),
+	})
+}
+
+var parkingSpaceProperties = map[string]any{
+	"maxParkingTime": map[string]any{"type": "integer", "minimum": 1},
+}
+
+// ParkingSpace is a parking bay with a sensor that detects if a vehicle is parked. DwellTime is the time the current,
+// or last, vehicle has been parked and Utilisation the percentage of the day, in UTC, that the space has been occupied.
+// A vehicle overstays when it has been parked for longer than MaxParkingTime minutes.
+type ParkingSpace struct {
+	thingImpl
+	MaxParkingTime *int `json:"maxParkingTime,omitempty"`
+
+	Occupied      bool           `json:"occupied"`
+	OccupiedSince *time.Time     `json:"occupiedSince"`
+	DwellTime     *time.Duration `json:"dwellTime"`
+	Overstay      bool           `json:"overstay"`
+	Utilisation   float64        `json:"utilisation"`
+
+	Sw *functions.Stopwatch `json:"_stopwatch"`
+	// OccupiedTime is the time the space has been occupied each day, by vehicles that have left
+	OccupiedTime map[string]time.Duration `json:"_occupiedTime"`
+}
+
+func NewParkingSpace(id string, l Location, tenant string) Thing {
+	return &ParkingSpace{
+		thingImpl: newThingImpl(id, "ParkingSpace", l, tenant),
+		Sw:        functions.NewStopwatch(),
+	}
+}
+
+func (p *ParkingSpace) stopWatch() *functions.Stopwatch {
+	if p.Sw == nil {
+		p.Sw = functions.NewStopwatch()
+	}
+	return p.Sw
+}
+
+func (p *ParkingSpace) Handle(m []Measurement, onchange func(m ValueProvider) error) error {
+	errs := []error{}
+
+	for _, v := range m {
+		errs = append(errs, p.handle(v, onchange))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *ParkingSpace) handle(m Measurement, onchange func(m ValueProvider) error) error {
+	if !(hasDigitalInput(&m) || hasPresence(&m)) {
+		return nil
+	}
+
+	// utilisation is reported for each day since the last measurement if the space has been occupied since then
+	from := m.Timestamp
+	if p.Occupied && !p.ObservedAt.IsZero() && p.ObservedAt.Before(from) {
+		from = p.ObservedAt
+	}
+
+	changed := p.Occupied != *m.BoolValue
+	event := functions.InitialState
+
+	p.stopWatch().Push(*m.BoolValue, m.Timestamp, func(sw functions.Stopwatch) error {
+		event = sw.CurrentEvent
+
+		switch sw.CurrentEvent {
+		case functions.Started:
+			p.OccupiedSince = sw.StartTime
+			p.DwellTime = new(time.Duration)
+		case functions.Updated:
+			p.DwellTime = sw.Duration
+		case functions.Stopped:
+			p.DwellTime = sw.Duration
+			p.addOccupiedTime(*sw.StartTime, *sw.StopTime)
+			p.OccupiedSince = nil
+		}
+
+		return nil
+	})
+
+	p.Occupied = *m.BoolValue
+	p.Overstay = p.Occupied && p.MaxParkingTime != nil && p.DwellTime != nil && *p.DwellTime > time.Duration(*p.MaxParkingTime)*time.Minute
+
+	errs := []error{}
+
+	if changed {
+		errs = append(errs, onchange(NewPresence(p.ID(), m.ID, p.Occupied, m.Timestamp)))
+	}
+
+	if event != functions.InitialState {
+		sec := p.DwellTime.Seconds()
+		errs = append(errs, onchange(NewStopwatch(p.ID(), m.ID, &sec, p.Occupied, m.Timestamp)))
+	}
+
+	today := startOfDay(m.Timestamp)
+
+	for day := startOfDay(from); !day.After(today); day = day.Add(24 * time.Hour) {
+		// the utilisation of a day that has passed is reported at the end of the day
+		ts := m.Timestamp
+		if day.Before(today) {
+			ts = day.Add(24*time.Hour - time.Millisecond)
+		}
+
+		utilisation := p.utilisation(day, m.Timestamp)
+		errs = append(errs, onchange(NewUtilisation(p.ID(), m.ID, utilisation, ts)))
+
+		p.Utilisation = utilisation
+	}
+
+	// the occupied time of days before the current vehicle was parked is not needed anymore
+	keep := today
+	if p.OccupiedSince != nil && p.OccupiedSince.Before(keep) {
+		keep = startOfDay(*p.OccupiedSince)
+	}
+
+	for key := range p.OccupiedTime {
+		if day, err := time.Parse(time.DateOnly, key); err != nil || day.Before(keep) {
+			delete(p.OccupiedTime, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// addOccupiedTime adds the time between start and stop to the occupied time of each day
+func (p *ParkingSpace) addOccupiedTime(start, stop time.Time) {
+	if p.OccupiedTime == nil {
+		p.OccupiedTime = make(map[string]time.Duration)
+	}
+
+	for day := startOfDay(start); day.Before(stop); day = day.Add(24 * time.Hour) {
+		p.OccupiedTime[day.Format(time.DateOnly)] += overlap(start, stop, day, day.Add(24*time.Hour))
+	}
+}
+
+// utilisation returns the percentage of day that the space has been occupied, until now
+func (p *ParkingSpace) utilisation(day, now time.Time) float64 {
+	occupied := p.OccupiedTime[day.Format(time.DateOnly)]
+	if p.OccupiedSince != nil {
+		occupied += overlap(*p.OccupiedSince, now, day, day.Add(24*time.Hour))
+	}
+
+	return math.Round(occupied.Hours()/24*100*100) / 100
+}
+
+func (p *ParkingSpace) Byte() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+// startOfDay returns midnight, in UTC, of the day of ts
+func startOfDay(ts time.Time) time.Time {
+	return ts.UTC().Truncate(24 * time.Hour)
+}
+
+// overlap returns the time that the periods [start, stop) and [from, to) have in common
+func overlap(start, stop, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if stop.After(to) {
+		stop = to
+	}
+	if !stop.After(start) {
+		return 0
+	}
+	return stop.Sub(start)
+}
@@ -0,0 +1,68 @@
+package things
+
+// Aggregator is implemented by things that aggregate properties of their parts, i.e. the things that have
+// the thing as refParent. Aggregate returns true if any aggregated property was changed. AggregatedProperties
+// returns the properties of the parts that are aggregated, so that a change to any other property of a part does
+// not aggregate the parts again.
+type Aggregator interface {
+	Aggregate(parts []Thing) bool
+	AggregatedProperties() []string
+}
+
+// Occupancy is the number of desks, and the number of occupied desks, in a room or building
+type Occupancy struct {
+	Desks    int `json:"desks"`
+	Occupied int `json:"occupied"`
+}
+
+// occupancyOf counts the desks among parts, and the desks of parts that are rooms, or nil if there are no desks
+func occupancyOf(parts []Thing) *Occupancy {
+	o := Occupancy{}
+
+	for _, p := range parts {
+		switch part := p.(type) {
+		case *Desk:
+			o.Desks++
+			if part.Presence {
+				o.Occupied++
+			}
+		case *Room:
+			if part.Occupancy != nil {
+				o.Desks += part.Occupancy.Desks
+				o.Occupied += part.Occupancy.Occupied
+			}
+		}
+	}
+
+	if o.Desks == 0 {
+		return nil
+	}
+
+	return &o
+}
+
+// hasMeasurement returns true if any device of t has a measurement for which has returns true
+func hasMeasurement(t Thing, has func(m *Measurement) bool) bool {
+	for _, refDevice := range t.Refs() {
+		for _, m := range refDevice.Measurements {
+			if has(&m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func occupancyChanged(a, b *Occupancy) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	return *a != *b
+}
+
+func valueChanged(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	return hasChanged(*a, *b)
+}
@@ -6,6 +6,20 @@ import (
 	"time"
 )
 
+var PassageURNs = []string{DigitalInputURN}
+
+func init() {
+	Register(Registration{
+		Type: "Passage",
+		Capabilities: Capabilities{
+			URNs:       PassageURNs,
+			Properties: []string{"cumulatedNumberOfPassages", "passagesToday", "currentState"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Passage](),
+	})
+}
+
 type Passage struct {
 	thingImpl
 	CumulatedNumberOfPassages int64 `json:"cumulatedNumberOfPassages"`
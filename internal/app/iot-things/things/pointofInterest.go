@@ -3,11 +3,90 @@ package things
 import (
 	"encoding/json"
 	"errors"
+	"slices"
+	"strings"
+	"time"
 )
 
+var PointOfInterestURNs = []string{TemperatureURN}
+
+var BeachURNs = []string{ConductivityURN, AcidityURN, GenericSensorURN}
+
+func init() {
+	Register(Registration{
+		Type: "PointOfInterest",
+		Capabilities: Capabilities{
+			URNs:       PointOfInterestURNs,
+			Properties: []string{"temperature"},
+		},
+		SubTypes: map[string]Capabilities{
+			"Beach": {
+				URNs:       BeachURNs,
+				Properties: []string{"conductivity", "pH", "turbidity", "temperatureTrend"},
+			},
+		},
+		Schema: schema(pointOfInterestProperties),
+		New:    convTo[PointOfInterest](),
+	})
+}
+
+var dayOfYearSchema = map[string]any{"type": "string", "pattern": "^(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])$"}
+
+var pointOfInterestProperties = map[string]any{
+	"bathingSeason": map[string]any{
+		"type":     []string{"object", "null"},
+		"required": []string{"start", "end"},
+		"properties": map[string]any{
+			"start":    dayOfYearSchema,
+			"end":      dayOfYearSchema,
+			"timeZone": map[string]any{"type": "string", "minLength": 1},
+		},
+	},
+	"turbiditySensors": map[string]any{"type": []string{"array", "null"}, "items": map[string]any{"type": "string", "minLength": 1}},
+}
+
+// PointOfInterest is a place, such as a beach, with a temperature. A Beach also measures the quality of the water
+// and has a TemperatureTrend, in °C per hour, over the last 24 hours. Conductivity is in µS/cm and turbidity, measured
+// by the generic sensors of the devices in TurbiditySensors, in NTU. Values measured outside the BathingSeason are
+// stored but the point of interest is not changed, Handle returns ErrNotChanged, so they are not published.
 type PointOfInterest struct {
 	thingImpl
-	Temperature float64 `json:"temperature"`
+	Temperature      float64        `json:"temperature"`
+	Conductivity     *float64       `json:"conductivity,omitempty"`
+	PH               *float64       `json:"pH,omitempty"`
+	Turbidity        *float64       `json:"turbidity,omitempty"`
+	TemperatureTrend *float64       `json:"temperatureTrend,omitempty"`
+	BathingSeason    *BathingSeason `json:"bathingSeason,omitempty"`
+	TurbiditySensors []string       `json:"turbiditySensors,omitempty"`
+
+	Temperatures []Sample `json:"_temperatures,omitempty"`
+}
+
+// BathingSeason is the part of the year, as MM-DD, when a beach is open for bathing. Both days are included in the season.
+// The days are in TimeZone, an IANA time zone such as Europe/Stockholm, or in UTC if no, or an unknown, time zone is set.
+type BathingSeason struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Contains returns true if the day of ts, in the time zone of the season, is within the bathing season
+func (s BathingSeason) Contains(ts time.Time) bool {
+	loc := time.UTC
+	if s.TimeZone != "" {
+		if l, err := time.LoadLocation(s.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	day := ts.In(loc).Format("01-02")
+
+	if s.Start <= s.End {
+		return day >= s.Start && day <= s.End
+	}
+
+	// the season spans new year
+	return day >= s.Start || day <= s.End
 }
 
 func NewPointOfInterest(id string, l Location, tenant string) Thing {
@@ -17,19 +96,56 @@ func NewPointOfInterest(id string, l Location, tenant string) Thing {
 }
 func (poi *PointOfInterest) Handle(m []Measurement, onchange func(m ValueProvider) error) error {
 	errs := []error{}
+	changed := false
 
 	for _, v := range m {
-		errs = append(errs, poi.handle(v, onchange))
+		err := poi.handle(v, onchange)
+		if errors.Is(err, ErrNotChanged) {
+			continue
+		}
+		changed = true
+		errs = append(errs, err)
+	}
+
+	if len(m) > 0 && !changed {
+		return ErrNotChanged
 	}
 
 	return errors.Join(errs...)
 }
 
 func (poi *PointOfInterest) handle(m Measurement, onchange func(m ValueProvider) error) error {
-	if !hasTemperature(&m) {
+	if hasTemperature(&m) {
+		return poi.handleTemperature(m, onchange)
+	}
+
+	if !poi.isBeach() {
 		return nil
 	}
 
+	switch {
+	case hasConductivity(&m):
+		v := microSiemensPerCentimetre(*m.Value, m.Unit)
+		return poi.handleWaterQuality(m, &poi.Conductivity, v, NewConductivity(poi.ID(), m.ID, v, m.Timestamp), onchange)
+	case hasAcidity(&m):
+		return poi.handleWaterQuality(m, &poi.PH, *m.Value, NewAcidity(poi.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	case hasGenericSensor(&m) && slices.Contains(poi.TurbiditySensors, m.DeviceID()):
+		return poi.handleWaterQuality(m, &poi.Turbidity, *m.Value, NewTurbidity(poi.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	}
+
+	return nil
+}
+
+func (poi *PointOfInterest) handleTemperature(m Measurement, onchange func(m ValueProvider) error) error {
+	if !poi.inSeason(m.Timestamp) {
+		return outOfSeason(NewTemperature(poi.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	}
+
+	if poi.isBeach() {
+		poi.addTemperature(*m.Value, m.Timestamp)
+		poi.TemperatureTrend = trend(poi.Temperatures)
+	}
+
 	if !hasChanged(poi.Temperature, *m.Value) {
 		return nil
 	}
@@ -59,6 +175,87 @@ func (poi *PointOfInterest) handle(m Measurement, onchange func(m ValueProvider)
 	return nil
 }
 
+func (poi *PointOfInterest) handleWaterQuality(m Measurement, current **float64, value float64, vp ValueProvider, onchange func(m ValueProvider) error) error {
+	if !poi.inSeason(m.Timestamp) {
+		return outOfSeason(vp, onchange)
+	}
+
+	if *current != nil && !hasChanged(**current, value) {
+		return nil
+	}
+
+	err := onchange(vp)
+	if err != nil {
+		return err
+	}
+
+	*current = &value
+
+	return nil
+}
+
+func (poi *PointOfInterest) isBeach() bool {
+	return poi.SubType != nil && strings.EqualFold(*poi.SubType, "Beach")
+}
+
+// inSeason returns true if ts is within the bathing season, points of interest without a season are always in season
+func (poi *PointOfInterest) inSeason(ts time.Time) bool {
+	return poi.BathingSeason == nil || poi.BathingSeason.Contains(ts)
+}
+
+// outOfSeason stores the value of a measurement outside the bathing season, the point of interest is not changed
+func outOfSeason(vp ValueProvider, onchange func(m ValueProvider) error) error {
+	err := onchange(vp)
+	if err != nil {
+		return err
+	}
+	return ErrNotChanged
+}
+
+// addTemperature adds a temperature to the temperatures of the last 24 hours
+func (poi *PointOfInterest) addTemperature(v float64, ts time.Time) {
+	poi.Temperatures = append(poi.Temperatures, Sample{Timestamp: ts.UTC(), Value: v})
+
+	latest := ts
+	for _, s := range poi.Temperatures {
+		if s.Timestamp.After(latest) {
+			latest = s.Timestamp
+		}
+	}
+
+	samples := poi.Temperatures[:0]
+	for _, s := range poi.Temperatures {
+		if latest.Sub(s.Timestamp) <= 24*time.Hour {
+			samples = append(samples, s)
+		}
+	}
+	poi.Temperatures = samples
+}
+
+// trend returns the change per hour of the samples or nil if there are too few samples
+func trend(samples []Sample) *float64 {
+	s, ok := slope(samples)
+	if !ok {
+		return nil
+	}
+
+	s = round(s)
+	return &s
+}
+
+// microSiemensPerCentimetre converts a conductivity to µS/cm, conductivities without a unit are in µS/cm
+func microSiemensPerCentimetre(v float64, unit string) float64 {
+	switch unit {
+	case "S/m":
+		return v * 10000
+	case "mS/m":
+		return v * 10
+	case "mS/cm":
+		return v * 1000
+	}
+	return v
+}
+
 func (poi *PointOfInterest) Byte() []byte {
 	b, _ := json.Marshal(poi)
 	return b
@@ -8,6 +8,20 @@ import (
 	"github.com/diwise/iot-things/internal/app/iot-things/functions"
 )
 
+var PumpingStationURNs = []string{DigitalInputURN}
+
+func init() {
+	Register(Registration{
+		Type: "PumpingStation",
+		Capabilities: Capabilities{
+			URNs:       PumpingStationURNs,
+			Properties: []string{"pumpingObserved", "pumpingObservedAt", "pumpingDuration", "pumpingCumulativeTime"},
+		},
+		Schema: schema(nil),
+		New:    convTo[PumpingStation](),
+	})
+}
+
 type PumpingStation struct {
 	thingImpl
 
@@ -0,0 +1,281 @@
+package things
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Capabilities describes the measurements a thing handles and the properties it computes from them
+type Capabilities struct {
+	URNs       []string
+	Properties []string
+}
+
+// Registration describes a thing type. SubTypes contains the valid subtypes of the type and the
+// capabilities a subtype has in addition to the capabilities of the type.
+type Registration struct {
+	Type string
+	Capabilities
+	SubTypes map[string]Capabilities
+	Schema   map[string]any
+	New      func(b []byte, validURN []string) (Thing, error)
+}
+
+// ErrUnknownType is returned for things of a type that is not registered
+var ErrUnknownType = errors.New("unknown thing type")
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Registration{}
+)
+
+// Register adds a thing type to the registry. Types are registered by each type in an init func.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	key := strings.ToLower(r.Type)
+	if _, ok := registry[key]; ok {
+		panic("thing type [" + r.Type + "] registered twice")
+	}
+
+	registry[key] = r
+}
+
+// Registered returns the registration of a type, the type is case insensitive
+func Registered(thingType string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[strings.ToLower(thingType)]
+	return r, ok
+}
+
+// Registrations returns all registered types, sorted by type
+func Registrations() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	registrations := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		registrations = append(registrations, r)
+	}
+
+	slices.SortFunc(registrations, func(a, b Registration) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+
+	return registrations
+}
+
+// SubType returns the registered name of a subtype, the subtype is case insensitive
+func (r Registration) SubType(subType string) (string, bool) {
+	for s := range r.SubTypes {
+		if strings.EqualFold(s, subType) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// CapabilitiesOf returns the capabilities of the type, including those of the subtype
+func (r Registration) CapabilitiesOf(subType string) Capabilities {
+	c := Capabilities{
+		URNs:       slices.Clone(r.URNs),
+		Properties: slices.Clone(r.Properties),
+	}
+
+	if s, ok := r.SubType(subType); ok {
+		for _, urn := range r.SubTypes[s].URNs {
+			if !slices.Contains(c.URNs, urn) {
+				c.URNs = append(c.URNs, urn)
+			}
+		}
+		c.Properties = append(c.Properties, r.SubTypes[s].Properties...)
+	}
+
+	return c
+}
+
+// Configurable returns the properties of the type that are set when things are created or updated, i.e. the
+// properties in its schema, sorted by name
+func (r Registration) Configurable() []string {
+	p, _ := r.Schema["properties"].(map[string]any)
+
+	properties := make([]string, 0, len(p))
+	for k := range p {
+		properties = append(properties, k)
+	}
+	slices.Sort(properties)
+
+	return properties
+}
+
+// ValidateTypes checks that a type, and its subtypes, are registered
+func ValidateTypes(thingType string, subTypes []string) error {
+	r, ok := Registered(thingType)
+	if !ok {
+		return fmt.Errorf("%w [%s]", ErrUnknownType, thingType)
+	}
+
+	errs := []error{}
+	for _, s := range subTypes {
+		if _, ok := r.SubType(s); !ok {
+			errs = append(errs, fmt.Errorf("unknown subtype [%s] of thing type [%s]", s, r.Type))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type validURNSetter[T any] interface {
+	*T
+	Thing
+	setValidURN(urns []string)
+}
+
+// convTo returns a constructor that unmarshals a thing of type T
+func convTo[T any, PT validURNSetter[T]]() func(b []byte, validURN []string) (Thing, error) {
+	return func(b []byte, validURN []string) (Thing, error) {
+		var t T
+		err := json.Unmarshal(b, &t)
+
+		p := PT(&t)
+		p.setValidURN(validURN)
+
+		return p, err
+	}
+}
+
+var levelConfigProperties = map[string]any{
+	"maxd":   map[string]any{"type": "number", "minimum": 0},
+	"maxl":   map[string]any{"type": "number", "minimum": 0},
+	"meanl":  map[string]any{"type": "number"},
+	"offset": map[string]any{"type": "number"},
+	"angle":  map[string]any{"type": "number", "minimum": 0, "exclusiveMaximum": 90},
+	"tank":   tankSchema,
+}
+
+// tankShape requires the dimensions of a shape of tank
+func tankShape(shape string, dimensions ...string) map[string]any {
+	return map[string]any{
+		"properties": map[string]any{"shape": map[string]any{"const": shape}},
+		"required":   append([]string{"shape"}, dimensions...),
+	}
+}
+
+// tankSchema is the geometry of a tank, as a shape with its dimensions or a table of levels and volumes, used to
+// calculate its volume
+var tankSchema = map[string]any{
+	"type": []string{"object", "null"},
+	"anyOf": []any{
+		map[string]any{"required": []string{"table"}},
+		tankShape("verticalCylinder", "diameter"),
+		tankShape("horizontalCylinder", "diameter", "length"),
+		tankShape("cuboid", "length", "width"),
+		tankShape("cone", "diameter", "height"),
+	},
+	"properties": map[string]any{
+		"shape":    map[string]any{"enum": []string{"verticalCylinder", "horizontalCylinder", "cuboid", "cone"}},
+		"diameter": map[string]any{"type": "number", "exclusiveMinimum": 0},
+		"length":   map[string]any{"type": "number", "exclusiveMinimum": 0},
+		"width":    map[string]any{"type": "number", "exclusiveMinimum": 0},
+		"height":   map[string]any{"type": "number", "exclusiveMinimum": 0},
+		"table": map[string]any{
+			"type":     "array",
+			"minItems": 2,
+			"items": map[string]any{
+				"type":     "object",
+				"required": []string{"level", "volume"},
+				"properties": map[string]any{
+					"level":  map[string]any{"type": "number", "minimum": 0},
+					"volume": map[string]any{"type": "number", "minimum": 0},
+				},
+			},
+		},
+	},
+}
+
+var locationSchema = map[string]any{
+	"type":     "object",
+	"required": []string{"latitude", "longitude"},
+	"properties": map[string]any{
+		"latitude":  map[string]any{"type": "number", "minimum": -90, "maximum": 90},
+		"longitude": map[string]any{"type": "number", "minimum": -180, "maximum": 180},
+	},
+}
+
+// areaSchema is a list of lines, a line is a list of [x, y] points
+var areaSchema = map[string]any{
+	"type": []string{"array", "null"},
+	"items": map[string]any{
+		"type":     "array",
+		"minItems": 2,
+		"items": map[string]any{
+			"type":     "array",
+			"minItems": 2,
+			"maxItems": 2,
+			"items":    map[string]any{"type": "number"},
+		},
+	},
+}
+
+var refDevicesSchema = map[string]any{
+	"type": []string{"array", "null"},
+	"items": map[string]any{
+		"type":     "object",
+		"required": []string{"deviceID"},
+		"properties": map[string]any{
+			"deviceID":     map[string]any{"type": "string", "minLength": 1},
+			"measurements": map[string]any{"type": "object"},
+		},
+	},
+}
+
+// relationsSchema maps relation names to the ids of related things. refParent and hasPart are
+// not relations, a thing is made a part of another thing using refParent.
+var relationsSchema = map[string]any{
+	"type": []string{"object", "null"},
+	"propertyNames": map[string]any{
+		"minLength": 1,
+		"not":       map[string]any{"enum": []string{"refParent", "hasPart"}},
+	},
+	"additionalProperties": map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string", "minLength": 1},
+	},
+}
+
+// schema returns a JSON schema for a thing with the properties common to all things and the properties of the type
+func schema(properties map[string]any) map[string]any {
+	p := map[string]any{
+		"id":              map[string]any{"type": "string", "minLength": 1},
+		"type":            map[string]any{"type": "string", "minLength": 1},
+		"subType":         map[string]any{"type": []string{"string", "null"}},
+		"name":            map[string]any{"type": "string"},
+		"alternativeName": map[string]any{"type": "string"},
+		"description":     map[string]any{"type": "string"},
+		"location":        locationSchema,
+		"area":            areaSchema,
+		"refDevices":      refDevicesSchema,
+		"refParent":       map[string]any{"type": "string"},
+		"relations":       relationsSchema,
+		"tags":            map[string]any{"type": []string{"array", "null"}, "items": map[string]any{"type": "string"}},
+		"tenant":          map[string]any{"type": "string", "minLength": 1},
+	}
+
+	for k, v := range properties {
+		p[k] = v
+	}
+
+	return map[string]any{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"type":       "object",
+		"required":   []string{"id", "type", "tenant"},
+		"properties": p,
+	}
+}
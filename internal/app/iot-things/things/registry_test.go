@@ -0,0 +1,81 @@
+package things
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConvToThingUsesRegistry(t *testing.T) {
+	is := is.New(t)
+
+	thing, err := ConvToThing([]byte(`{"id":"sewer-01","type":"sewer","subType":"CombinedSewerOverflow","tenant":"default","maxd":1.5}`))
+	is.NoErr(err)
+
+	sewer, ok := thing.(*Sewer)
+	is.True(ok)
+	is.Equal(sewer.ValidURN, SewerURNs)
+	is.Equal(*sewer.MaxDistance, 1.5)
+
+	_, err = ConvToThing([]byte(`{"id":"x","type":"Spaceship","tenant":"default"}`))
+	is.Equal(err.Error(), "unknown thing type [Spaceship]")
+}
+
+func TestCapabilitiesOfSubType(t *testing.T) {
+	is := is.New(t)
+
+	r := Registration{
+		Type: "Test",
+		Capabilities: Capabilities{
+			URNs:       []string{TemperatureURN},
+			Properties: []string{"temperature"},
+		},
+		SubTypes: map[string]Capabilities{
+			"Sub": {URNs: []string{TemperatureURN, HumidityURN}, Properties: []string{"humidity"}},
+		},
+	}
+
+	c := r.CapabilitiesOf("sub")
+	is.Equal(c.URNs, []string{TemperatureURN, HumidityURN})
+	is.Equal(c.Properties, []string{"temperature", "humidity"})
+
+	c = r.CapabilitiesOf("")
+	is.Equal(c.URNs, []string{TemperatureURN})
+	is.Equal(len(r.URNs), 1) // capabilities of the type must not be modified
+}
+
+func TestConfigurableProperties(t *testing.T) {
+	is := is.New(t)
+
+	r, ok := Registered("container")
+	is.True(ok)
+
+	configurable := r.Configurable()
+	is.True(slices.Contains(configurable, "maxd"))
+	is.True(slices.Contains(configurable, "area"))
+	is.True(!slices.Contains(configurable, "currentLevel")) // computed from measurements
+	is.True(slices.IsSorted(configurable))
+}
+
+func TestConfiguredTypesAreRegistered(t *testing.T) {
+	is := is.New(t)
+
+	f, err := os.Open("../../../../assets/config/config.yaml")
+	is.NoErr(err)
+	defer f.Close()
+
+	cfg := struct {
+		Types []struct {
+			Type     string   `yaml:"type"`
+			SubTypes []string `yaml:"subTypes"`
+		} `yaml:"types"`
+	}{}
+	is.NoErr(yaml.NewDecoder(f).Decode(&cfg))
+
+	for _, t := range cfg.Types {
+		is.NoErr(ValidateTypes(t.Type, t.SubTypes))
+	}
+}
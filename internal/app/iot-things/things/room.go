@@ -6,12 +6,27 @@ import (
 	"strings"
 )
 
+var RoomURNs = []string{TemperatureURN, HumidityURN, IlluminanceURN, AirQualityURN, PresenceURN}
+
+func init() {
+	Register(Registration{
+		Type: "Room",
+		Capabilities: Capabilities{
+			URNs:       RoomURNs,
+			Properties: []string{"temperature", "humidity", "illuminance", "co2"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Room](),
+	})
+}
+
 type Room struct {
 	thingImpl
-	Temperature float64 `json:"temperature"`
-	Humidity    float64 `json:"humidity"`
-	Illuminance float64 `json:"illuminance"`
-	CO2         float64 `json:"co2"`
+	Temperature float64    `json:"temperature"`
+	Humidity    float64    `json:"humidity"`
+	Illuminance float64    `json:"illuminance"`
+	CO2         float64    `json:"co2"`
+	Occupancy   *Occupancy `json:"occupancy,omitempty"`
 	//Presence    bool    `json:"presence"`
 }
 
@@ -171,6 +186,22 @@ func (r *Room) handleTemperature(m Measurement, onchange func(m ValueProvider) e
 	return nil
 }
 
+// Aggregate counts the desks, and occupied desks, that are parts of the room
+func (r *Room) Aggregate(parts []Thing) bool {
+	occupancy := occupancyOf(parts)
+	if !occupancyChanged(r.Occupancy, occupancy) {
+		return false
+	}
+
+	r.Occupancy = occupancy
+
+	return true
+}
+
+func (r *Room) AggregatedProperties() []string {
+	return []string{"presence"}
+}
+
 func (r *Room) Byte() []byte {
 	b, _ := json.Marshal(r)
 	return b
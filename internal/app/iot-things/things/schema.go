@@ -0,0 +1,153 @@
+package things
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// FieldError is a property of a thing that does not conform to the schema of its type
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Detail  string `json:"detail"`
+}
+
+// ValidationError lists the properties of a thing that do not conform to the schema of its type
+type ValidationError struct {
+	ID     string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		s = append(s, fmt.Sprintf("%s: %s", fe.Pointer, fe.Detail))
+	}
+	return fmt.Sprintf("thing %s is not valid, %s", e.ID, strings.Join(s, ", "))
+}
+
+var (
+	schemasMu sync.Mutex
+	schemas   = map[string]*jsonschema.Schema{}
+	printer   = message.NewPrinter(language.English)
+)
+
+// Validate validates a thing against the JSON schema of its type. Properties that do not conform to
+// the schema are returned as a *ValidationError.
+func Validate(b []byte) error {
+	t := struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}{}
+	err := json.Unmarshal(b, &t)
+	if err != nil {
+		return err
+	}
+
+	r, ok := Registered(t.Type)
+	if !ok {
+		return fmt.Errorf("%w [%s]", ErrUnknownType, t.Type)
+	}
+
+	sch, err := r.compile()
+	if err != nil {
+		return err
+	}
+
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	err = sch.Validate(v)
+	if err == nil {
+		return nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	return &ValidationError{
+		ID:     t.ID,
+		Errors: fieldErrors(ve),
+	}
+}
+
+func (r Registration) compile() (*jsonschema.Schema, error) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	if sch, ok := schemas[r.Type]; ok {
+		return sch, nil
+	}
+
+	// the compiler requires a document as returned by jsonschema.UnmarshalJSON
+	b, err := json.Marshal(r.Schema)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	url := "things/" + strings.ToLower(r.Type) + ".json"
+
+	c := jsonschema.NewCompiler()
+	err = c.AddResource(url, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := c.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas[r.Type] = sch
+
+	return sch, nil
+}
+
+// fieldErrors flattens the causes of a validation error, sorted by pointer
+func fieldErrors(ve *jsonschema.ValidationError) []FieldError {
+	errs := []FieldError{}
+
+	if len(ve.Causes) == 0 {
+		return append(errs, FieldError{
+			Pointer: pointer(ve.InstanceLocation),
+			Detail:  ve.ErrorKind.LocalizedString(printer),
+		})
+	}
+
+	for _, c := range ve.Causes {
+		errs = append(errs, fieldErrors(c)...)
+	}
+
+	slices.SortStableFunc(errs, func(a, b FieldError) int {
+		return strings.Compare(a.Pointer, b.Pointer)
+	})
+
+	return errs
+}
+
+func pointer(location []string) string {
+	r := strings.NewReplacer("~", "~0", "/", "~1")
+
+	p := ""
+	for _, l := range location {
+		p += "/" + r.Replace(l)
+	}
+
+	return p
+}
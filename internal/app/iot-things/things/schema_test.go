@@ -0,0 +1,96 @@
+package things
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+
+	container := NewWasteContainer("container-01", Location{Latitude: 62.39, Longitude: 17.30}, "default")
+	container.AddDevice("device-01")
+	container.AddTag("tag")
+
+	is.NoErr(Validate(container.Byte()))
+}
+
+func TestValidateListsEachInvalidProperty(t *testing.T) {
+	is := is.New(t)
+
+	b := []byte(`{
+		"id": "container-01",
+		"type": "Container",
+		"tenant": "default",
+		"maxd": "high",
+		"angle": 90,
+		"location": {"latitude": "north"},
+		"area": [[[17.3, 62.3]]],
+		"tags": [1],
+		"refDevices": [{"measurements": {}}]
+	}`)
+
+	err := Validate(b)
+
+	var ve *ValidationError
+	is.True(errors.As(err, &ve))
+	is.Equal(ve.ID, "container-01")
+
+	pointers := []string{}
+	for _, fe := range ve.Errors {
+		pointers = append(pointers, fe.Pointer)
+	}
+
+	is.Equal(pointers, []string{"/angle", "/area/0", "/location", "/location/latitude", "/maxd", "/refDevices/0", "/tags/0"})
+}
+
+func TestValidateUsesSchemaOfType(t *testing.T) {
+	is := is.New(t)
+
+	// maxd is part of the schema for containers and sewers only
+	is.NoErr(Validate([]byte(`{"id":"room-01","type":"Room","tenant":"default","maxd":"high"}`)))
+
+	err := Validate([]byte(`{"id":"sewer-01","type":"Sewer","tenant":"default","maxd":"high"}`))
+	is.True(err != nil)
+}
+
+func TestValidateBathingSeason(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(Validate([]byte(`{"id":"beach-01","type":"PointOfInterest","subType":"Beach","tenant":"default","bathingSeason":{"start":"06-01","end":"08-31"}}`)))
+
+	err := Validate([]byte(`{"id":"beach-01","type":"PointOfInterest","subType":"Beach","tenant":"default","bathingSeason":{"start":"June","end":"08-31"}}`))
+	is.True(err != nil)
+}
+
+func TestValidateTank(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(Validate([]byte(`{"id":"sewer-01","type":"Sewer","tenant":"default","tank":{"shape":"cone","diameter":1.2,"height":3}}`)))
+	is.NoErr(Validate([]byte(`{"id":"sewer-01","type":"Sewer","tenant":"default","tank":{"table":[{"level":0,"volume":0},{"level":1,"volume":800}]}}`)))
+
+	is.NoErr(Validate([]byte(`{"id":"sewer-01","type":"Sewer","tenant":"default","tank":null}`)))
+
+	invalid := []string{
+		`{"shape":"sphere"}`,
+		`{}`,
+		`{"shape":"cone","diameter":1}`,
+		`{"shape":"horizontalCylinder","diameter":1}`,
+		`{"table":[{"level":0,"volume":0}]}`,
+	}
+
+	for _, tank := range invalid {
+		err := Validate([]byte(`{"id":"sewer-01","type":"Sewer","tenant":"default","tank":` + tank + `}`))
+		is.True(err != nil) // tank must have a shape with its dimensions or a table
+	}
+}
+
+func TestValidateRainGauge(t *testing.T) {
+	is := is.New(t)
+
+	is.NoErr(Validate([]byte(`{"id":"station-01","type":"WeatherStation","tenant":"default","rainGauge":{"reference":0.2}}`)))
+	is.True(Validate([]byte(`{"id":"station-01","type":"WeatherStation","tenant":"default","rainGauge":{}}`)) != nil)
+	is.True(Validate([]byte(`{"id":"station-01","type":"WeatherStation","tenant":"default","rainGauge":{"reference":0}}`)) != nil)
+}
@@ -8,12 +8,30 @@ import (
 	"github.com/diwise/iot-things/internal/app/iot-things/functions"
 )
 
+var SewerURNs = []string{DistanceURN, DigitalInputURN}
+
+func init() {
+	Register(Registration{
+		Type: "Sewer",
+		Capabilities: Capabilities{
+			URNs:       SewerURNs,
+			Properties: []string{"currentLevel", "percent", "volume", "overflowObserved", "overflowObservedAt", "overflowDuration", "overflowCumulativeTime"},
+		},
+		SubTypes: map[string]Capabilities{
+			"CombinedSewerOverflow": {},
+		},
+		Schema: schema(levelConfigProperties),
+		New:    convTo[Sewer](),
+	})
+}
+
 type Sewer struct {
 	thingImpl
 	functions.LevelConfig
 
-	CurrentLevel float64 `json:"currentLevel"`
-	Percent      float64 `json:"percent"`
+	CurrentLevel float64  `json:"currentLevel"`
+	Percent      float64  `json:"percent"`
+	Volume       *float64 `json:"volume,omitempty"`
 
 	OverflowObserved       bool           `json:"overflowObserved"`
 	OverflowObservedAt     *time.Time     `json:"overflowObservedAt"`
@@ -68,7 +86,18 @@ func (s *Sewer) handleDistance(v Measurement, onchange func(m ValueProvider) err
 	s.CurrentLevel = level.Current()
 	s.Percent = level.Percent()
 
-	return onchange(fillingLevel)
+	err = onchange(fillingLevel)
+	if err != nil {
+		return err
+	}
+
+	// the volume is calculated if the geometry of the sewer well is configured
+	s.Volume = volumeOf(s.ID(), s.Tank, s.CurrentLevel)
+	if s.Volume == nil {
+		return nil
+	}
+
+	return onchange(NewVolume(s.ID(), v.ID, *s.Volume, v.Timestamp))
 }
 
 func (s *Sewer) stopWatch() *functions.Stopwatch {
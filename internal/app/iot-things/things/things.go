@@ -3,11 +3,16 @@ package things
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"slices"
 	"strings"
 	"time"
 )
 
+// ErrNotChanged is returned by Handle if the values of the measurements are stored but the thing itself is not
+// changed, e.g. outside the bathing season of a beach. The thing is then not saved and thing.updated is not published.
+var ErrNotChanged = errors.New("thing is not changed by the measurements")
+
 type Thing interface {
 	ID() string
 	Type() string
@@ -16,16 +21,20 @@ type Thing interface {
 	Handle(m []Measurement, onchange func(m ValueProvider) error) error
 	Byte() []byte
 	Refs() []Device
+	Parent() string
 
 	SetLastObserved(measurements []Measurement)
 	AddDevice(deviceID string)
+	RemoveDevice(deviceID string) bool
 	AddTag(tag string)
 }
 
 type ThingType struct {
-	Type    string `json:"type"`
-	SubType string `json:"subType,omitempty"`
-	Name    string `json:"name"`
+	Type       string   `json:"type"`
+	SubType    string   `json:"subType,omitempty"`
+	Name       string   `json:"name"`
+	URNs       []string `json:"urns,omitempty"`
+	Properties []string `json:"properties,omitempty"`
 }
 
 func newThingImpl(id, t string, l Location, tenant string) thingImpl {
@@ -47,6 +56,8 @@ type thingImpl struct {
 	Location        Location      `json:"location"`
 	Area            *LineSegments `json:"area,omitempty"`
 	RefDevices      []Device      `json:"refDevices,omitempty"`
+	RefParent       string        `json:"refParent,omitempty"`
+	Relations       Relations     `json:"relations,omitempty"`
 	Tags            []string      `json:"tags,omitempty"`
 	Tenant_         string        `json:"tenant"`
 	ObservedAt      time.Time     `json:"observedAt"`
@@ -64,6 +75,10 @@ type Location struct {
 
 var DefaultLocation = Location{Latitude: 0, Longitude: 0}
 
+// Relations are named relations from a thing to other things, e.g. {"servedBy": ["pumpingstation-001"]}.
+// The thing a thing is a part of is its refParent and not a relation.
+type Relations map[string][]string
+
 type Device struct {
 	DeviceID     string                 `json:"deviceID"`
 	Measurements map[string]Measurement `json:"measurements,omitempty"`
@@ -89,9 +104,27 @@ func (t *thingImpl) AddDevice(deviceID string) {
 		t.RefDevices = append(t.RefDevices, Device{DeviceID: deviceID})
 	}
 }
+
+// RemoveDevice removes a connected device and its measurements, it returns false if the device is not connected
+func (t *thingImpl) RemoveDevice(deviceID string) bool {
+	i := slices.IndexFunc(t.RefDevices, func(device Device) bool {
+		return device.DeviceID == deviceID
+	})
+	if i < 0 {
+		return false
+	}
+	t.RefDevices = slices.Delete(t.RefDevices, i, i+1)
+	return true
+}
+func (t *thingImpl) setValidURN(urns []string) {
+	t.ValidURN = urns
+}
 func (t *thingImpl) Refs() []Device {
 	return t.RefDevices
 }
+func (t *thingImpl) Parent() string {
+	return t.RefParent
+}
 
 func (t *thingImpl) AddTag(tag string) {
 	exists := slices.Contains(t.Tags, tag)
@@ -197,6 +230,24 @@ func hasPresence(m *Measurement) bool {
 func hasHumidity(m *Measurement) bool {
 	return m.Urn == HumidityURN && m.Value != nil
 }
+func hasPressure(m *Measurement) bool {
+	return m.Urn == PressureURN && m.Value != nil
+}
+func hasWindSpeed(m *Measurement) bool {
+	return m.Urn == WindSpeedURN && m.Value != nil
+}
+func hasWindDirection(m *Measurement) bool {
+	return m.Urn == WindDirectionURN && m.Value != nil
+}
+func hasConductivity(m *Measurement) bool {
+	return m.Urn == ConductivityURN && m.Value != nil
+}
+func hasAcidity(m *Measurement) bool {
+	return m.Urn == AcidityURN && m.Value != nil
+}
+func hasGenericSensor(m *Measurement) bool {
+	return m.Urn == GenericSensorURN && m.Value != nil
+}
 func hasIlluminance(m *Measurement) bool {
 	return m.Urn == IlluminanceURN && m.Value != nil
 }
@@ -236,64 +287,79 @@ func (m Measurement) DeviceID() string {
 
 func ConvToThing(b []byte) (Thing, error) {
 	t := struct {
-		Type string `json:"type"`
+		Type    string  `json:"type"`
+		SubType *string `json:"subType"`
 	}{}
 	err := json.Unmarshal(b, &t)
 	if err != nil {
 		return nil, err
 	}
 
-	switch strings.ToLower(t.Type) {
-	case "building":
-		building, err := unmarshal[Building](b)
-		building.ValidURN = BuildingURNs
-		return &building, err
-	case "container":
-		c, err := unmarshal[Container](b)
-		c.ValidURN = ContainerURNs
-		return &c, err
-	case "lifebuoy":
-		l, err := unmarshal[Lifebuoy](b)
-		l.ValidURN = LifebuoyURNs
-		return &l, err
-	case "passage":
-		p, err := unmarshal[Passage](b)
-		p.ValidURN = PassageURNs
-		return &p, err
-	case "pointofinterest":
-		poi, err := unmarshal[PointOfInterest](b)
-		poi.ValidURN = PointOfInterestURNs
-		return &poi, err
-	case "pumpingstation":
-		ps, err := unmarshal[PumpingStation](b)
-		ps.ValidURN = PumpingStationURNs
-		return &ps, err
-	case "room":
-		r, err := unmarshal[Room](b)
-		r.ValidURN = RoomURNs
-		return &r, err
-	case "sewer":
-		s, err := unmarshal[Sewer](b)
-		s.ValidURN = SewerURNs
-		return &s, err
-	case "watermeter":
-		l, err := unmarshal[Watermeter](b)
-		l.ValidURN = WaterMeterURNs
-		return &l, err
-	case "desk":
-		d, err := unmarshal[Desk](b)
-		d.ValidURN = DeskURNs
-		return &d, err
-	default:
-		return nil, errors.New("unknown thing type [" + t.Type + "]")
+	r, ok := Registered(t.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w [%s]", ErrUnknownType, t.Type)
+	}
+
+	subType := ""
+	if t.SubType != nil {
+		subType = *t.SubType
 	}
+
+	return r.New(b, r.CapabilitiesOf(subType).URNs)
 }
 
-func unmarshal[T any](b []byte) (T, error) {
-	var m T
-	err := json.Unmarshal(b, &m)
-	if err != nil {
-		return m, err
+// Sample is a value at a point in time
+type Sample struct {
+	Timestamp time.Time `json:"ts"`
+	Value     float64   `json:"v"`
+}
+
+// slope returns the change per hour of a least squares fit of the samples, it returns false if there are too few samples
+func slope(samples []Sample) (float64, bool) {
+	r := regression{}
+	for _, s := range samples {
+		r.add(s)
+	}
+	return r.slope()
+}
+
+// regression is the running sums of a least squares fit of samples, so that the slope can be calculated without
+// keeping the samples. X is the number of hours since Origin, the timestamp of the first sample.
+type regression struct {
+	Origin time.Time `json:"origin"`
+	Latest Sample    `json:"latest"`
+	N      float64   `json:"n"`
+	Sx     float64   `json:"sx"`
+	Sy     float64   `json:"sy"`
+	Sxx    float64   `json:"sxx"`
+	Sxy    float64   `json:"sxy"`
+}
+
+func (r *regression) add(s Sample) {
+	if r.N == 0 {
+		r.Origin = s.Timestamp
 	}
-	return m, nil
+
+	x := s.Timestamp.Sub(r.Origin).Hours()
+
+	r.N++
+	r.Sx += x
+	r.Sy += s.Value
+	r.Sxx += x * x
+	r.Sxy += x * s.Value
+	r.Latest = s
+}
+
+// slope returns the change per hour, it returns false if there are too few samples
+func (r regression) slope() (float64, bool) {
+	if r.N < 2 {
+		return 0, false
+	}
+
+	d := r.N*r.Sxx - r.Sx*r.Sx
+	if d == 0 {
+		return 0, false
+	}
+
+	return (r.N*r.Sxy - r.Sx*r.Sy) / d, true
 }
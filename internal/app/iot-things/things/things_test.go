@@ -1,9 +1,11 @@
 package things
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/diwise/iot-things/internal/app/iot-things/functions"
 	"github.com/matryer/is"
 )
 
@@ -304,3 +306,339 @@ func TestRoom(t *testing.T) {
 
 	is.Equal(room.CO2, 0.5)
 }
+
+func TestRemoveDevice(t *testing.T) {
+	is := is.New(t)
+
+	room := NewRoom("room-001", DefaultLocation, "default")
+	room.AddDevice("device-1")
+	room.AddDevice("device-2")
+
+	is.True(room.RemoveDevice("device-1"))
+	is.True(!room.RemoveDevice("device-1"))
+	is.Equal(len(room.Refs()), 1)
+	is.Equal(room.Refs()[0].DeviceID, "device-2")
+}
+
+func TestParkingSpace(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewParkingSpace("id", Location{Latitude: 62, Longitude: 17}, "default")
+	space := thing.(*ParkingSpace)
+	space.ValidURN = ParkingSpaceURNs
+
+	maxParkingTime := 60
+	space.MaxParkingTime = &maxParkingTime
+
+	midnight := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	presence := func(occupied bool, ts time.Time) []Measurement {
+		return []Measurement{{
+			ID:        "device/3302/5500",
+			Urn:       PresenceURN,
+			BoolValue: &occupied,
+			Timestamp: ts,
+		}}
+	}
+
+	values := []Value{}
+	onchange := func(m ValueProvider) error {
+		values = append(values, m.Values()...)
+		return nil
+	}
+
+	// parked 18:00 the day before
+	err := space.Handle(presence(true, midnight.Add(-6*time.Hour)), onchange)
+	is.NoErr(err)
+	space.SetLastObserved(presence(true, midnight.Add(-6*time.Hour)))
+
+	is.True(space.Occupied)
+	is.Equal(*space.OccupiedSince, midnight.Add(-6*time.Hour))
+	is.Equal(*space.DwellTime, time.Duration(0))
+	is.True(!space.Overstay)
+
+	// still parked 06:00
+	values = []Value{}
+	err = space.Handle(presence(true, midnight.Add(6*time.Hour)), onchange)
+	is.NoErr(err)
+	space.SetLastObserved(presence(true, midnight.Add(6*time.Hour)))
+
+	is.Equal(*space.DwellTime, 12*time.Hour)
+	is.True(space.Overstay)
+	is.Equal(space.Utilisation, 25.0)
+
+	utilisation := []Value{}
+	for _, v := range values {
+		if v.Unit == "%" {
+			utilisation = append(utilisation, v)
+		}
+	}
+
+	is.Equal(len(utilisation), 2) // the day before and today
+	is.Equal(*utilisation[0].Value, 25.0)
+	is.Equal(utilisation[0].Timestamp, midnight.Add(-time.Millisecond))
+	is.Equal(*utilisation[1].Value, 25.0)
+
+	// left 12:00
+	err = space.Handle(presence(false, midnight.Add(12*time.Hour)), onchange)
+	is.NoErr(err)
+
+	is.True(!space.Occupied)
+	is.Equal(space.OccupiedSince, nil)
+	is.Equal(*space.DwellTime, 18*time.Hour)
+	is.Equal(space.Utilisation, 50.0)
+	is.Equal(len(space.OccupiedTime), 1)
+}
+
+func TestWeatherStation(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewWeatherStation("id", Location{Latitude: 62, Longitude: 17}, "default")
+	station := thing.(*WeatherStation)
+	station.RainGauge = &RainGauge{Reference: 0.1}
+
+	ts := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	measurement := func(id, urn, unit string, v float64, ts time.Time) Measurement {
+		return Measurement{ID: id, Urn: urn, Value: &v, Unit: unit, Timestamp: ts}
+	}
+
+	values := map[string]float64{}
+	onchange := func(m ValueProvider) error {
+		for _, v := range m.Values() {
+			values[v.ID] = *v.Value
+		}
+		return nil
+	}
+
+	err := station.Handle([]Measurement{
+		measurement("device/3303/5700", TemperatureURN, "Cel", 5, ts),
+		measurement("device/3304/5700", HumidityURN, "%", 80, ts),
+		measurement("device/3323/5700", PressureURN, "Pa", 101325, ts),
+		measurement("device/3346/5700", WindSpeedURN, "m/s", 10, ts),
+		measurement("device/3332/5705", WindDirectionURN, "deg", 270, ts),
+		measurement("device/3330/5700", DistanceURN, "mm", 98, ts),
+	}, onchange)
+	is.NoErr(err)
+
+	is.Equal(station.Pressure, 1013.25)
+	is.Equal(station.WindDirection, 270.0)
+	is.Equal(station.Precipitation, 2.0)
+	is.Equal(*station.DewPoint, 1.83)
+	is.True(*station.FeelsLike < 0) // wind chill
+
+	is.Equal(values["id/3303/dewPoint"], 1.83)
+	is.Equal(values["id/3303/feelsLike"], *station.FeelsLike)
+	is.Equal(values["id/3323/5700"], 1013.25)
+	is.Equal(values["id/3330/precipitation"], 2.0)
+
+	err = station.Handle([]Measurement{
+		measurement("device/3303/5700", TemperatureURN, "Cel", -2, ts.Add(time.Hour)),
+		measurement("device/3303/5700", TemperatureURN, "Cel", 7, ts.Add(2*time.Hour)),
+	}, onchange)
+	is.NoErr(err)
+
+	is.Equal(station.Today.Date, "2024-01-15")
+	is.Equal(station.Today.Min["temperature"], -2.0)
+	is.Equal(station.Today.Max["temperature"], 7.0)
+
+	// a new day resets the lowest and highest values
+	err = station.Handle([]Measurement{
+		measurement("device/3303/5700", TemperatureURN, "Cel", 3, ts.Add(24*time.Hour)),
+	}, onchange)
+	is.NoErr(err)
+
+	is.Equal(station.Today.Date, "2024-01-16")
+	is.Equal(station.Today.Min["temperature"], 3.0)
+	is.Equal(station.Today.Max["temperature"], 3.0)
+	_, ok := station.Today.Min["humidity"]
+	is.True(!ok)
+
+	// a distance is not precipitation unless the station has a rain gauge
+	station.RainGauge = nil
+	err = station.Handle([]Measurement{
+		measurement("device/3330/5700", DistanceURN, "mm", 90, ts.Add(24*time.Hour)),
+	}, onchange)
+	is.NoErr(err)
+	is.Equal(station.Precipitation, 2.0)
+}
+
+func TestBeach(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewPointOfInterest("id", Location{Latitude: 62, Longitude: 17}, "default")
+	beach := thing.(*PointOfInterest)
+
+	subType := "Beach"
+	beach.SubType = &subType
+	beach.BathingSeason = &BathingSeason{Start: "06-01", End: "08-31"}
+	beach.TurbiditySensors = []string{"turbidity"}
+
+	measurement := func(id, urn, unit string, v float64, ts time.Time) []Measurement {
+		return []Measurement{{ID: id, Urn: urn, Value: &v, Unit: unit, Timestamp: ts}}
+	}
+
+	values := []Value{}
+	onchange := func(m ValueProvider) error {
+		values = append(values, m.Values()...)
+		return nil
+	}
+
+	// outside the season values are stored but the beach is not updated
+	err := beach.Handle(measurement("device/3327/5700", ConductivityURN, "S/m", 0.05, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)), onchange)
+	is.True(errors.Is(err, ErrNotChanged))
+	is.Equal(len(values), 1)
+	is.Equal(beach.Conductivity, nil)
+
+	err = beach.Handle(measurement("device/3303/5700", TemperatureURN, "Cel", 12, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)), onchange)
+	is.True(errors.Is(err, ErrNotChanged))
+	is.Equal(len(values), 2)
+	is.Equal(len(beach.Temperatures), 0)
+
+	ts := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	err = beach.Handle(measurement("device/3327/5700", ConductivityURN, "S/m", 0.05, ts), onchange)
+	is.NoErr(err)
+	err = beach.Handle(measurement("device/3326/5700", AcidityURN, "pH", 7.2, ts), onchange)
+	is.NoErr(err)
+	err = beach.Handle(measurement("turbidity/3300/5700", GenericSensorURN, "NTU", 1.5, ts), onchange)
+	is.NoErr(err)
+	err = beach.Handle(measurement("device/3300/5700", GenericSensorURN, "", 99, ts), onchange)
+	is.NoErr(err) // a generic sensor that is not a turbidity sensor is ignored
+
+	is.Equal(*beach.Conductivity, 500.0) // 0.05 S/m in µS/cm
+	is.Equal(*beach.PH, 7.2)
+	is.Equal(*beach.Turbidity, 1.5)
+
+	// the water is 0.5 degrees warmer each hour
+	for h := range 30 {
+		err = beach.Handle(measurement("device/3303/5700", TemperatureURN, "Cel", 15+0.5*float64(h), ts.Add(time.Duration(h)*time.Hour)), onchange)
+		is.NoErr(err)
+	}
+
+	is.Equal(beach.Temperature, 29.5)
+	is.Equal(*beach.TemperatureTrend, 0.5)
+	is.Equal(len(beach.Temperatures), 25) // the last 24 hours
+}
+
+func TestBathingSeasonInTimeZone(t *testing.T) {
+	is := is.New(t)
+
+	season := BathingSeason{Start: "06-01", End: "08-31", TimeZone: "Europe/Stockholm"}
+
+	// 23:30 UTC on the last of May is half past one on the first of June in Stockholm
+	is.True(season.Contains(time.Date(2024, 5, 31, 23, 30, 0, 0, time.UTC)))
+	is.True(!season.Contains(time.Date(2024, 8, 31, 22, 30, 0, 0, time.UTC)))
+
+	season.TimeZone = ""
+	is.True(!season.Contains(time.Date(2024, 5, 31, 23, 30, 0, 0, time.UTC)))
+}
+
+func TestContainerEmptyingAndForecast(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewContainer("id", Location{Latitude: 62, Longitude: 17}, "default")
+	container := thing.(*Container)
+
+	maxd := 1.0
+	maxl := 1.0
+	container.MaxDistance = &maxd
+	container.MaxLevel = &maxl
+
+	ts := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	values := []Value{}
+	distance := func(v float64, ts time.Time) {
+		err := container.Handle([]Measurement{{ID: "device/3330/5700", Urn: DistanceURN, Value: &v, Timestamp: ts}}, func(m ValueProvider) error {
+			values = append(values, m.Values()...)
+			return nil
+		})
+		is.NoErr(err)
+	}
+
+	// 10 percent each day
+	for d := range 5 {
+		distance(0.9-0.1*float64(d), ts.Add(time.Duration(d)*24*time.Hour))
+	}
+
+	is.Equal(*container.FillRate, 10.0)
+	is.Equal(container.LastEmptiedAt, nil)
+
+	// 50 percent full after 4 days, full after another 5 days
+	fullAt := ts.Add(9 * 24 * time.Hour)
+	is.True(container.PredictedFullAt.Sub(fullAt).Abs() < time.Minute)
+
+	emptiedAt := ts.Add(5 * 24 * time.Hour)
+	distance(0.95, emptiedAt)
+
+	is.Equal(*container.LastEmptiedAt, emptiedAt)
+	is.Equal(container.FillRate, nil) // a single level since the container was emptied
+	is.Equal(container.PredictedFullAt, nil)
+	is.Equal(container.Fill.N, 1.0)
+
+	emptied := values[len(values)-1]
+	is.Equal(emptied.ID, "id/3435/emptied")
+	is.True(*emptied.BoolValue)
+}
+
+func TestContainerVolume(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewContainer("id", Location{Latitude: 62, Longitude: 17}, "default")
+	container := thing.(*Container)
+
+	maxd := 2.0
+	maxl := 2.0
+	diameter := 2.0
+	length := 3.0
+	container.MaxDistance = &maxd
+	container.MaxLevel = &maxl
+	container.Tank = &functions.Tank{Shape: functions.HorizontalCylinder, Diameter: &diameter, Length: &length}
+
+	values := []Value{}
+	distance := func(v float64) {
+		err := container.Handle([]Measurement{{ID: "device/3330/5700", Urn: DistanceURN, Value: &v, Timestamp: time.Now()}}, func(m ValueProvider) error {
+			values = append(values, m.Values()...)
+			return nil
+		})
+		is.NoErr(err)
+	}
+
+	// a horizontal cylinder that is half full
+	distance(1.0)
+	is.Equal(container.Percent, 50.0)
+	is.Equal(*container.Volume, 4712.39) // π * 1² * 3 / 2 m³
+
+	volume := values[len(values)-1]
+	is.Equal(volume.ID, "id/3435/volume")
+	is.Equal(volume.Unit, "l")
+
+	// a table is used instead of the shape
+	container.Tank = &functions.Tank{Table: []functions.VolumePoint{{Level: 0, Volume: 0}, {Level: 1, Volume: 500}, {Level: 2, Volume: 2500}}}
+
+	distance(0.5)
+	is.Equal(*container.Volume, 1500.0)
+}
+
+func TestSewerWithInvalidTankHandlesLevel(t *testing.T) {
+	is := is.New(t)
+
+	thing := NewSewer("id", Location{Latitude: 62, Longitude: 17}, "default")
+	sewer := thing.(*Sewer)
+
+	maxd := 2.0
+	maxl := 2.0
+	diameter := 1.0
+	sewer.MaxDistance = &maxd
+	sewer.MaxLevel = &maxl
+	sewer.Tank = &functions.Tank{Shape: functions.Cone, Diameter: &diameter} // a cone without a height
+
+	v := 1.0
+	err := sewer.Handle([]Measurement{{ID: "device/3330/5700", Urn: DistanceURN, Value: &v, Timestamp: time.Now()}}, func(m ValueProvider) error {
+		return nil
+	})
+
+	is.NoErr(err)
+	is.Equal(sewer.Percent, 50.0)
+	is.Equal(sewer.Volume, nil)
+}
@@ -11,6 +11,7 @@ import (
 const (
 	lwm2mPrefix string = "urn:oma:lwm2m:ext:"
 
+	AcidityURN       string = lwm2mPrefix + "3326"
 	AirQualityURN    string = lwm2mPrefix + "3428"
 	ConductivityURN  string = lwm2mPrefix + "3327"
 	DigitalInputURN  string = lwm2mPrefix + "3200"
@@ -18,28 +19,19 @@ const (
 	DoorURN          string = "urn:oma:lwm2m:x:10351"
 	EnergyURN        string = lwm2mPrefix + "3331"
 	FillingLevelURN  string = lwm2mPrefix + "3435"
+	GenericSensorURN string = lwm2mPrefix + "3300"
 	HumidityURN      string = lwm2mPrefix + "3304"
 	IlluminanceURN   string = lwm2mPrefix + "3301"
 	PeopleCounterURN string = lwm2mPrefix + "3334"
+	PercentageURN    string = lwm2mPrefix + "3320"
 	PowerURN         string = lwm2mPrefix + "3328"
 	PresenceURN      string = lwm2mPrefix + "3302"
 	PressureURN      string = lwm2mPrefix + "3323"
 	StopwatchURN     string = lwm2mPrefix + "3350"
 	TemperatureURN   string = lwm2mPrefix + "3303"
 	WaterMeterURN    string = lwm2mPrefix + "3424"
-)
-
-var (
-	BuildingURNs        = []string{EnergyURN, PowerURN, TemperatureURN}
-	ContainerURNs       = []string{DistanceURN}
-	LifebuoyURNs        = []string{DigitalInputURN, PresenceURN}
-	PassageURNs         = []string{DigitalInputURN}
-	PointOfInterestURNs = []string{TemperatureURN}
-	PumpingStationURNs  = []string{DigitalInputURN}
-	RoomURNs            = []string{TemperatureURN, HumidityURN, IlluminanceURN, AirQualityURN, PresenceURN}
-	SewerURNs           = []string{DistanceURN, DigitalInputURN}
-	WaterMeterURNs      = []string{WaterMeterURN}
-	DeskURNs            = []string{DigitalInputURN, PresenceURN}
+	WindDirectionURN string = lwm2mPrefix + "3332"
+	WindSpeedURN     string = lwm2mPrefix + "3346"
 )
 
 func hasChanged(a, b any) bool {
@@ -87,6 +79,38 @@ func newActualFillingLevel(id, ref string, ts time.Time, value float64) Value {
 	return newValue(id, FillingLevelURN, ref, "m", ts, value)
 }
 
+// Volume is the volume, in litres, of the content of a container or sewer
+type Volume struct {
+	Value Value
+}
+
+func NewVolume(id, ref string, value float64, ts time.Time) Volume {
+	id = fmt.Sprintf("%s/%s/%s", id, "3435", "volume")
+	return Volume{
+		Value: newValue(id, FillingLevelURN, ref, senml.UnitLiter, ts, value),
+	}
+}
+
+func (v Volume) Values() []Value {
+	return []Value{v.Value}
+}
+
+// ContainerEmptied is the event of a container being emptied, it is not a resource of the filling level object
+type ContainerEmptied struct {
+	Value Value
+}
+
+func NewContainerEmptied(id, ref string, ts time.Time) ContainerEmptied {
+	id = fmt.Sprintf("%s/%s/%s", id, "3435", "emptied")
+	return ContainerEmptied{
+		Value: newBoolValue(id, FillingLevelURN, ref, "", ts, true),
+	}
+}
+
+func (c ContainerEmptied) Values() []Value {
+	return []Value{c.Value}
+}
+
 /* --------------------- People Counter --------------------- */
 
 type PeopleCounter struct {
@@ -195,6 +219,158 @@ func (a AirQuality) Values() []Value {
 	return []Value{a.CO2}
 }
 
+/* --------------------- Pressure --------------------- */
+
+type Pressure struct {
+	Value Value
+}
+
+func NewPressure(id, ref string, value float64, ts time.Time) Pressure {
+	id = fmt.Sprintf("%s/%s/%s", id, "3323", "5700")
+	return Pressure{
+		Value: newValue(id, PressureURN, ref, "hPa", ts, value),
+	}
+}
+
+func (p Pressure) Values() []Value {
+	return []Value{p.Value}
+}
+
+/* --------------------- Wind --------------------- */
+
+type WindSpeed struct {
+	Value Value
+}
+
+func NewWindSpeed(id, ref string, value float64, ts time.Time) WindSpeed {
+	id = fmt.Sprintf("%s/%s/%s", id, "3346", "5700")
+	return WindSpeed{
+		Value: newValue(id, WindSpeedURN, ref, "m/s", ts, value),
+	}
+}
+
+func (w WindSpeed) Values() []Value {
+	return []Value{w.Value}
+}
+
+type WindDirection struct {
+	Value Value
+}
+
+func NewWindDirection(id, ref string, value float64, ts time.Time) WindDirection {
+	id = fmt.Sprintf("%s/%s/%s", id, "3332", "5705")
+	return WindDirection{
+		Value: newValue(id, WindDirectionURN, ref, "deg", ts, value),
+	}
+}
+
+func (w WindDirection) Values() []Value {
+	return []Value{w.Value}
+}
+
+/* --------------------- Precipitation --------------------- */
+
+// Precipitation is the amount of rain, in mm, derived from the distance to the water in the collector of a rain gauge
+type Precipitation struct {
+	Value Value
+}
+
+func NewPrecipitation(id, ref string, value float64, ts time.Time) Precipitation {
+	id = fmt.Sprintf("%s/%s/%s", id, "3330", "precipitation")
+	return Precipitation{
+		Value: newValue(id, DistanceURN, ref, "mm", ts, value),
+	}
+}
+
+func (p Precipitation) Values() []Value {
+	return []Value{p.Value}
+}
+
+/* --------------------- Dew Point --------------------- */
+
+// DewPoint is the temperature at which the air is saturated with water vapour, derived from temperature and humidity
+type DewPoint struct {
+	Value Value
+}
+
+func NewDewPoint(id, ref string, value float64, ts time.Time) DewPoint {
+	id = fmt.Sprintf("%s/%s/%s", id, "3303", "dewPoint")
+	return DewPoint{
+		Value: newValue(id, TemperatureURN, ref, "Cel", ts, value),
+	}
+}
+
+func (d DewPoint) Values() []Value {
+	return []Value{d.Value}
+}
+
+/* --------------------- Feels Like --------------------- */
+
+// FeelsLike is the apparent temperature, derived from temperature, humidity and wind speed
+type FeelsLike struct {
+	Value Value
+}
+
+func NewFeelsLike(id, ref string, value float64, ts time.Time) FeelsLike {
+	id = fmt.Sprintf("%s/%s/%s", id, "3303", "feelsLike")
+	return FeelsLike{
+		Value: newValue(id, TemperatureURN, ref, "Cel", ts, value),
+	}
+}
+
+func (f FeelsLike) Values() []Value {
+	return []Value{f.Value}
+}
+
+/* --------------------- Water Quality --------------------- */
+
+// Conductivity is the electrical conductivity of water in µS/cm
+type Conductivity struct {
+	Value Value
+}
+
+func NewConductivity(id, ref string, value float64, ts time.Time) Conductivity {
+	id = fmt.Sprintf("%s/%s/%s", id, "3327", "5700")
+	return Conductivity{
+		Value: newValue(id, ConductivityURN, ref, "µS/cm", ts, value),
+	}
+}
+
+func (c Conductivity) Values() []Value {
+	return []Value{c.Value}
+}
+
+type Acidity struct {
+	Value Value
+}
+
+func NewAcidity(id, ref string, value float64, ts time.Time) Acidity {
+	id = fmt.Sprintf("%s/%s/%s", id, "3326", "5700")
+	return Acidity{
+		Value: newValue(id, AcidityURN, ref, "pH", ts, value),
+	}
+}
+
+func (a Acidity) Values() []Value {
+	return []Value{a.Value}
+}
+
+// Turbidity is the turbidity of water in NTU, measured by a generic sensor
+type Turbidity struct {
+	Value Value
+}
+
+func NewTurbidity(id, ref string, value float64, ts time.Time) Turbidity {
+	id = fmt.Sprintf("%s/%s/%s", id, "3300", "5700")
+	return Turbidity{
+		Value: newValue(id, GenericSensorURN, ref, "NTU", ts, value),
+	}
+}
+
+func (t Turbidity) Values() []Value {
+	return []Value{t.Value}
+}
+
 /* --------------------- Presence --------------------- */
 
 type Presence struct {
@@ -212,6 +388,24 @@ func (d Presence) Values() []Value {
 	return []Value{d.Value}
 }
 
+/* --------------------- Utilisation --------------------- */
+
+// Utilisation is the percentage of a day that a thing has been in use
+type Utilisation struct {
+	Value Value
+}
+
+func NewUtilisation(id, ref string, value float64, ts time.Time) Utilisation {
+	id = fmt.Sprintf("%s/%s/%s", id, "3320", "5700")
+	return Utilisation{
+		Value: newValue(id, PercentageURN, ref, "%", ts, value),
+	}
+}
+
+func (u Utilisation) Values() []Value {
+	return []Value{u.Value}
+}
+
 /* --------------------- Stopwatch --------------------- */
 
 type Stopwatch struct {
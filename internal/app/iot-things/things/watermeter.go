@@ -13,6 +13,20 @@ const (
 	FraudSuffix                string = "/13"
 )
 
+var WaterMeterURNs = []string{WaterMeterURN}
+
+func init() {
+	Register(Registration{
+		Type: "WaterMeter",
+		Capabilities: Capabilities{
+			URNs:       WaterMeterURNs,
+			Properties: []string{"cumulativeVolume", "leakage", "burst", "backflow", "fraud"},
+		},
+		Schema: schema(nil),
+		New:    convTo[Watermeter](),
+	})
+}
+
 type Watermeter struct {
 	thingImpl
 	CumulativeVolume float64 `json:"cumulativeVolume"`
@@ -0,0 +1,245 @@
+package things
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+var WeatherStationURNs = []string{TemperatureURN, HumidityURN, PressureURN, WindSpeedURN, WindDirectionURN, DistanceURN}
+
+func init() {
+	Register(Registration{
+		Type: "WeatherStation",
+		Capabilities: Capabilities{
+			URNs:       WeatherStationURNs,
+			Properties: []string{"temperature", "humidity", "pressure", "windSpeed", "windDirection", "precipitation", "dewPoint", "feelsLike"},
+		},
+		Schema: schema(weatherStationProperties),
+		New:    convTo[WeatherStation](),
+	})
+}
+
+var weatherStationProperties = map[string]any{
+	"rainGauge": map[string]any{
+		"type":     []string{"object", "null"},
+		"required": []string{"reference"},
+		"properties": map[string]any{
+			"reference": map[string]any{"type": "number", "exclusiveMinimum": 0},
+		},
+	},
+}
+
+// WeatherStation is an outdoor station that measures the weather. Pressure is in hPa, wind speed in m/s, wind
+// direction in degrees and precipitation in mm. Precipitation is only measured if the station has a RainGauge.
+// DewPoint and FeelsLike are derived from the measured values and Today has the lowest and highest values of the
+// current day, in UTC.
+type WeatherStation struct {
+	thingImpl
+	RainGauge *RainGauge `json:"rainGauge,omitempty"`
+
+	Temperature   float64          `json:"temperature"`
+	Humidity      float64          `json:"humidity"`
+	Pressure      float64          `json:"pressure"`
+	WindSpeed     float64          `json:"windSpeed"`
+	WindDirection float64          `json:"windDirection"`
+	Precipitation float64          `json:"precipitation"`
+	DewPoint      *float64         `json:"dewPoint,omitempty"`
+	FeelsLike     *float64         `json:"feelsLike,omitempty"`
+	Today         *WeatherExtremes `json:"today,omitempty"`
+}
+
+// RainGauge measures the distance, in m, to the surface of the water in its collector. Reference is the distance to
+// the bottom of the empty collector.
+type RainGauge struct {
+	Reference float64 `json:"reference"`
+}
+
+// precipitation returns the water in the collector, in mm, when the distance to its surface is distance
+func (g RainGauge) precipitation(distance float64) float64 {
+	return round(math.Max(g.Reference-distance, 0) * 1000)
+}
+
+// WeatherExtremes is the lowest and highest value of each property during a day
+type WeatherExtremes struct {
+	Date string             `json:"date"`
+	Min  map[string]float64 `json:"min"`
+	Max  map[string]float64 `json:"max"`
+}
+
+func NewWeatherStation(id string, l Location, tenant string) Thing {
+	return &WeatherStation{
+		thingImpl: newThingImpl(id, "WeatherStation", l, tenant),
+	}
+}
+
+func (ws *WeatherStation) Handle(m []Measurement, onchange func(m ValueProvider) error) error {
+	errs := []error{}
+
+	for _, v := range m {
+		errs = append(errs, ws.handle(v, onchange))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (ws *WeatherStation) handle(m Measurement, onchange func(m ValueProvider) error) error {
+	const SensorValue = "/5700"
+	const CompassDirection = "/5705"
+
+	switch {
+	case hasTemperature(&m) && strings.HasSuffix(m.ID, SensorValue):
+		return ws.handleValue(m, "temperature", &ws.Temperature, *m.Value, NewTemperature(ws.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	case hasHumidity(&m) && strings.HasSuffix(m.ID, SensorValue):
+		return ws.handleValue(m, "humidity", &ws.Humidity, *m.Value, NewHumidity(ws.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	case hasPressure(&m) && strings.HasSuffix(m.ID, SensorValue):
+		hPa := hectoPascal(*m.Value, m.Unit)
+		return ws.handleValue(m, "pressure", &ws.Pressure, hPa, NewPressure(ws.ID(), m.ID, hPa, m.Timestamp), onchange)
+	case hasWindSpeed(&m) && strings.HasSuffix(m.ID, SensorValue):
+		return ws.handleValue(m, "windSpeed", &ws.WindSpeed, *m.Value, NewWindSpeed(ws.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	case hasWindDirection(&m) && strings.HasSuffix(m.ID, CompassDirection):
+		return ws.handleValue(m, "windDirection", &ws.WindDirection, *m.Value, NewWindDirection(ws.ID(), m.ID, *m.Value, m.Timestamp), onchange)
+	case hasDistance(&m) && strings.HasSuffix(m.ID, SensorValue) && ws.RainGauge != nil:
+		mm := ws.RainGauge.precipitation(metre(*m.Value, m.Unit))
+		return ws.handleValue(m, "precipitation", &ws.Precipitation, mm, NewPrecipitation(ws.ID(), m.ID, mm, m.Timestamp), onchange)
+	}
+
+	return nil
+}
+
+func (ws *WeatherStation) handleValue(m Measurement, property string, current *float64, value float64, vp ValueProvider, onchange func(m ValueProvider) error) error {
+	ws.track(property, value, m.Timestamp)
+
+	// the properties are zero until measured, so the first temperature is always reported
+	first := property == "temperature" && ws.FeelsLike == nil
+
+	if !first && !hasChanged(*current, value) {
+		return nil
+	}
+
+	err := onchange(vp)
+	if err != nil {
+		return err
+	}
+
+	*current = value
+
+	switch property {
+	case "temperature", "humidity", "windSpeed":
+		return ws.derive(m, onchange)
+	}
+
+	return nil
+}
+
+// derive reports the dew point and feels like temperature if a temperature has been measured
+func (ws *WeatherStation) derive(m Measurement, onchange func(m ValueProvider) error) error {
+	if !hasTemperature(&m) && ws.FeelsLike == nil {
+		return nil
+	}
+
+	errs := []error{}
+
+	if ws.Humidity > 0 {
+		dp := dewPoint(ws.Temperature, ws.Humidity)
+		if ws.DewPoint == nil || hasChanged(*ws.DewPoint, dp) {
+			errs = append(errs, onchange(NewDewPoint(ws.ID(), m.ID, dp, m.Timestamp)))
+			ws.DewPoint = &dp
+		}
+	}
+
+	fl := feelsLike(ws.Temperature, ws.Humidity, ws.WindSpeed)
+	if ws.FeelsLike == nil || hasChanged(*ws.FeelsLike, fl) {
+		errs = append(errs, onchange(NewFeelsLike(ws.ID(), m.ID, fl, m.Timestamp)))
+		ws.FeelsLike = &fl
+	}
+
+	return errors.Join(errs...)
+}
+
+// track updates the lowest and highest value of a property today. Measurements from earlier days are ignored.
+func (ws *WeatherStation) track(property string, value float64, ts time.Time) {
+	date := startOfDay(ts).Format(time.DateOnly)
+
+	if ws.Today == nil || ws.Today.Date < date {
+		ws.Today = &WeatherExtremes{
+			Date: date,
+			Min:  make(map[string]float64),
+			Max:  make(map[string]float64),
+		}
+	}
+
+	if ws.Today.Date != date {
+		return
+	}
+
+	if v, ok := ws.Today.Min[property]; !ok || value < v {
+		ws.Today.Min[property] = value
+	}
+	if v, ok := ws.Today.Max[property]; !ok || value > v {
+		ws.Today.Max[property] = value
+	}
+}
+
+func (ws *WeatherStation) Byte() []byte {
+	b, _ := json.Marshal(ws)
+	return b
+}
+
+// hectoPascal converts a pressure to hPa, pressures without a unit are in hPa
+func hectoPascal(v float64, unit string) float64 {
+	switch unit {
+	case "Pa":
+		return v / 100
+	case "kPa":
+		return v * 10
+	}
+	return v
+}
+
+// metre converts a distance to m, distances without a unit are in m
+func metre(v float64, unit string) float64 {
+	switch unit {
+	case "mm":
+		return v / 1000
+	case "cm":
+		return v / 100
+	}
+	return v
+}
+
+// dewPoint uses the Magnus formula to calculate the dew point, in °C, from temperature and relative humidity
+func dewPoint(temperature, humidity float64) float64 {
+	const b, c = 17.62, 243.12
+
+	gamma := math.Log(humidity/100) + b*temperature/(c+temperature)
+
+	return round(c * gamma / (b - gamma))
+}
+
+// feelsLike returns the wind chill when it is cold and windy, the heat index when it is hot and humid and the
+// temperature otherwise
+func feelsLike(temperature, humidity, windSpeed float64) float64 {
+	kmh := windSpeed * 3.6
+
+	if temperature <= 10 && kmh > 4.8 {
+		v := math.Pow(kmh, 0.16)
+		return round(13.12 + 0.6215*temperature - 11.37*v + 0.3965*temperature*v)
+	}
+
+	if temperature >= 27 && humidity >= 40 {
+		t := temperature*9/5 + 32
+		rh := humidity
+		hi := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t -
+			0.05481717*rh*rh + 0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		return round((hi - 32) * 5 / 9)
+	}
+
+	return temperature
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,80 @@
+package iotthings
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+)
+
+const (
+	DefaultNumberOfWorkers int = 8
+	DefaultQueueSize       int = 100
+)
+
+type job struct {
+	ctx         context.Context
+	thingID     string
+	measurement things.Measurement
+	done        chan<- struct{}
+}
+
+type handleFunc func(ctx context.Context, thingID string, m things.Measurement)
+
+// workers processes measurements in parallel. Jobs are sharded by thing ID so that all
+// measurements for a thing are handled, in order, by the same worker.
+type workers struct {
+	queues []chan job
+}
+
+func newWorkers(ctx context.Context, n, queueSize int, handle handleFunc) *workers {
+	if n < 1 {
+		n = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	w := &workers{
+		queues: make([]chan job, n),
+	}
+
+	for i := range w.queues {
+		w.queues[i] = make(chan job, queueSize)
+		go w.run(ctx, w.queues[i], handle)
+	}
+
+	return w
+}
+
+func (w *workers) run(ctx context.Context, queue <-chan job, handle handleFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-queue:
+			if j.ctx.Err() == nil {
+				handle(j.ctx, j.thingID, j.measurement)
+			}
+			j.done <- struct{}{}
+		}
+	}
+}
+
+// enqueue blocks while the queue for the thing is full, i.e. callers are slowed down to the pace of the workers
+func (w *workers) enqueue(ctx context.Context, j job) error {
+	queue := w.queues[shard(j.thingID, len(w.queues))]
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case queue <- j:
+		return nil
+	}
+}
+
+func shard(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
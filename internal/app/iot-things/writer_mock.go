@@ -6,7 +6,9 @@ package iotthings
 import (
 	"context"
 	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/messaging-golang/pkg/messaging"
 	"sync"
+	"time"
 )
 
 // Ensure, that ThingsWriterMock does implement ThingsWriter.
@@ -19,16 +21,25 @@ var _ ThingsWriter = &ThingsWriterMock{}
 //
 //		// make and configure a mocked ThingsWriter
 //		mockedThingsWriter := &ThingsWriterMock{
-//			AddThingFunc: func(ctx context.Context, t things.Thing) error {
+//			AddThingFunc: func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 //				panic("mock out the AddThing method")
 //			},
 //			AddValueFunc: func(ctx context.Context, t things.Thing, m things.Value) error {
 //				panic("mock out the AddValue method")
 //			},
-//			DeleteThingFunc: func(ctx context.Context, thingID string) error {
+//			DeleteThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
 //				panic("mock out the DeleteThing method")
 //			},
-//			UpdateThingFunc: func(ctx context.Context, t things.Thing) error {
+//			PurgeDeletedThingsFunc: func(ctx context.Context, deletedBefore time.Time) (int, error) {
+//				panic("mock out the PurgeDeletedThings method")
+//			},
+//			PurgeThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+//				panic("mock out the PurgeThing method")
+//			},
+//			RestoreThingFunc: func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+//				panic("mock out the RestoreThing method")
+//			},
+//			UpdateThingFunc: func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
 //				panic("mock out the UpdateThing method")
 //			},
 //		}
@@ -39,16 +50,25 @@ var _ ThingsWriter = &ThingsWriterMock{}
 //	}
 type ThingsWriterMock struct {
 	// AddThingFunc mocks the AddThing method.
-	AddThingFunc func(ctx context.Context, t things.Thing) error
+	AddThingFunc func(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error
 
 	// AddValueFunc mocks the AddValue method.
 	AddValueFunc func(ctx context.Context, t things.Thing, m things.Value) error
 
 	// DeleteThingFunc mocks the DeleteThing method.
-	DeleteThingFunc func(ctx context.Context, thingID string) error
+	DeleteThingFunc func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
+
+	// PurgeDeletedThingsFunc mocks the PurgeDeletedThings method.
+	PurgeDeletedThingsFunc func(ctx context.Context, deletedBefore time.Time) (int, error)
+
+	// PurgeThingFunc mocks the PurgeThing method.
+	PurgeThingFunc func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
+
+	// RestoreThingFunc mocks the RestoreThing method.
+	RestoreThingFunc func(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error
 
 	// UpdateThingFunc mocks the UpdateThing method.
-	UpdateThingFunc func(ctx context.Context, t things.Thing) error
+	UpdateThingFunc func(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -58,6 +78,8 @@ type ThingsWriterMock struct {
 			Ctx context.Context
 			// T is the t argument value.
 			T things.Thing
+			// Events is the events argument value.
+			Events []messaging.TopicMessage
 		}
 		// AddValue holds details about calls to the AddValue method.
 		AddValue []struct {
@@ -74,6 +96,39 @@ type ThingsWriterMock struct {
 			Ctx context.Context
 			// ThingID is the thingID argument value.
 			ThingID string
+			// Version is the version argument value.
+			Version int64
+			// Events is the events argument value.
+			Events []messaging.TopicMessage
+		}
+		// PurgeDeletedThings holds details about calls to the PurgeDeletedThings method.
+		PurgeDeletedThings []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DeletedBefore is the deletedBefore argument value.
+			DeletedBefore time.Time
+		}
+		// PurgeThing holds details about calls to the PurgeThing method.
+		PurgeThing []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ThingID is the thingID argument value.
+			ThingID string
+			// Version is the version argument value.
+			Version int64
+			// Events is the events argument value.
+			Events []messaging.TopicMessage
+		}
+		// RestoreThing holds details about calls to the RestoreThing method.
+		RestoreThing []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ThingID is the thingID argument value.
+			ThingID string
+			// Version is the version argument value.
+			Version int64
+			// Events is the events argument value.
+			Events []messaging.TopicMessage
 		}
 		// UpdateThing holds details about calls to the UpdateThing method.
 		UpdateThing []struct {
@@ -81,30 +136,39 @@ type ThingsWriterMock struct {
 			Ctx context.Context
 			// T is the t argument value.
 			T things.Thing
+			// Version is the version argument value.
+			Version int64
+			// Events is the events argument value.
+			Events []messaging.TopicMessage
 		}
 	}
-	lockAddThing    sync.RWMutex
-	lockAddValue    sync.RWMutex
-	lockDeleteThing sync.RWMutex
-	lockUpdateThing sync.RWMutex
+	lockAddThing           sync.RWMutex
+	lockAddValue           sync.RWMutex
+	lockDeleteThing        sync.RWMutex
+	lockPurgeDeletedThings sync.RWMutex
+	lockPurgeThing         sync.RWMutex
+	lockRestoreThing       sync.RWMutex
+	lockUpdateThing        sync.RWMutex
 }
 
 // AddThing calls AddThingFunc.
-func (mock *ThingsWriterMock) AddThing(ctx context.Context, t things.Thing) error {
+func (mock *ThingsWriterMock) AddThing(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 	if mock.AddThingFunc == nil {
 		panic("ThingsWriterMock.AddThingFunc: method is nil but ThingsWriter.AddThing was just called")
 	}
 	callInfo := struct {
-		Ctx context.Context
-		T   things.Thing
+		Ctx    context.Context
+		T      things.Thing
+		Events []messaging.TopicMessage
 	}{
-		Ctx: ctx,
-		T:   t,
+		Ctx:    ctx,
+		T:      t,
+		Events: events,
 	}
 	mock.lockAddThing.Lock()
 	mock.calls.AddThing = append(mock.calls.AddThing, callInfo)
 	mock.lockAddThing.Unlock()
-	return mock.AddThingFunc(ctx, t)
+	return mock.AddThingFunc(ctx, t, events...)
 }
 
 // AddThingCalls gets all the calls that were made to AddThing.
@@ -112,12 +176,14 @@ func (mock *ThingsWriterMock) AddThing(ctx context.Context, t things.Thing) erro
 //
 //	len(mockedThingsWriter.AddThingCalls())
 func (mock *ThingsWriterMock) AddThingCalls() []struct {
-	Ctx context.Context
-	T   things.Thing
+	Ctx    context.Context
+	T      things.Thing
+	Events []messaging.TopicMessage
 } {
 	var calls []struct {
-		Ctx context.Context
-		T   things.Thing
+		Ctx    context.Context
+		T      things.Thing
+		Events []messaging.TopicMessage
 	}
 	mock.lockAddThing.RLock()
 	calls = mock.calls.AddThing
@@ -166,21 +232,25 @@ func (mock *ThingsWriterMock) AddValueCalls() []struct {
 }
 
 // DeleteThing calls DeleteThingFunc.
-func (mock *ThingsWriterMock) DeleteThing(ctx context.Context, thingID string) error {
+func (mock *ThingsWriterMock) DeleteThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
 	if mock.DeleteThingFunc == nil {
 		panic("ThingsWriterMock.DeleteThingFunc: method is nil but ThingsWriter.DeleteThing was just called")
 	}
 	callInfo := struct {
 		Ctx     context.Context
 		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
 	}{
 		Ctx:     ctx,
 		ThingID: thingID,
+		Version: version,
+		Events:  events,
 	}
 	mock.lockDeleteThing.Lock()
 	mock.calls.DeleteThing = append(mock.calls.DeleteThing, callInfo)
 	mock.lockDeleteThing.Unlock()
-	return mock.DeleteThingFunc(ctx, thingID)
+	return mock.DeleteThingFunc(ctx, thingID, version, events...)
 }
 
 // DeleteThingCalls gets all the calls that were made to DeleteThing.
@@ -190,10 +260,14 @@ func (mock *ThingsWriterMock) DeleteThing(ctx context.Context, thingID string) e
 func (mock *ThingsWriterMock) DeleteThingCalls() []struct {
 	Ctx     context.Context
 	ThingID string
+	Version int64
+	Events  []messaging.TopicMessage
 } {
 	var calls []struct {
 		Ctx     context.Context
 		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
 	}
 	mock.lockDeleteThing.RLock()
 	calls = mock.calls.DeleteThing
@@ -201,22 +275,150 @@ func (mock *ThingsWriterMock) DeleteThingCalls() []struct {
 	return calls
 }
 
+// PurgeDeletedThings calls PurgeDeletedThingsFunc.
+func (mock *ThingsWriterMock) PurgeDeletedThings(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if mock.PurgeDeletedThingsFunc == nil {
+		panic("ThingsWriterMock.PurgeDeletedThingsFunc: method is nil but ThingsWriter.PurgeDeletedThings was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		DeletedBefore time.Time
+	}{
+		Ctx:           ctx,
+		DeletedBefore: deletedBefore,
+	}
+	mock.lockPurgeDeletedThings.Lock()
+	mock.calls.PurgeDeletedThings = append(mock.calls.PurgeDeletedThings, callInfo)
+	mock.lockPurgeDeletedThings.Unlock()
+	return mock.PurgeDeletedThingsFunc(ctx, deletedBefore)
+}
+
+// PurgeDeletedThingsCalls gets all the calls that were made to PurgeDeletedThings.
+// Check the length with:
+//
+//	len(mockedThingsWriter.PurgeDeletedThingsCalls())
+func (mock *ThingsWriterMock) PurgeDeletedThingsCalls() []struct {
+	Ctx           context.Context
+	DeletedBefore time.Time
+} {
+	var calls []struct {
+		Ctx           context.Context
+		DeletedBefore time.Time
+	}
+	mock.lockPurgeDeletedThings.RLock()
+	calls = mock.calls.PurgeDeletedThings
+	mock.lockPurgeDeletedThings.RUnlock()
+	return calls
+}
+
+// PurgeThing calls PurgeThingFunc.
+func (mock *ThingsWriterMock) PurgeThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+	if mock.PurgeThingFunc == nil {
+		panic("ThingsWriterMock.PurgeThingFunc: method is nil but ThingsWriter.PurgeThing was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
+	}{
+		Ctx:     ctx,
+		ThingID: thingID,
+		Version: version,
+		Events:  events,
+	}
+	mock.lockPurgeThing.Lock()
+	mock.calls.PurgeThing = append(mock.calls.PurgeThing, callInfo)
+	mock.lockPurgeThing.Unlock()
+	return mock.PurgeThingFunc(ctx, thingID, version, events...)
+}
+
+// PurgeThingCalls gets all the calls that were made to PurgeThing.
+// Check the length with:
+//
+//	len(mockedThingsWriter.PurgeThingCalls())
+func (mock *ThingsWriterMock) PurgeThingCalls() []struct {
+	Ctx     context.Context
+	ThingID string
+	Version int64
+	Events  []messaging.TopicMessage
+} {
+	var calls []struct {
+		Ctx     context.Context
+		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
+	}
+	mock.lockPurgeThing.RLock()
+	calls = mock.calls.PurgeThing
+	mock.lockPurgeThing.RUnlock()
+	return calls
+}
+
+// RestoreThing calls RestoreThingFunc.
+func (mock *ThingsWriterMock) RestoreThing(ctx context.Context, thingID string, version int64, events ...messaging.TopicMessage) error {
+	if mock.RestoreThingFunc == nil {
+		panic("ThingsWriterMock.RestoreThingFunc: method is nil but ThingsWriter.RestoreThing was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
+	}{
+		Ctx:     ctx,
+		ThingID: thingID,
+		Version: version,
+		Events:  events,
+	}
+	mock.lockRestoreThing.Lock()
+	mock.calls.RestoreThing = append(mock.calls.RestoreThing, callInfo)
+	mock.lockRestoreThing.Unlock()
+	return mock.RestoreThingFunc(ctx, thingID, version, events...)
+}
+
+// RestoreThingCalls gets all the calls that were made to RestoreThing.
+// Check the length with:
+//
+//	len(mockedThingsWriter.RestoreThingCalls())
+func (mock *ThingsWriterMock) RestoreThingCalls() []struct {
+	Ctx     context.Context
+	ThingID string
+	Version int64
+	Events  []messaging.TopicMessage
+} {
+	var calls []struct {
+		Ctx     context.Context
+		ThingID string
+		Version int64
+		Events  []messaging.TopicMessage
+	}
+	mock.lockRestoreThing.RLock()
+	calls = mock.calls.RestoreThing
+	mock.lockRestoreThing.RUnlock()
+	return calls
+}
+
 // UpdateThing calls UpdateThingFunc.
-func (mock *ThingsWriterMock) UpdateThing(ctx context.Context, t things.Thing) error {
+func (mock *ThingsWriterMock) UpdateThing(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
 	if mock.UpdateThingFunc == nil {
 		panic("ThingsWriterMock.UpdateThingFunc: method is nil but ThingsWriter.UpdateThing was just called")
 	}
 	callInfo := struct {
-		Ctx context.Context
-		T   things.Thing
+		Ctx     context.Context
+		T       things.Thing
+		Version int64
+		Events  []messaging.TopicMessage
 	}{
-		Ctx: ctx,
-		T:   t,
+		Ctx:     ctx,
+		T:       t,
+		Version: version,
+		Events:  events,
 	}
 	mock.lockUpdateThing.Lock()
 	mock.calls.UpdateThing = append(mock.calls.UpdateThing, callInfo)
 	mock.lockUpdateThing.Unlock()
-	return mock.UpdateThingFunc(ctx, t)
+	return mock.UpdateThingFunc(ctx, t, version, events...)
 }
 
 // UpdateThingCalls gets all the calls that were made to UpdateThing.
@@ -224,12 +426,16 @@ func (mock *ThingsWriterMock) UpdateThing(ctx context.Context, t things.Thing) e
 //
 //	len(mockedThingsWriter.UpdateThingCalls())
 func (mock *ThingsWriterMock) UpdateThingCalls() []struct {
-	Ctx context.Context
-	T   things.Thing
+	Ctx     context.Context
+	T       things.Thing
+	Version int64
+	Events  []messaging.TopicMessage
 } {
 	var calls []struct {
-		Ctx context.Context
-		T   things.Thing
+		Ctx     context.Context
+		T       things.Thing
+		Version int64
+		Events  []messaging.TopicMessage
 	}
 	mock.lockUpdateThing.RLock()
 	calls = mock.calls.UpdateThing
@@ -21,6 +21,12 @@ type tenantsContextKey struct {
 
 var allowedTenantsCtxKey = &tenantsContextKey{"allowed-tenants"}
 
+type userContextKey struct {
+	name string
+}
+
+var userCtxKey = &userContextKey{"user"}
+
 var tracer = otel.Tracer("iot-things/authz")
 
 func NewAuthenticator(ctx context.Context, logger *slog.Logger, policies io.Reader) (func(http.Handler) http.Handler, error) {
@@ -113,6 +119,12 @@ func NewAuthenticator(ctx context.Context, logger *slog.Logger, policies io.Read
 				}
 
 				ctx := context.WithValue(r.Context(), allowedTenantsCtxKey, tenants)
+
+				// the user is optional and is only used to record who changed a thing
+				if user, ok := result["user"].(string); ok && user != "" {
+					ctx = WithUser(ctx, user)
+				}
+
 				r = r.WithContext(ctx)
 			}
 
@@ -137,3 +149,19 @@ func GetAllowedTenantsFromContext(ctx context.Context) []string {
 
 	return tenants
 }
+
+// WithUser returns a copy of ctx with the name of the authenticated user
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userCtxKey, user)
+}
+
+// GetUserFromContext extracts the name of the authenticated user, if any, from the provided context
+func GetUserFromContext(ctx context.Context) string {
+	user, ok := ctx.Value(userCtxKey).(string)
+
+	if !ok {
+		return ""
+	}
+
+	return user
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/jackc/pgx/v5"
+)
+
+// attachedDevices returns the devices currently attached to a thing, the row is locked until the transaction ends
+func attachedDevices(ctx context.Context, tx pgx.Tx, thingID string) ([]string, error) {
+	var b []byte
+	err := tx.QueryRow(ctx, `SELECT COALESCE(data->'refDevices', '[]'::jsonb) FROM things WHERE id=@id FOR UPDATE`, pgx.NamedArgs{
+		"id": thingID,
+	}).Scan(&b)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		logging.GetFromContext(ctx).Error("could not execute query", "err", err.Error())
+		return nil, err
+	}
+
+	refs := []things.Device{}
+	err = json.Unmarshal(b, &refs)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		devices = append(devices, ref.DeviceID)
+	}
+
+	return devices, nil
+}
+
+// checkDevices returns app.ErrDeviceAttached if a device, that was not attached to the thing before, is attached to
+// another thing of the same type in the tenant. Devices shared using app.WithSharedDevice are not checked. An advisory
+// lock, held until the transaction ends, is taken for each device so that concurrent writes can not attach the same
+// device to two things.
+func checkDevices(ctx context.Context, tx pgx.Tx, t things.Thing, before []string) error {
+	log := logging.GetFromContext(ctx)
+
+	shared := app.SharedDevicesFromContext(ctx)
+
+	devices := []string{}
+	for _, ref := range t.Refs() {
+		if !slices.Contains(before, ref.DeviceID) && !slices.Contains(shared, ref.DeviceID) && !slices.Contains(devices, ref.DeviceID) {
+			devices = append(devices, ref.DeviceID)
+		}
+	}
+
+	// the locks are always taken in the same order to avoid deadlocks
+	slices.Sort(devices)
+
+	for _, deviceID := range devices {
+		_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(@key, 0));`, pgx.NamedArgs{
+			"key": fmt.Sprintf("%s|%s|%s", t.Tenant(), t.Type(), deviceID),
+		})
+		if err != nil {
+			log.Error("could not lock device", "device_id", deviceID, "err", err.Error())
+			return err
+		}
+
+		ref, _ := json.Marshal([]map[string]string{{"deviceID": deviceID}})
+
+		var attached bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM things
+				WHERE tenant=@tenant AND type=@thing_type AND id<>@id AND deleted_on IS NULL AND data->'refDevices' @> @ref::jsonb)`, pgx.NamedArgs{
+			"tenant":     t.Tenant(),
+			"thing_type": t.Type(),
+			"id":         t.ID(),
+			"ref":        string(ref),
+		}).Scan(&attached)
+		if err != nil {
+			log.Error("could not execute query", "err", err.Error())
+			return err
+		}
+
+		if attached {
+			return app.ErrDeviceAttached
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/iot-things/internal/pkg/auth"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/jackc/pgx/v5"
+)
+
+// thingsAsOf selects the latest version, changed at or before @asof, of each thing from the history. The columns
+// are the same as in things so that the conditions of newQueryThingsParams can be used.
+const thingsAsOf string = `(
+	SELECT DISTINCT ON (id) id, type, location, data, tenant, version, deleted_on
+	FROM things_history
+	WHERE changed_on <= @asof
+	ORDER BY id, version DESC) AS things`
+
+// observedData is the data of a thing, in the column col, without the properties that are changed by every
+// measurement, i.e. internal properties starting with _, observedAt and the measurements of the devices
+func observedData(col string) string {
+	return fmt.Sprintf(`(
+		%[1]s - 'observedAt' - COALESCE((SELECT array_agg(k) FROM jsonb_object_keys(%[1]s) k WHERE left(k, 1) = '_'), '{}'::text[])
+		|| jsonb_build_object('refDevices', (
+			SELECT jsonb_agg(d.value - 'measurements' ORDER BY d.n)
+			FROM jsonb_array_elements(COALESCE(%[1]s->'refDevices', '[]'::jsonb)) WITH ORDINALITY d(value, n))))`, col)
+}
+
+// addToHistory adds the current version of a thing to its history as part of a transaction. The diff is a
+// JSON Merge Patch, of the top level properties, from the previous version in the history. Changes made by
+// measurements are not added if they only change the properties that every measurement changes, see observedData,
+// so that the history does not grow with every value from a sensor.
+func addToHistory(ctx context.Context, tx pgx.Tx, thingID string) error {
+	log := logging.GetFromContext(ctx)
+
+	insert := `
+		INSERT INTO things_history(id, version, type, location, data, tenant, deleted_on, changed_on, source, actor, diff)
+		SELECT t.id, t.version, t.type, t.location, t.data, t.tenant, t.deleted_on, CURRENT_TIMESTAMP, @source, @actor, (
+			SELECT COALESCE(jsonb_object_agg(d.key, d.value), '{}'::jsonb)
+			FROM (
+				SELECT n.key, n.value FROM jsonb_each(t.data) n WHERE (prev.data -> n.key) IS DISTINCT FROM n.value
+				UNION ALL
+				SELECT o.key, 'null'::jsonb FROM jsonb_each(prev.data) o WHERE NOT t.data ? o.key
+			) d)
+		FROM things t
+		LEFT JOIN LATERAL (
+			SELECT h.data FROM things_history h WHERE h.id = t.id ORDER BY h.version DESC LIMIT 1
+		) prev ON true
+		WHERE t.id=@id AND NOT (
+			@source = @measurement::text AND prev.data IS NOT NULL AND ` + observedData("t.data") + ` = ` + observedData("prev.data") + `)
+		ON CONFLICT (id, version) DO NOTHING;`
+
+	var actor *string
+	if user := auth.GetUserFromContext(ctx); user != "" {
+		actor = &user
+	}
+
+	_, err := tx.Exec(ctx, insert, pgx.NamedArgs{
+		"id":          thingID,
+		"source":      app.SourceFromContext(ctx),
+		"measurement": app.SourceMeasurement,
+		"actor":       actor,
+	})
+	if err != nil {
+		log.Error("could not add history entry", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (db database) QueryHistory(ctx context.Context, conditions ...app.ConditionFunc) (app.QueryResult, error) {
+	where, args := newQueryHistoryParams(conditions...)
+	log := logging.GetFromContext(ctx)
+
+	query := fmt.Sprintf(`
+		SELECT id, version, changed_on, source, actor, deleted_on IS NOT NULL, diff, count(*) OVER () AS total
+		FROM things_history %s`, where)
+
+	rows, err := db.conn.Query(ctx, query, args)
+	if err != nil {
+		log.Error("could not execute query", "err", err.Error())
+		return app.QueryResult{}, err
+	}
+
+	var id, source string
+	var actor *string
+	var version, total int64
+	var changedOn time.Time
+	var deleted bool
+	var diff []byte
+
+	data := [][]byte{}
+
+	_, err = pgx.ForEachRow(rows, []any{&id, &version, &changedOn, &source, &actor, &deleted, &diff, &total}, func() error {
+		e := app.HistoryEntry{
+			ThingID:   id,
+			Version:   version,
+			ChangedOn: changedOn.UTC(),
+			Source:    source,
+			Deleted:   deleted,
+			Diff:      json.RawMessage(diff),
+		}
+		if actor != nil {
+			e.Actor = *actor
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		data = append(data, b)
+
+		return nil
+	})
+	if err != nil {
+		return app.QueryResult{}, err
+	}
+
+	return app.QueryResult{
+		Data:       data,
+		Count:      len(data),
+		TotalCount: total,
+		Limit:      args["limit"].(int),
+		Offset:     args["offset"].(int),
+	}, nil
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+	"github.com/diwise/messaging-golang/pkg/messaging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/jackc/pgx/v5"
+)
+
+const thingUpdatedTopic string = "thing.updated"
+
+// outboxLease is how long claimed entries are kept from other relays. Entries not marked as delivered or failed
+// within the lease, e.g. because the relay was stopped, are claimed again when it has passed.
+const outboxLease time.Duration = 1 * time.Minute
+
+// addToOutbox adds events to the outbox as part of a transaction
+func addToOutbox(ctx context.Context, tx pgx.Tx, thingID string, events ...messaging.TopicMessage) error {
+	log := logging.GetFromContext(ctx)
+
+	insert := `INSERT INTO things_outbox(thing_id, topic, content_type, body) VALUES (@thing_id, @topic, @content_type, @body);`
+
+	for _, e := range events {
+		_, err := tx.Exec(ctx, insert, pgx.NamedArgs{
+			"thing_id":     thingID,
+			"topic":        e.TopicName(),
+			"content_type": e.ContentType(),
+			"body":         string(e.Body()),
+		})
+		if err != nil {
+			log.Error("could not add outbox entry", "topic", e.TopicName(), "err", err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPendingOutboxEntries claims, for outboxLease, undelivered entries that are due. An entry is only returned if it
+// could be claimed, i.e. if it was not claimed by a relay in another replica at the same time. Rows with an earlier
+// undelivered row of the same thing that is claimed, or waiting for its next attempt, are not returned.
+func (db database) GetPendingOutboxEntries(ctx context.Context, createdBefore time.Time, limit int) ([]app.OutboxEntry, error) {
+	log := logging.GetFromContext(ctx)
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// undelivered thing.updated rows for a thing are grouped and published as a single event, all other events are published one by one
+	query := `
+		SELECT thing_id, topic, max(id), max(attempts), (array_agg(content_type ORDER BY id DESC))[1], (array_agg(body ORDER BY id DESC))[1]
+		FROM things_outbox o
+		WHERE delivered_on IS NULL AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+		AND NOT EXISTS (
+			SELECT 1 FROM things_outbox e
+			WHERE e.thing_id=o.thing_id AND e.id<o.id AND e.delivered_on IS NULL
+			AND (e.next_attempt_on > CURRENT_TIMESTAMP OR e.locked_until > CURRENT_TIMESTAMP))
+		GROUP BY thing_id, topic, CASE WHEN topic=@thing_updated THEN 0 ELSE id END
+		HAVING min(created_on) < @created_before AND max(next_attempt_on) <= CURRENT_TIMESTAMP
+		ORDER BY min(id) ASC
+		LIMIT @limit;`
+
+	rows, err := tx.Query(ctx, query, pgx.NamedArgs{
+		"thing_updated":  thingUpdatedTopic,
+		"created_before": createdBefore.UTC(),
+		"limit":          limit,
+	})
+	if err != nil {
+		log.Error("could not execute query", "err", err.Error())
+		return nil, err
+	}
+
+	entries := []app.OutboxEntry{}
+
+	var thingID, topic string
+	var id int64
+	var attempts int
+	var contentType *string
+	var body []byte
+
+	_, err = pgx.ForEachRow(rows, []any{&thingID, &topic, &id, &attempts, &contentType, &body}, func() error {
+		e := app.OutboxEntry{
+			ID:       id,
+			ThingID:  thingID,
+			Topic:    topic,
+			Attempts: attempts,
+			Body:     body,
+		}
+		if contentType != nil {
+			e.ContentType = *contentType
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// a row claimed by another relay, since it was selected, is not updated as the lock is checked again once the
+	// other transaction has committed
+	claim := `UPDATE things_outbox SET locked_until=@locked_until WHERE (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP) AND `
+
+	claimed := []app.OutboxEntry{}
+
+	for _, e := range entries {
+		tag, err := tx.Exec(ctx, claim+outboxEntryCondition(e), pgx.NamedArgs{
+			"thing_id":     e.ThingID,
+			"id":           e.ID,
+			"locked_until": time.Now().Add(outboxLease).UTC(),
+		})
+		if err != nil {
+			log.Error("could not claim outbox entry", "err", err.Error())
+			return nil, err
+		}
+		if tag.RowsAffected() > 0 {
+			claimed = append(claimed, e)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+func (db database) MarkOutboxEntryDelivered(ctx context.Context, e app.OutboxEntry) error {
+	log := logging.GetFromContext(ctx)
+
+	update := `UPDATE things_outbox SET delivered_on=CURRENT_TIMESTAMP WHERE ` + outboxEntryCondition(e)
+	_, err := db.conn.Exec(ctx, update, pgx.NamedArgs{
+		"thing_id": e.ThingID,
+		"id":       e.ID,
+	})
+	if err != nil {
+		log.Error("could not execute statement", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (db database) MarkOutboxEntryFailed(ctx context.Context, e app.OutboxEntry, nextAttempt time.Time) error {
+	log := logging.GetFromContext(ctx)
+
+	update := `UPDATE things_outbox SET attempts=attempts+1, next_attempt_on=@next_attempt, locked_until=NULL WHERE ` + outboxEntryCondition(e)
+	_, err := db.conn.Exec(ctx, update, pgx.NamedArgs{
+		"thing_id":     e.ThingID,
+		"id":           e.ID,
+		"next_attempt": nextAttempt.UTC(),
+	})
+	if err != nil {
+		log.Error("could not execute statement", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// outboxEntryCondition matches the rows of an outbox entry, i.e. all grouped thing.updated rows or a single event
+func outboxEntryCondition(e app.OutboxEntry) string {
+	if e.Topic == thingUpdatedTopic {
+		return `thing_id=@thing_id AND topic='thing.updated' AND id<=@id AND delivered_on IS NULL;`
+	}
+	return `id=@id AND delivered_on IS NULL;`
+}
+
+func (db database) DeleteDeliveredOutboxEntries(ctx context.Context, deliveredBefore time.Time) error {
+	log := logging.GetFromContext(ctx)
+
+	_, err := db.conn.Exec(ctx, `DELETE FROM things_outbox WHERE delivered_on < @delivered_before;`, pgx.NamedArgs{
+		"delivered_before": deliveredBefore.UTC(),
+	})
+	if err != nil {
+		log.Error("could not execute statement", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -31,180 +33,278 @@ func newConditions(conditions ...app.ConditionFunc) map[string]any {
 func newQueryThingsParams(conditions ...app.ConditionFunc) (string, pgx.NamedArgs) {
 	c := newConditions(conditions...)
 
-	query := "WHERE deleted_on IS NULL"
-	args := pgx.NamedArgs{}
+	q := newQueryBuilder("deleted_on IS NULL")
+	if _, ok := c["deleted"]; ok {
+		q = newQueryBuilder("deleted_on IS NOT NULL")
+	}
 
 	if id, ok := c["id"]; ok {
-		query += " AND id=@id"
-		args["id"] = id
+		q.where("id=" + q.arg("id", id))
 	}
 
 	if tenants, ok := c["tenants"]; ok {
-		query += " AND tenant=ANY(@tenants)"
-		args["tenants"] = tenants
+		q.where("tenant=ANY(" + q.arg("tenants", tenants) + ")")
 	}
 
 	if types, ok := c["types"]; ok {
-		query += " AND type=ANY(@types)"
-		args["types"] = types
+		q.where("type=ANY(" + q.arg("types", types) + ")")
 	}
 
 	if subType, ok := c["subtype"]; ok {
-		query += " AND data->>'subType'=@sub_type"
-		args["sub_type"] = subType
+		q.where("data->>'subType'=" + q.arg("sub_type", subType))
 	}
 
 	if tags, ok := c["tags"]; ok {
-		query += " AND data ? 'tags' and data->'tags' @> (@tags)"
 		b, _ := json.Marshal(tags)
-		args["tags"] = string(b)
+		q.where("data ? 'tags' AND data->'tags' @> " + q.arg("tags", string(b)) + "::jsonb")
 	}
 
 	if refDevice, ok := c["refdevice"]; ok {
-		query += fmt.Sprintf(` AND data ? 'refDevices' AND data->'refDevices' @> '[{"deviceID": "%s"}]'`, refDevice)
+		b, _ := json.Marshal([]map[string]any{{"deviceID": refDevice}})
+		q.where("data ? 'refDevices' AND data->'refDevices' @> " + q.arg("ref_device", string(b)) + "::jsonb")
 	}
 
-	for k, v := range c {
-		if strings.HasPrefix(k, "<") && strings.HasSuffix(k, ">") {
-			fieldname := k[1 : len(k)-1]
-			s, ok := v.([]string)
-			if !ok {
-				continue
-			}
+	if refParent, ok := c["refparent"]; ok {
+		q.where("data->>'refParent'=" + q.arg("ref_parent", refParent))
+	}
 
-			f, err := strconv.ParseFloat(s[0], 64)
-			if err != nil {
-				continue
-			}
+	if hasPart, ok := c["haspart"]; ok {
+		q.where("id=(SELECT p.data->>'refParent' FROM things p WHERE p.id=" + q.arg("has_part", hasPart) + " AND p.deleted_on IS NULL)")
+	}
 
-			op, opOk := c["operator"]
-			if !opOk {
-				op = "gt"
-			}
+	relation, hasRelation := c["relation"]
+	relatedTo, hasRelatedTo := c["relatedto"]
+	switch {
+	case hasRelation && hasRelatedTo:
+		q.where("data->'relations'->" + q.arg("relation", relation) + " ? " + q.arg("related_to", relatedTo))
+	case hasRelation:
+		q.where("data->'relations' ? " + q.arg("relation", relation))
+	case hasRelatedTo:
+		q.where("EXISTS (SELECT 1 FROM jsonb_each(data->'relations') r WHERE jsonb_typeof(r.value)='array' AND r.value ? " + q.arg("related_to", relatedTo) + ")")
+	}
+
+	if bbox, ok := c["bbox"]; ok {
+		if b, ok := bbox.([]float64); ok && len(b) == 4 {
+			q.where(fmt.Sprintf("location <@ box(point(%s,%s),point(%s,%s))",
+				q.arg("bbox_min_lon", b[0]), q.arg("bbox_min_lat", b[1]), q.arg("bbox_max_lon", b[2]), q.arg("bbox_max_lat", b[3])))
+		}
+	}
+
+	if within, ok := c["within"]; ok {
+		if ring, ok := within.([][]float64); ok {
+			q.where("location <@ " + q.arg("within", polygon(ring)) + "::polygon")
+		}
+	}
+
+	q.order("type ASC, data->>'subType' ASC, data->>'name' ASC")
+
+	if near, ok := c["near"]; ok {
+		if p, ok := near.([]float64); ok && len(p) == 2 {
+			// distance references @near_lat and @near_lon
+			q.args["near_lat"] = p[0]
+			q.args["near_lon"] = p[1]
+
+			if maxDistance, ok := c["maxdistance"]; ok {
+				d := maxDistance.(float64)
 
-			switch op {
-			case "eq":
-				query += fmt.Sprintf(" AND data ? '%s' AND (data->>'%s')::numeric = @%f", fieldname, fieldname, f)
-			case "gt":
-				query += fmt.Sprintf(" AND data ? '%s' AND (data->>'%s')::numeric > @%f", fieldname, fieldname, f)
-			case "lt":
-				query += fmt.Sprintf(" AND data ? '%s' AND (data->>'%s')::numeric < @%f", fieldname, fieldname, f)
-			case "ne":
-				query += fmt.Sprintf(" AND data ? '%s' AND (data->>'%s')::numeric <> @%f", fieldname, fieldname, f)
-			default:
-				query += fmt.Sprintf(" AND data ? '%s' AND (data->>'%s')::numeric > @%f", fieldname, fieldname, f)
+				// use a bounding box around the point as a prefilter so that the location index can be used
+				dLat := d / metresPerDegree
+				cosLat := math.Cos(p[0] * math.Pi / 180.0)
+				if cosLat > 0.01 {
+					dLon := d / (metresPerDegree * cosLat)
+					q.where(fmt.Sprintf("location <@ box(point(%s,%s),point(%s,%s))",
+						q.arg("near_min_lon", p[1]-dLon), q.arg("near_min_lat", p[0]-dLat), q.arg("near_max_lon", p[1]+dLon), q.arg("near_max_lat", p[0]+dLat)))
+				}
+
+				q.where(distance + " <= " + q.arg("max_distance", d))
 			}
 
-			args[fieldname] = f
+			q.order(distance + " ASC")
 		}
 	}
 
-	query += " ORDER BY type ASC, data->>'subType' ASC, data->>'name' ASC"
+	// sort field names so that the query is the same for the same conditions
+	fields := []string{}
+	for k := range c {
+		if strings.HasPrefix(k, "<") && strings.HasSuffix(k, ">") {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
 
-	if offset, ok := c["offset"]; ok {
-		query += " OFFSET @offset"
-		args["offset"] = offset
+	for _, k := range fields {
+		fieldname := k[1 : len(k)-1]
+		s, ok := c[k].([]string)
+		if !ok || len(s) == 0 {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(s[0], 64)
+		if err != nil {
+			continue
+		}
+
+		field := q.arg("field", fieldname)
+		q.where(fmt.Sprintf("data ? %s AND (data->>%s)::numeric %s %s", field, field, operator(c["operator"], ">"), q.arg("field_value", f)))
 	}
 
-	if limit, ok := c["limit"]; ok {
-		query += " LIMIT @limit"
-		args["limit"] = limit
+	q.page(c["offset"], c["limit"])
+
+	query, args := q.build()
+
+	// things are queried as they were at asof, see thingsAsOf
+	if asOf, ok := c["asof"]; ok {
+		args["asof"] = asOf
 	}
 
 	return query, args
 }
 
+func newQueryHistoryParams(conditions ...app.ConditionFunc) (string, pgx.NamedArgs) {
+	c := newConditions(conditions...)
+
+	q := newQueryBuilder()
+
+	if id, ok := c["id"]; ok {
+		q.where("id=" + q.arg("id", id))
+	}
+
+	if tenants, ok := c["tenants"]; ok {
+		q.where("tenant=ANY(" + q.arg("tenants", tenants) + ")")
+	}
+
+	if timerel, ok := c["timerel"]; ok {
+		switch timerel {
+		case "before":
+			q.where("changed_on < " + q.arg("ts", c["timeat"]))
+		case "after":
+			q.where("changed_on > " + q.arg("ts", c["timeat"]))
+		case "between":
+			q.where("changed_on > " + q.arg("ts1", c["timeat"]) + " AND changed_on < " + q.arg("ts2", c["endtimeat"]))
+		}
+	}
+
+	q.order("version ASC")
+	q.page(c["offset"], c["limit"])
+
+	return q.build()
+}
+
+// operator returns the SQL operator for eq, gt, lt or ne, or defaultOp for any other operator
+func operator(op any, defaultOp string) string {
+	switch op {
+	case "eq":
+		return "="
+	case "gt":
+		return ">"
+	case "lt":
+		return "<"
+	case "ne":
+		return "<>"
+	default:
+		return defaultOp
+	}
+}
+
+const metresPerDegree float64 = 111320.0
+
+// distance is the great-circle distance in metres between location (lon,lat) and the point @near_lat,@near_lon
+const distance string = `(2 * 6371008.8 * asin(sqrt(power(sin(radians(location[1] - @near_lat) / 2), 2) + cos(radians(@near_lat)) * cos(radians(location[1])) * power(sin(radians(location[0] - @near_lon) / 2), 2))))`
+
+// polygon formats a ring of [lon, lat] positions as a postgres polygon, i.e. ((lon,lat),(lon,lat),...)
+func polygon(ring [][]float64) string {
+	points := make([]string, 0, len(ring))
+	for _, p := range ring {
+		points = append(points, fmt.Sprintf("(%s,%s)", strconv.FormatFloat(p[0], 'f', -1, 64), strconv.FormatFloat(p[1], 'f', -1, 64)))
+	}
+	return "(" + strings.Join(points, ",") + ")"
+}
+
 func newQueryValuesParams(conditions ...app.ConditionFunc) (string, pgx.NamedArgs) {
 	c := newConditions(conditions...)
 
-	query := "WHERE 1=1"
-	args := pgx.NamedArgs{}
+	q := newQueryBuilder()
 
 	if id, ok := c["id"]; ok {
-		query += " AND id=@id"
-		args["id"] = id
+		q.where("id=" + q.arg("id", id))
 	}
 
 	if thingID, ok := c["thingid"]; ok {
-		query += fmt.Sprintf(" AND id LIKE '%s/%%'", thingID)
+		q.where("id LIKE " + q.arg("thing_id", likePrefix(fmt.Sprintf("%s/", thingID))))
+	}
+
+	// values are only readable if the thing they belong to (the first part of the value id) is in one of the tenants
+	if tenants, ok := c["tenants"]; ok {
+		q.where("EXISTS (SELECT 1 FROM things WHERE things.id=split_part(things_values.id, '/', 1) AND things.tenant=ANY(" + q.arg("tenants", tenants) + "))")
 	}
 
 	if urn, ok := c["urn"]; ok {
-		query += " AND urn=ANY(@urn)"
-		args["urn"] = urn
+		q.where("urn=ANY(" + q.arg("urn", urn) + ")")
 	}
 
 	if timerel, ok := c["timerel"]; ok {
 		switch timerel {
 		case "before":
-			query += " AND time < @ts"
-			args["ts"] = c["timeat"]
+			q.where("time < " + q.arg("ts", c["timeat"]))
 		case "after":
-			query += " AND time > @ts"
-			args["ts"] = c["timeat"]
+			q.where("time > " + q.arg("ts", c["timeat"]))
 		case "between":
-			query += " AND time > @ts1 AND time < @ts2"
-			args["ts1"] = c["timeat"]
-			args["ts2"] = c["endtimeat"]
+			q.where("time > " + q.arg("ts1", c["timeat"]) + " AND time < " + q.arg("ts2", c["endtimeat"]))
 		}
 	}
 
 	if v, ok := c["value"]; ok {
-		op, opOk := c["operator"]
-		if opOk {
-			switch op {
-			case "eq":
-				query += " AND v IS NOT NULL AND v=@v"
-				args["v"] = v
-			case "gt":
-				query += " AND v IS NOT NULL AND v>@v"
-				args["v"] = v
-			case "lt":
-				query += " AND v IS NOT NULL AND v<@v"
-				args["v"] = v
-			case "ne":
-				query += " AND v IS NOT NULL AND v<>@v"
-				args["v"] = v
+		if op, ok := c["operator"]; ok {
+			if o := operator(op, ""); o != "" {
+				q.where("v IS NOT NULL AND v" + o + q.arg("v", v))
 			}
 		}
 	}
 
 	if vb, ok := c["vb"]; ok {
-		query += " AND vb IS NOT NULL AND vb=@vb"
-		args["vb"] = vb
+		q.where("vb IS NOT NULL AND vb=" + q.arg("vb", vb))
 	}
 
 	if ref, ok := c["refdevice"]; ok {
-		query += " AND ref=@ref"
-		args["ref"] = ref
+		q.where("ref=" + q.arg("ref", ref))
 	}
 
 	if n, ok := c["n"]; ok {
-		query += fmt.Sprintf(" AND id LIKE '%%/%s'", n)
+		q.where("id LIKE " + q.arg("n", likeSuffix(fmt.Sprintf("/%s", n))))
 	}
 
-	// if timeunit is present, we are counting rows gouped by timeunit (hour, day)
-	if timeunit, ok := c["timeunit"]; ok {
-		args["timeunit"] = timeunit
-	} else {
-		query += " ORDER BY time ASC"
-
-		if offset, ok := c["offset"]; ok {
-			query += " OFFSET @offset"
-			args["offset"] = offset
+	// if timeunit or aggr is present, we are counting (and aggregating) rows grouped into time buckets
+	_, isAggregate := c["aggr"]
+	if timeunit, ok := c["timeunit"]; ok || isAggregate {
+		if !ok {
+			timeunit = "1 hour"
 		}
-
-		if limit, ok := c["limit"]; ok {
-			query += " LIMIT @limit"
-			args["limit"] = limit
+		q.args["timeunit"] = timeunit
+		q.args["timezone"] = "UTC"
+		if tz, ok := c["timezone"]; ok {
+			q.args["timezone"] = tz
+		}
+		if aggr, ok := c["aggr"]; ok {
+			q.args["aggr"] = aggr
+		}
+		if groupBy, ok := c["groupby"]; ok {
+			q.args["groupby"] = groupBy
 		}
+	} else {
+		q.order("time ASC")
+		q.page(c["offset"], c["limit"])
 	}
 
+	query, args := q.build()
+
 	if _, ok := c["showlatest"]; ok {
 		if thingID, ok := c["thingid"]; ok {
 			args["showlatest"] = true
 			args["thingid"] = fmt.Sprintf("%s", thingID)
-		}		
+			if tenants, ok := c["tenants"]; ok {
+				args["tenants"] = tenants
+			}
+		}
 	}
 
 	return query, args
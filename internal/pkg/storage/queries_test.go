@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	app "github.com/diwise/iot-things/internal/app/iot-things"
+)
+
+const hostile string = `x'"}]'; DROP TABLE things; --%_\`
+
+func TestNewQueryThingsParams(t *testing.T) {
+	tests := map[string]struct {
+		conditions []app.ConditionFunc
+		query      string
+		args       map[string]any
+	}{
+		"none": {
+			query: "WHERE deleted_on IS NULL ORDER BY type ASC, data->>'subType' ASC, data->>'name' ASC OFFSET @offset LIMIT @limit",
+			args:  map[string]any{"offset": 0, "limit": 100},
+		},
+		"id": {
+			conditions: []app.ConditionFunc{app.WithID(hostile)},
+			query:      "AND id=@id ",
+			args:       map[string]any{"id": hostile},
+		},
+		"tenants": {
+			conditions: []app.ConditionFunc{app.WithTenants([]string{hostile})},
+			query:      "AND tenant=ANY(@tenants)",
+		},
+		"types": {
+			conditions: []app.ConditionFunc{app.WithTypes([]string{hostile})},
+			query:      "AND type=ANY(@types)",
+		},
+		"subtype": {
+			conditions: []app.ConditionFunc{app.WithSubType(hostile)},
+			query:      "AND data->>'subType'=@sub_type",
+			args:       map[string]any{"sub_type": hostile},
+		},
+		"tags": {
+			conditions: []app.ConditionFunc{app.WithTags([]string{hostile})},
+			query:      "AND data ? 'tags' AND data->'tags' @> @tags::jsonb",
+			args:       map[string]any{"tags": `["x'\"}]'; DROP TABLE things; --%_\\"]`},
+		},
+		"refdevice": {
+			conditions: []app.ConditionFunc{app.WithRefDevice(hostile)},
+			query:      "AND data ? 'refDevices' AND data->'refDevices' @> @ref_device::jsonb",
+			args:       map[string]any{"ref_device": `[{"deviceID":"x'\"}]'; DROP TABLE things; --%_\\"}]`},
+		},
+		"refparent": {
+			conditions: []app.ConditionFunc{app.WithRefParent(hostile)},
+			query:      "AND data->>'refParent'=@ref_parent",
+			args:       map[string]any{"ref_parent": hostile},
+		},
+		"haspart": {
+			conditions: []app.ConditionFunc{app.WithHasPart(hostile)},
+			query:      "AND id=(SELECT p.data->>'refParent' FROM things p WHERE p.id=@has_part AND p.deleted_on IS NULL)",
+			args:       map[string]any{"has_part": hostile},
+		},
+		"relation": {
+			conditions: []app.ConditionFunc{app.WithRelation(hostile, "")},
+			query:      "AND data->'relations' ? @relation",
+			args:       map[string]any{"relation": hostile},
+		},
+		"relation to thing": {
+			conditions: []app.ConditionFunc{app.WithRelation("servedBy", hostile)},
+			query:      "AND data->'relations'->@relation ? @related_to",
+			args:       map[string]any{"relation": "servedBy", "related_to": hostile},
+		},
+		"related to thing": {
+			conditions: []app.ConditionFunc{app.WithRelation("", hostile)},
+			query:      "r.value ? @related_to)",
+			args:       map[string]any{"related_to": hostile},
+		},
+		"paging": {
+			conditions: []app.ConditionFunc{app.WithOffset(10), app.WithLimit(5)},
+			query:      "OFFSET @offset LIMIT @limit",
+			args:       map[string]any{"offset": 10, "limit": 5},
+		},
+		"bbox": {
+			conditions: []app.ConditionFunc{app.WithBBox("17.0,62.0,18.0,63.0")},
+			query:      "AND location <@ box(point(@bbox_min_lon,@bbox_min_lat),point(@bbox_max_lon,@bbox_max_lat))",
+			args:       map[string]any{"bbox_min_lon": 17.0, "bbox_max_lat": 63.0},
+		},
+		"bbox with hostile input": {
+			conditions: []app.ConditionFunc{app.WithBBox(hostile)},
+			query:      "WHERE deleted_on IS NULL ORDER BY",
+		},
+		"within": {
+			conditions: []app.ConditionFunc{app.WithinPolygon(`{"type":"Polygon","coordinates":[[[17,62],[18,62],[18,63],[17,62]]]}`)},
+			query:      "AND location <@ @within::polygon",
+			args:       map[string]any{"within": "((17,62),(18,62),(18,63),(17,62))"},
+		},
+		"near": {
+			conditions: []app.ConditionFunc{app.WithNear("62.39,17.30"), app.WithMaxDistance("500")},
+			query:      "<= @max_distance ORDER BY (2 * 6371008.8",
+			args:       map[string]any{"near_lat": 62.39, "near_lon": 17.30, "max_distance": 500.0},
+		},
+		"field value": {
+			conditions: []app.ConditionFunc{app.WithFieldNameValue("maxd", []string{"0.5"}), app.WithOperator("lt")},
+			query:      "AND data ? @field AND (data->>@field)::numeric < @field_value",
+			args:       map[string]any{"field": "maxd", "field_value": 0.5},
+		},
+		"field value with hostile field name": {
+			conditions: []app.ConditionFunc{app.WithFieldNameValue(hostile, []string{"1"})},
+			query:      "AND data ? @field AND (data->>@field)::numeric > @field_value",
+			args:       map[string]any{"field": hostile, "field_value": 1.0},
+		},
+		"field value with hostile value": {
+			conditions: []app.ConditionFunc{app.WithFieldNameValue("maxd", []string{hostile})},
+			query:      "WHERE deleted_on IS NULL ORDER BY",
+		},
+		"deleted": {
+			conditions: []app.ConditionFunc{app.WithDeleted(true)},
+			query:      "WHERE deleted_on IS NOT NULL ORDER BY",
+		},
+		"not deleted": {
+			conditions: []app.ConditionFunc{app.WithDeleted(false)},
+			query:      "WHERE deleted_on IS NULL ORDER BY",
+		},
+		"as of": {
+			conditions: []app.ConditionFunc{app.WithAsOf("2024-03-01T11:00:00Z")},
+			query:      "WHERE deleted_on IS NULL ORDER BY",
+			args:       map[string]any{"asof": time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)},
+		},
+		"as of with hostile input": {
+			conditions: []app.ConditionFunc{app.WithAsOf(hostile)},
+			query:      "WHERE deleted_on IS NULL ORDER BY",
+			args:       map[string]any{"asof": nil},
+		},
+		"several field values": {
+			conditions: []app.ConditionFunc{app.WithFieldNameValue("a", []string{"1"}), app.WithFieldNameValue("b", []string{"2"}), app.WithOperator("eq")},
+			query:      "AND data ? @field AND (data->>@field)::numeric = @field_value AND data ? @field_1 AND (data->>@field_1)::numeric = @field_value_1",
+			args:       map[string]any{"field": "a", "field_value": 1.0, "field_1": "b", "field_value_1": 2.0},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			query, args := newQueryThingsParams(tc.conditions...)
+
+			if !strings.Contains(query, tc.query) {
+				t.Errorf("expected %q in %q", tc.query, query)
+			}
+			if strings.Contains(query, "DROP TABLE") {
+				t.Errorf("input written to query %q", query)
+			}
+			for k, v := range tc.args {
+				if args[k] != v {
+					t.Errorf("expected %s to be %v, was %v", k, v, args[k])
+				}
+			}
+		})
+	}
+}
+
+func TestNewQueryValuesParams(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		conditions []app.ConditionFunc
+		query      string
+		args       map[string]any
+	}{
+		"none": {
+			query: "ORDER BY time ASC OFFSET @offset LIMIT @limit",
+			args:  map[string]any{"offset": 0, "limit": 100},
+		},
+		"id": {
+			conditions: []app.ConditionFunc{app.WithID(hostile)},
+			query:      "WHERE id=@id ",
+			args:       map[string]any{"id": hostile},
+		},
+		"thingid": {
+			conditions: []app.ConditionFunc{app.WithThingID(hostile)},
+			query:      "WHERE id LIKE @thing_id ",
+			args:       map[string]any{"thing_id": `x'"}]'; DROP TABLE things; --\%\_\\/%`},
+		},
+		"tenants": {
+			conditions: []app.ConditionFunc{app.WithTenants([]string{hostile})},
+			query:      "things.tenant=ANY(@tenants))",
+		},
+		"urn": {
+			conditions: []app.ConditionFunc{app.WithUrn([]string{hostile})},
+			query:      "WHERE urn=ANY(@urn)",
+		},
+		"before": {
+			conditions: []app.ConditionFunc{app.WithTimeRel("before"), app.WithTimeAt(ts.Format(time.RFC3339))},
+			query:      "WHERE time < @ts ",
+			args:       map[string]any{"ts": ts},
+		},
+		"after": {
+			conditions: []app.ConditionFunc{app.WithTimeRel("after"), app.WithTimeAt(ts.Format(time.RFC3339))},
+			query:      "WHERE time > @ts ",
+		},
+		"between": {
+			conditions: []app.ConditionFunc{app.WithTimeRel("between"), app.WithTimeAt(ts.Format(time.RFC3339)), app.WithEndTimeAt(ts.Add(time.Hour).Format(time.RFC3339))},
+			query:      "WHERE time > @ts1 AND time < @ts2 ",
+			args:       map[string]any{"ts1": ts, "ts2": ts.Add(time.Hour)},
+		},
+		"value": {
+			conditions: []app.ConditionFunc{app.WithValue("3.5"), app.WithOperator("ne")},
+			query:      "WHERE v IS NOT NULL AND v<>@v ",
+			args:       map[string]any{"v": 3.5},
+		},
+		"value with hostile operator": {
+			conditions: []app.ConditionFunc{app.WithValue("3.5"), app.WithOperator(hostile)},
+			query:      "ORDER BY time ASC",
+		},
+		"vb": {
+			conditions: []app.ConditionFunc{app.WithBoolValue("true")},
+			query:      "WHERE vb IS NOT NULL AND vb=@vb ",
+			args:       map[string]any{"vb": true},
+		},
+		"refdevice": {
+			conditions: []app.ConditionFunc{app.WithRefDevice(hostile)},
+			query:      "WHERE ref=@ref ",
+			args:       map[string]any{"ref": hostile},
+		},
+		"n": {
+			conditions: []app.ConditionFunc{app.WithValueName(hostile)},
+			query:      "WHERE id LIKE @n ",
+			args:       map[string]any{"n": `%/x'"}]'; DROP TABLE things; --\%\_\\`},
+		},
+		"timeunit": {
+			conditions: []app.ConditionFunc{app.WithThingID("room-001"), app.WithTimeUnit("day")},
+			query:      "WHERE id LIKE @thing_id",
+			args:       map[string]any{"timeunit": "1 day", "timezone": "UTC"},
+		},
+		"timeunit with hostile input": {
+			conditions: []app.ConditionFunc{app.WithTimeUnit(hostile), app.WithTimeZone(hostile)},
+			query:      "ORDER BY time ASC",
+		},
+		"showlatest": {
+			conditions: []app.ConditionFunc{app.WithThingID(hostile), app.WithShowLatest(true)},
+			query:      "WHERE id LIKE @thing_id ",
+			args:       map[string]any{"showlatest": true, "thingid": hostile},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			query, args := newQueryValuesParams(tc.conditions...)
+
+			if !strings.Contains(query, tc.query) {
+				t.Errorf("expected %q in %q", tc.query, query)
+			}
+			if strings.Contains(query, "DROP TABLE") {
+				t.Errorf("input written to query %q", query)
+			}
+			for k, v := range tc.args {
+				if args[k] != v {
+					t.Errorf("expected %s to be %v, was %v", k, v, args[k])
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"room-001":  "room-001",
+		"50%":       `50\%`,
+		"a_b":       `a\_b`,
+		`back\path`: `back\\path`,
+	}
+
+	for s, expected := range tests {
+		if escapeLike(s) != expected {
+			t.Errorf("expected %s, got %s", expected, escapeLike(s))
+		}
+	}
+}
+
+func TestNewQueryHistoryParams(t *testing.T) {
+	tests := map[string]struct {
+		conditions []app.ConditionFunc
+		query      string
+		args       map[string]any
+	}{
+		"none": {
+			query: "ORDER BY version ASC OFFSET @offset LIMIT @limit",
+			args:  map[string]any{"offset": 0, "limit": 100},
+		},
+		"id and tenants": {
+			conditions: []app.ConditionFunc{app.WithID(hostile), app.WithTenants([]string{hostile})},
+			query:      "WHERE id=@id AND tenant=ANY(@tenants) ",
+			args:       map[string]any{"id": hostile},
+		},
+		"between": {
+			conditions: []app.ConditionFunc{app.WithTimeRel("between"), app.WithTimeAt("2024-01-01T00:00:00Z"), app.WithEndTimeAt("2024-02-01T00:00:00Z")},
+			query:      "WHERE changed_on > @ts1 AND changed_on < @ts2 ",
+			args:       map[string]any{"ts1": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "ts2": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			query, args := newQueryHistoryParams(tc.conditions...)
+
+			if !strings.Contains(query, tc.query) {
+				t.Errorf("expected %q in %q", tc.query, query)
+			}
+			for k, v := range tc.args {
+				if args[k] != v {
+					t.Errorf("expected %s to be %v, was %v", k, v, args[k])
+				}
+			}
+		})
+	}
+}
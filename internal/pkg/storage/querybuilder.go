@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queryBuilder builds the WHERE, ORDER BY, OFFSET and LIMIT clauses of a query. Values are never written
+// to the query itself, they are added as named arguments and referenced by their placeholders.
+type queryBuilder struct {
+	conditions []string
+	orderBy    string
+	paging     string
+	args       pgx.NamedArgs
+}
+
+func newQueryBuilder(conditions ...string) *queryBuilder {
+	return &queryBuilder{
+		conditions: conditions,
+		args:       pgx.NamedArgs{},
+	}
+}
+
+// arg adds a named argument and returns its placeholder, i.e. @name. If name is already taken a
+// suffix is added, so that conditions for e.g. several fields can use the same name.
+func (q *queryBuilder) arg(name string, value any) string {
+	key := name
+	for i := 1; ; i++ {
+		if _, ok := q.args[key]; !ok {
+			break
+		}
+		key = fmt.Sprintf("%s_%d", name, i)
+	}
+
+	q.args[key] = value
+	return "@" + key
+}
+
+// where adds a condition, the condition must only reference values through placeholders returned by arg
+func (q *queryBuilder) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *queryBuilder) order(orderBy string) {
+	q.orderBy = orderBy
+}
+
+func (q *queryBuilder) page(offset, limit any) {
+	q.paging = fmt.Sprintf(" OFFSET %s LIMIT %s", q.arg("offset", offset), q.arg("limit", limit))
+}
+
+func (q *queryBuilder) build() (string, pgx.NamedArgs) {
+	query := ""
+
+	if len(q.conditions) > 0 {
+		query = "WHERE " + strings.Join(q.conditions, " AND ")
+	}
+
+	if q.orderBy != "" {
+		query += " ORDER BY " + q.orderBy
+	}
+
+	query += q.paging
+
+	return strings.TrimSpace(query), q.args
+}
+
+// likePrefix escapes s for use in a LIKE pattern matching values that start with s
+func likePrefix(s string) string {
+	return escapeLike(s) + "%"
+}
+
+// likeSuffix escapes s for use in a LIKE pattern matching values that end with s
+func likeSuffix(s string) string {
+	return "%" + escapeLike(s)
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"slices"
 	"time"
 
 	app "github.com/diwise/iot-things/internal/app/iot-things"
 	"github.com/diwise/iot-things/internal/app/iot-things/things"
+	"github.com/diwise/messaging-golang/pkg/messaging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -19,11 +19,22 @@ import (
 
 type database struct {
 	pool *pgxpool.Pool
+	conn dbConn
+}
+
+// dbConn is implemented by both the pool and a transaction, so that the same queries can be used in a transaction
+type dbConn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
 type Storage interface {
 	app.ThingsReader
 	app.ThingsWriter
+	app.ThingsOutbox
+	app.ThingsTransactor
 	Close()
 }
 
@@ -40,6 +51,7 @@ func New(ctx context.Context, cfg Config) (Storage, error) {
 
 	return database{
 		pool: p,
+		conn: p,
 	}, nil
 }
 
@@ -47,6 +59,36 @@ func (db database) Close() {
 	db.pool.Close()
 }
 
+// InTransaction calls fn with a reader and writer that read and write in a single transaction. Each change made
+// by the writer is a savepoint, so that a failed change does not abort the transaction. Reads are not, i.e. a failed
+// read aborts the transaction and all following reads and writes fail. The transaction is committed if fn returns
+// nil, otherwise it is rolled back.
+func (db database) InTransaction(ctx context.Context, fn func(r app.ThingsReader, w app.ThingsWriter) error) error {
+	log := logging.GetFromContext(ctx)
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txdb := database{pool: db.pool, conn: tx}
+
+	err = fn(txdb, txdb)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
 func initialize(ctx context.Context, pool *pgxpool.Pool) error {
 	log := logging.GetFromContext(ctx)
 
@@ -79,6 +121,55 @@ func initialize(ctx context.Context, pool *pgxpool.Pool) error {
 			created_on  timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,			
 			UNIQUE ("time", "id"));
 
+		CREATE INDEX IF NOT EXISTS things_values_thing_idx ON things_values (split_part(id, '/', 1), time DESC);
+
+
+		CREATE TABLE IF NOT EXISTS things_outbox (
+			id 				BIGSERIAL,
+			thing_id 		TEXT NOT NULL,
+			attempts 		INTEGER NOT NULL DEFAULT 0,
+			created_on 		timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			next_attempt_on timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_on 	timestamp with time zone NULL,
+			PRIMARY KEY (id)
+		);
+
+		CREATE INDEX IF NOT EXISTS things_outbox_pending_idx ON things_outbox (thing_id, id) WHERE delivered_on IS NULL;
+
+		ALTER TABLE things_outbox ADD COLUMN IF NOT EXISTS topic TEXT NOT NULL DEFAULT 'thing.updated';
+		ALTER TABLE things_outbox ADD COLUMN IF NOT EXISTS content_type TEXT NULL;
+		ALTER TABLE things_outbox ADD COLUMN IF NOT EXISTS body JSONB NULL;
+		ALTER TABLE things_outbox ADD COLUMN IF NOT EXISTS locked_until timestamp with time zone NULL;
+
+		ALTER TABLE things ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+		CREATE INDEX IF NOT EXISTS thing_ref_parent_idx ON things ((data->>'refParent'));
+		CREATE INDEX IF NOT EXISTS thing_ref_devices_idx ON things USING GIN ((data->'refDevices') jsonb_path_ops);
+
+		CREATE TABLE IF NOT EXISTS things_history (
+			id		 	TEXT 	NOT NULL,
+			version 	BIGINT 	NOT NULL,
+			type 		TEXT 	NOT NULL,
+			location 	POINT 	NULL,
+			data 		JSONB	NULL,
+			tenant		TEXT 	NOT NULL,
+			deleted_on 	timestamp with time zone NULL,
+			changed_on 	timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			source 		TEXT 	NOT NULL,
+			actor 		TEXT 	NULL,
+			diff 		JSONB 	NULL,
+			PRIMARY KEY (id, version)
+		);
+
+		CREATE INDEX IF NOT EXISTS things_history_changed_on_idx ON things_history (changed_on, id);
+
+		-- things created before the history was added get their current version as the first entry. This is only done
+		-- once, when the history is empty, since every change of a thing is added to the history after that.
+		INSERT INTO things_history(id, version, type, location, data, tenant, deleted_on, changed_on, source, diff)
+		SELECT id, version, type, location, data, tenant, deleted_on, COALESCE(deleted_on, modified_on), 'migration', data
+		FROM things
+		WHERE NOT EXISTS (SELECT 1 FROM things_history)
+		ON CONFLICT (id, version) DO NOTHING;
 
 		DO $$
 		DECLARE
@@ -130,13 +221,25 @@ func connect(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
 	return conn, err
 }
 
-func (db database) AddThing(ctx context.Context, t things.Thing) error {
+func (db database) AddThing(ctx context.Context, t things.Thing, events ...messaging.TopicMessage) error {
 	log := logging.GetFromContext(ctx)
 
 	lat, lon := t.LatLon()
 
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = checkDevices(ctx, tx, t, nil)
+	if err != nil {
+		return err
+	}
+
 	insert := `INSERT INTO things(id, type, location, data, tenant) VALUES (@id, @thing_type, point(@lon,@lat), @data, @tenant);`
-	_, err := db.pool.Exec(ctx, insert, pgx.NamedArgs{
+	_, err = tx.Exec(ctx, insert, pgx.NamedArgs{
 		"id":         t.ID(),
 		"thing_type": t.Type(),
 		"lon":        lon,
@@ -159,62 +262,356 @@ func (db database) AddThing(ctx context.Context, t things.Thing) error {
 		return err
 	}
 
+	err = addToHistory(ctx, tx, t.ID())
+	if err != nil {
+		return err
+	}
+
+	err = addToOutbox(ctx, tx, t.ID(), events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
+
 	return nil
 }
 
-func (db database) UpdateThing(ctx context.Context, t things.Thing) error {
+// UpdateThing updates a thing and adds an entry to the outbox, in the same transaction, so that a thing.updated event is published.
+// app.ErrDeviceAttached is returned if a device is attached that is already attached to another thing of the same type.
+// The thing is only updated if its current version is version, otherwise app.ErrVersionConflict is returned. Version 0 updates the thing regardless of its version.
+func (db database) UpdateThing(ctx context.Context, t things.Thing, version int64, events ...messaging.TopicMessage) error {
 	log := logging.GetFromContext(ctx)
 
 	lat, lon := t.LatLon()
 
-	update := `UPDATE things SET location=point(@lon,@lat), data=@data, modified_on=CURRENT_TIMESTAMP WHERE id=@id;`
-	_, err := db.pool.Exec(ctx, update, pgx.NamedArgs{
-		"id":   t.ID(),
-		"lon":  lon,
-		"lat":  lat,
-		"data": string(t.Byte()),
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := attachedDevices(ctx, tx, t.ID())
+	if err != nil {
+		return err
+	}
+
+	err = checkDevices(ctx, tx, t, before)
+	if err != nil {
+		return err
+	}
+
+	update := `
+		UPDATE things SET location=point(@lon,@lat), data=@data, version=version+1, modified_on=CURRENT_TIMESTAMP
+		WHERE id=@id AND deleted_on IS NULL AND (@version::bigint = 0 OR version=@version);`
+	tag, err := tx.Exec(ctx, update, pgx.NamedArgs{
+		"id":      t.ID(),
+		"lon":     lon,
+		"lat":     lat,
+		"data":    string(t.Byte()),
+		"version": version,
 	})
 	if err != nil {
 		log.Error("could not execute statement", "err", err.Error())
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return notUpdatedErr(ctx, tx, t.ID(), false)
+	}
+
+	insert := `INSERT INTO things_outbox(thing_id) VALUES (@thing_id);`
+	_, err = tx.Exec(ctx, insert, pgx.NamedArgs{
+		"thing_id": t.ID(),
+	})
+	if err != nil {
+		log.Error("could not add outbox entry", "err", err.Error())
+		return err
+	}
+
+	err = addToHistory(ctx, tx, t.ID())
+	if err != nil {
+		return err
+	}
+
+	err = addToOutbox(ctx, tx, t.ID(), events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
 
 	return nil
 }
 
-func (db database) DeleteThing(ctx context.Context, id string) error {
+// DeleteThing marks a thing as deleted if its current version is version, otherwise app.ErrVersionConflict is returned. Version 0 deletes the thing regardless of its version.
+func (db database) DeleteThing(ctx context.Context, id string, version int64, events ...messaging.TopicMessage) error {
 	log := logging.GetFromContext(ctx)
 
-	delete := `UPDATE things SET deleted_on=CURRENT_TIMESTAMP WHERE id=@id;`
-	_, err := db.pool.Exec(ctx, delete, pgx.NamedArgs{
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	delete := `
+		UPDATE things SET deleted_on=CURRENT_TIMESTAMP, version=version+1
+		WHERE id=@id AND deleted_on IS NULL AND (@version::bigint = 0 OR version=@version);`
+	tag, err := tx.Exec(ctx, delete, pgx.NamedArgs{
+		"id":      id,
+		"version": version,
+	})
+	if err != nil {
+		log.Error("could not execute statement", "err", err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notUpdatedErr(ctx, tx, id, false)
+	}
+
+	err = addToHistory(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = addToOutbox(ctx, tx, id, events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RestoreThing restores a deleted thing if its current version is version, otherwise app.ErrVersionConflict is returned. Version 0 restores the thing regardless of its version.
+// app.ErrDeviceAttached is returned if a device of the thing has been attached to another thing of the same type since it was deleted.
+func (db database) RestoreThing(ctx context.Context, id string, version int64, events ...messaging.TopicMessage) error {
+	log := logging.GetFromContext(ctx)
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var b []byte
+	err = tx.QueryRow(ctx, `SELECT data FROM things WHERE id=@id FOR UPDATE`, pgx.NamedArgs{
 		"id": id,
+	}).Scan(&b)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Error("could not execute query", "err", err.Error())
+		return err
+	}
+	if err == nil {
+		t, err := things.ConvToThing(b)
+		if err != nil {
+			return err
+		}
+
+		// devices of a deleted thing are not checked, they may have been attached to another thing
+		err = checkDevices(ctx, tx, t, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	restore := `
+		UPDATE things SET deleted_on=NULL, version=version+1, modified_on=CURRENT_TIMESTAMP
+		WHERE id=@id AND deleted_on IS NOT NULL AND (@version::bigint = 0 OR version=@version);`
+	tag, err := tx.Exec(ctx, restore, pgx.NamedArgs{
+		"id":      id,
+		"version": version,
 	})
 	if err != nil {
 		log.Error("could not execute statement", "err", err.Error())
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return notUpdatedErr(ctx, tx, id, true)
+	}
+
+	err = addToHistory(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = addToOutbox(ctx, tx, id, events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
 
 	return nil
 }
 
+// PurgeThing permanently removes a thing, deleted or not, together with its history and values. The thing is only
+// removed if its current version is version, otherwise app.ErrVersionConflict is returned. Version 0 removes the thing
+// regardless of its version.
+func (db database) PurgeThing(ctx context.Context, id string, version int64, events ...messaging.TopicMessage) error {
+	log := logging.GetFromContext(ctx)
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		log.Error("could not begin transaction", "err", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM things WHERE id=@id AND (@version::bigint = 0 OR version=@version);`, pgx.NamedArgs{
+		"id":      id,
+		"version": version,
+	})
+	if err != nil {
+		log.Error("could not execute statement", "err", err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM things WHERE id=@id)`, pgx.NamedArgs{"id": id}).Scan(&exists)
+		if err != nil {
+			log.Error("could not execute query", "err", err.Error())
+			return err
+		}
+		if !exists {
+			return app.ErrThingNotFound
+		}
+		return app.ErrVersionConflict
+	}
+
+	// the values of a thing are found using the things_values_thing_idx index, i.e. without scanning every chunk
+	purge := []string{
+		`DELETE FROM things_values WHERE split_part(id, '/', 1)=@id;`,
+		`DELETE FROM things_history WHERE id=@id;`,
+	}
+
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	for _, stmt := range purge {
+		_, err = tx.Exec(ctx, stmt, args)
+		if err != nil {
+			log.Error("could not execute statement", "err", err.Error())
+			return err
+		}
+	}
+
+	err = addToOutbox(ctx, tx, id, events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Error("could not commit transaction", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// PurgeDeletedThings permanently removes things, with their history and values, that were deleted before deletedBefore
+func (db database) PurgeDeletedThings(ctx context.Context, deletedBefore time.Time) (int, error) {
+	log := logging.GetFromContext(ctx)
+
+	rows, err := db.conn.Query(ctx, `SELECT id, version FROM things WHERE deleted_on IS NOT NULL AND deleted_on < @deleted_before`, pgx.NamedArgs{
+		"deleted_before": deletedBefore.UTC(),
+	})
+	if err != nil {
+		log.Error("could not execute query", "err", err.Error())
+		return 0, err
+	}
+
+	deleted, err := pgx.CollectRows(rows, pgx.RowToStructByPos[struct {
+		ID      string
+		Version int64
+	}])
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+
+	for _, t := range deleted {
+		// a thing that has been restored, or changed, since it was read is not removed
+		err = db.PurgeThing(ctx, t.ID, t.Version)
+		if errors.Is(err, app.ErrVersionConflict) || errors.Is(err, app.ErrThingNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// notUpdatedErr returns app.ErrThingNotFound if the thing does not exist (or is not deleted when deleted is true), otherwise app.ErrVersionConflict
+func notUpdatedErr(ctx context.Context, tx pgx.Tx, id string, deleted bool) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM things WHERE id=@id AND (deleted_on IS NOT NULL)=@deleted)`, pgx.NamedArgs{
+		"id":      id,
+		"deleted": deleted,
+	}).Scan(&exists)
+	if err != nil {
+		logging.GetFromContext(ctx).Error("could not execute query", "err", err.Error())
+		return err
+	}
+
+	if !exists {
+		return app.ErrThingNotFound
+	}
+
+	return app.ErrVersionConflict
+}
+
 func (db database) QueryThings(ctx context.Context, conditions ...app.ConditionFunc) (app.QueryResult, error) {
 	where, args := newQueryThingsParams(conditions...)
 	log := logging.GetFromContext(ctx)
 
-	query := fmt.Sprintf("SELECT data, count(*) OVER () AS total FROM things %s", where)
+	from := "things"
+	if _, ok := args["asof"]; ok {
+		from = thingsAsOf
+	}
+
+	query := fmt.Sprintf("SELECT data, version, count(*) OVER () AS total FROM %s %s", from, where)
 
-	rows, err := db.pool.Query(ctx, query, args)
+	rows, err := db.conn.Query(ctx, query, args)
 	if err != nil {
 		log.Error("could not execute query", "err", err.Error())
 		return app.QueryResult{}, err
 	}
 
 	var t [][]byte
+	var versions []int64
 	var total int64
 	var data []byte
+	var version int64
 
-	_, err = pgx.ForEachRow(rows, []any{&data, &total}, func() error {
+	_, err = pgx.ForEachRow(rows, []any{&data, &version, &total}, func() error {
 		t = append(t, data)
+		versions = append(versions, version)
 		return nil
 	})
 	if err != nil {
@@ -223,6 +620,7 @@ func (db database) QueryThings(ctx context.Context, conditions ...app.ConditionF
 
 	return app.QueryResult{
 		Data:       t,
+		Versions:   versions,
 		Count:      len(t),
 		TotalCount: total,
 		Limit:      args["limit"].(int),
@@ -235,16 +633,17 @@ func (db database) QueryValues(ctx context.Context, conditions ...app.ConditionF
 	log := logging.GetFromContext(ctx)
 
 	if _, ok := args["timeunit"]; ok {
-		return db.countValues(ctx, where, args)
+		return db.aggregateValues(ctx, where, args)
 	}
 
-	if _,ok := args["showlatest"]; ok {
-		return db.showLatest(ctx, args["thingid"].(string))
+	if _, ok := args["showlatest"]; ok {
+		tenants, _ := args["tenants"].([]string)
+		return db.showLatest(ctx, args["thingid"].(string), tenants)
 	}
 
 	query := fmt.Sprintf("SELECT time,id,urn,location,v,vs,vb,unit,ref, count(*) OVER () AS total FROM things_values %s ", where)
 
-	rows, err := db.pool.Query(ctx, query, args)
+	rows, err := db.conn.Query(ctx, query, args)
 	if err != nil {
 		log.Error("could not execute query", "err", err.Error())
 		return app.QueryResult{}, err
@@ -291,19 +690,26 @@ func (db database) QueryValues(ctx context.Context, conditions ...app.ConditionF
 	}, nil
 }
 
-func (db database) showLatest(ctx context.Context, thingID string) (app.QueryResult, error) {
+func (db database) showLatest(ctx context.Context, thingID string, tenants []string) (app.QueryResult, error) {
 	log := logging.GetFromContext(ctx)
 
-	thingID = fmt.Sprintf("%s/%%", thingID)
+	q := newQueryBuilder()
+	q.where("id LIKE " + q.arg("thing_id", likePrefix(thingID+"/")))
+
+	if len(tenants) > 0 {
+		q.where("EXISTS (SELECT 1 FROM things WHERE things.id=split_part(things_values.id, '/', 1) AND things.tenant=ANY(" + q.arg("tenants", tenants) + "))")
+	}
+
+	q.order(`id, "time" DESC`)
+
+	where, args := q.build()
 
 	query := fmt.Sprintf(`
 		SELECT DISTINCT ON (id) time, id, urn, v, vs, vb, unit, ref
 		FROM things_values
-		WHERE id LIKE '%s'
-		ORDER BY id, "time" DESC;	
-	`, thingID)
+		%s;`, where)
 
-	rows, err := db.pool.Query(ctx, query)
+	rows, err := db.conn.Query(ctx, query, args)
 	if err != nil {
 		log.Error("could not execute query", "err", err.Error())
 		return app.QueryResult{}, err
@@ -348,49 +754,90 @@ func (db database) showLatest(ctx context.Context, thingID string) (app.QueryRes
 	}, nil
 }
 
-func (db database) countValues(ctx context.Context, where string, args pgx.NamedArgs) (app.QueryResult, error) {
-	log := logging.GetFromContext(ctx)
+type aggregate struct {
+	ID        string    `json:"id,omitempty"`
+	Ref       string    `json:"ref"`
+	Count     int64     `json:"count"`
+	Avg       *float64  `json:"avg,omitempty"`
+	Min       *float64  `json:"min,omitempty"`
+	Max       *float64  `json:"max,omitempty"`
+	Sum       *float64  `json:"sum,omitempty"`
+	First     *float64  `json:"first,omitempty"`
+	Last      *float64  `json:"last,omitempty"`
+	Delta     *float64  `json:"delta,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
 
-	timeUnit := args["timeunit"].(string)
+// aggregateValues counts, and aggregates, values per time bucket using time_bucket. Buckets are aligned to the time zone in args["timezone"].
+func (db database) aggregateValues(ctx context.Context, where string, args pgx.NamedArgs) (app.QueryResult, error) {
+	log := logging.GetFromContext(ctx)
 
-	if !slices.Contains([]string{"hour", "day"}, timeUnit) {
-		timeUnit = "hour"
+	// values without a ref are stored with a NULL ref
+	columns, groupBy := "id, COALESCE(ref, '') AS ref", "id, ref"
+	if args["groupby"] == "ref" {
+		columns, groupBy = "'' AS id, COALESCE(ref, '') AS ref", "ref"
 	}
 
 	query := fmt.Sprintf(`
-		SELECT DATE_TRUNC('%s', time) e, id, ref, count(*) n
+		SELECT time_bucket(@timeunit::interval, time, @timezone::text) e, %s, count(*) n,
+			avg(v), min(v), max(v), sum(v), first(v, time), last(v, time)
 		FROM things_values
 		%s
-		GROUP BY e, id, ref 
-		ORDER BY e ASC;
-	`, timeUnit, where)
+		GROUP BY e, %s
+		ORDER BY e ASC, %s ASC;
+	`, columns, where, groupBy, groupBy)
 
-	rows, err := db.pool.Query(ctx, query, args)
+	rows, err := db.conn.Query(ctx, query, args)
 	if err != nil {
 		log.Error("could not execute query", "err", err.Error())
 		return app.QueryResult{}, err
 	}
 
+	loc, err := time.LoadLocation(args["timezone"].(string))
+	if err != nil {
+		loc = time.UTC
+	}
+
+	aggr, _ := args["aggr"].([]string)
+
 	var t [][]byte
 
 	var ts time.Time
 	var n int64
 	var id, ref string
+	var avg, minV, maxV, sum, first, last *float64
 
-	_, err = pgx.ForEachRow(rows, []any{&ts, &id, &ref, &n}, func() error {
-		count := struct {
-			ID        string    `json:"id"`
-			Ref       string    `json:"ref"`
-			Count     int64     `json:"count"`
-			Timestamp time.Time `json:"timestamp"`
-		}{
+	_, err = pgx.ForEachRow(rows, []any{&ts, &id, &ref, &n, &avg, &minV, &maxV, &sum, &first, &last}, func() error {
+		a := aggregate{
 			ID:        id,
 			Ref:       ref,
 			Count:     n,
-			Timestamp: ts.UTC(),
+			Timestamp: ts.In(loc),
+		}
+
+		for _, fn := range aggr {
+			switch fn {
+			case "avg":
+				a.Avg = avg
+			case "min":
+				a.Min = minV
+			case "max":
+				a.Max = maxV
+			case "sum":
+				a.Sum = sum
+			case "first":
+				a.First = first
+			case "last":
+				a.Last = last
+			case "delta":
+				if first != nil && last != nil {
+					delta := *last - *first
+					a.Delta = &delta
+				}
+			}
 		}
 
-		b, _ := json.Marshal(count)
+		b, _ := json.Marshal(a)
 		t = append(t, b)
 
 		return nil
@@ -421,7 +868,7 @@ func (db database) GetTags(ctx context.Context, tenants []string) ([]string, err
 	args := pgx.NamedArgs{
 		"tenants": tenants,
 	}
-	rows, err := db.pool.Query(ctx, query, args)
+	rows, err := db.conn.Query(ctx, query, args)
 	if err != nil {
 		log.Error("could not execute query", "err", err.Error())
 		return []string{}, err
@@ -456,7 +903,7 @@ func (db database) AddValue(ctx context.Context, t things.Thing, m things.Value)
 		ref = &m.Ref
 	}
 
-	_, err := db.pool.Exec(ctx, insert, pgx.NamedArgs{
+	_, err := db.conn.Exec(ctx, insert, pgx.NamedArgs{
 		"time": m.Timestamp.UTC(),
 		"id":   m.ID,
 		"urn":  m.Urn,
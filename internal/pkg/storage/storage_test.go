@@ -2,6 +2,10 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,6 +13,7 @@ import (
 	"github.com/diwise/iot-things/internal/app/iot-things/things"
 	"github.com/diwise/iot-things/internal/pkg/auth"
 	"github.com/google/uuid"
+	"github.com/matryer/is"
 )
 
 func TestAddThing(t *testing.T) {
@@ -47,6 +52,266 @@ func TestAddThingWithDevices(t *testing.T) {
 	}
 }
 
+func TestDeviceIsAttachedToOneThingOfEachType(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	deviceID := uuid.NewString()
+
+	first := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	first.AddDevice(deviceID)
+	is.NoErr(db.AddThing(ctx, first))
+	is.NoErr(db.UpdateThing(ctx, first, 0))
+
+	second := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	second.AddDevice(deviceID)
+	is.True(errors.Is(db.AddThing(ctx, second), app.ErrDeviceAttached))
+	is.NoErr(db.AddThing(app.WithSharedDevice(ctx, deviceID), second))
+
+	third := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	is.NoErr(db.AddThing(ctx, third))
+	third.AddDevice(deviceID)
+	is.True(errors.Is(db.UpdateThing(ctx, third, 0), app.ErrDeviceAttached))
+}
+
+func TestRestoreThingWithDeviceAttachedToAnotherThing(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	deviceID := uuid.NewString()
+
+	first := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	first.AddDevice(deviceID)
+	is.NoErr(db.AddThing(ctx, first))
+	is.NoErr(db.DeleteThing(ctx, first.ID(), 0))
+
+	second := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	second.AddDevice(deviceID)
+	is.NoErr(db.AddThing(ctx, second))
+
+	is.True(errors.Is(db.RestoreThing(ctx, first.ID(), 0), app.ErrDeviceAttached))
+}
+
+func TestUpdateThingWithVersion(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	thing := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	is.NoErr(db.AddThing(ctx, thing))
+
+	result, err := db.QueryThings(ctx, app.WithID(thing.ID()))
+	is.NoErr(err)
+	is.Equal(result.Versions, []int64{1})
+
+	is.NoErr(db.UpdateThing(ctx, thing, 1))
+	is.True(errors.Is(db.UpdateThing(ctx, thing, 1), app.ErrVersionConflict))
+	is.True(errors.Is(db.DeleteThing(ctx, thing.ID(), 1), app.ErrVersionConflict))
+	is.NoErr(db.DeleteThing(ctx, thing.ID(), 2))
+	is.True(errors.Is(db.UpdateThing(ctx, thing, 0), app.ErrThingNotFound))
+}
+
+func TestThingHistoryOfMeasurements(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	thing := things.NewRoom(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	thing.AddDevice("device-01")
+	is.NoErr(db.AddThing(ctx, thing))
+
+	ctx = app.WithSource(ctx, app.SourceMeasurement)
+
+	temperature := 21.0
+	measurement := things.Measurement{ID: "device-01/3303/5700", Urn: things.TemperatureURN, Value: &temperature, Timestamp: time.Now()}
+
+	// only the measurements of the device and observedAt are changed
+	thing.SetLastObserved([]things.Measurement{measurement})
+	is.NoErr(db.UpdateThing(ctx, thing, 0))
+
+	thing.(*things.Room).Temperature = temperature
+	is.NoErr(db.UpdateThing(ctx, thing, 0))
+
+	result, err := db.QueryHistory(ctx, app.WithID(thing.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 2) // created and the changed temperature
+}
+
+func TestThingHistory(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	thing := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	is.NoErr(db.AddThing(ctx, thing))
+
+	created := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	thing.(*things.Container).Name = "container"
+	is.NoErr(db.UpdateThing(ctx, thing, 0))
+
+	ctx = auth.WithUser(app.WithSource(ctx, app.SourceSeed), "admin")
+	is.NoErr(db.DeleteThing(ctx, thing.ID(), 0))
+
+	result, err := db.QueryHistory(ctx, app.WithID(thing.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 3)
+
+	entries := []app.HistoryEntry{}
+	for _, b := range result.Data {
+		e := app.HistoryEntry{}
+		is.NoErr(json.Unmarshal(b, &e))
+		entries = append(entries, e)
+	}
+
+	is.Equal(entries[1].Source, app.SourceAPI)
+	is.Equal(string(entries[1].Diff), `{"name": "container"}`)
+	is.Equal(entries[2].Actor, "admin")
+	is.True(entries[2].Deleted)
+
+	result, err = db.QueryThings(ctx, app.WithID(thing.ID()), app.WithAsOf(created.Format(time.RFC3339Nano)))
+	is.NoErr(err)
+	is.Equal(result.Versions, []int64{1})
+}
+
+func TestRestoreAndPurgeThing(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	thing := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 17.2, Longitude: 64.3}, "default")
+	is.NoErr(db.AddThing(ctx, thing))
+	is.NoErr(db.DeleteThing(ctx, thing.ID(), 0))
+
+	result, err := db.QueryThings(ctx, app.WithID(thing.ID()), app.WithDeleted(true))
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+
+	is.True(errors.Is(db.RestoreThing(ctx, thing.ID(), 1), app.ErrVersionConflict))
+	is.NoErr(db.RestoreThing(ctx, thing.ID(), 2))
+	is.True(errors.Is(db.RestoreThing(ctx, thing.ID(), 0), app.ErrThingNotFound))
+
+	is.NoErr(db.DeleteThing(ctx, thing.ID(), 0))
+	n, err := db.PurgeDeletedThings(ctx, time.Now().Add(time.Minute))
+	is.NoErr(err)
+	is.True(n >= 1)
+
+	result, err = db.QueryHistory(ctx, app.WithID(thing.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 0)
+
+	// the id can be used again once the thing is purged
+	is.NoErr(db.AddThing(ctx, thing))
+	is.True(errors.Is(db.PurgeThing(ctx, thing.ID(), 99), app.ErrVersionConflict))
+	is.NoErr(db.PurgeThing(ctx, thing.ID(), 0))
+	is.True(errors.Is(db.PurgeThing(ctx, thing.ID(), 0), app.ErrThingNotFound))
+}
+
+func TestInTransaction(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	committed := things.NewRoom(uuid.NewString(), things.DefaultLocation, "default")
+	rolledBack := things.NewRoom(uuid.NewString(), things.DefaultLocation, "default")
+
+	is.NoErr(db.InTransaction(ctx, func(r app.ThingsReader, w app.ThingsWriter) error {
+		is.NoErr(w.AddThing(ctx, committed))
+		// a failed change does not abort the transaction
+		is.True(errors.Is(w.AddThing(ctx, committed), app.ErrAlreadyExists))
+		result, err := r.QueryThings(ctx, app.WithID(committed.ID()))
+		is.NoErr(err)
+		is.Equal(result.Count, 1)
+		return nil
+	}))
+
+	err = db.InTransaction(ctx, func(r app.ThingsReader, w app.ThingsWriter) error {
+		is.NoErr(w.AddThing(ctx, rolledBack))
+		return errors.New("roll back")
+	})
+	is.True(err != nil)
+
+	result, err := db.QueryThings(ctx, app.WithID(committed.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+
+	result, err = db.QueryThings(ctx, app.WithID(rolledBack.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 0)
+}
+
+func TestQueryParts(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+	is := is.New(t)
+
+	room := things.NewRoom(uuid.NewString(), things.DefaultLocation, "default")
+	is.NoErr(db.AddThing(ctx, room))
+
+	desk, err := things.ConvToThing([]byte(fmt.Sprintf(`{"id":"%s","type":"Desk","tenant":"default","refParent":"%s","relations":{"servedBy":["pump-001"]}}`, uuid.NewString(), room.ID())))
+	is.NoErr(err)
+	is.NoErr(db.AddThing(ctx, desk))
+
+	result, err := db.QueryThings(ctx, app.WithRefParent(room.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+
+	result, err = db.QueryThings(ctx, app.WithHasPart(desk.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+
+	result, err = db.QueryThings(ctx, app.WithRelation("servedBy", "pump-001"), app.WithID(desk.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 1)
+
+	result, err = db.QueryThings(ctx, app.WithRelation("", "pump-002"), app.WithID(desk.ID()))
+	is.NoErr(err)
+	is.Equal(result.Count, 0)
+}
+
 func TestQueryThings(t *testing.T) {
 	db, ctx, cancel, err := new()
 	defer cancel()
@@ -110,6 +375,226 @@ func TestQueryThings(t *testing.T) {
 	}
 }
 
+func TestQueryThingsSpatial(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+
+	tenant := uuid.NewString()
+
+	near := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 62.3908, Longitude: 17.3069}, tenant)
+	far := things.NewWasteContainer(uuid.NewString(), things.Location{Latitude: 62.4008, Longitude: 17.4135}, tenant)
+
+	err = db.AddThing(ctx, near)
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.AddThing(ctx, far)
+	if err != nil {
+		t.Error(err)
+	}
+
+	result, err := db.QueryThings(ctx, app.WithTenants([]string{tenant}), app.WithNear("62.3910,17.3070"), app.WithMaxDistance("500"))
+	if err != nil {
+		t.Error(err)
+	}
+	if result.TotalCount != 1 {
+		t.Errorf("expected one thing within 500 m, found %d", result.TotalCount)
+	}
+
+	result, err = db.QueryThings(ctx, app.WithTenants([]string{tenant}), app.WithNear("62.4000,17.4100"))
+	if err != nil {
+		t.Error(err)
+	}
+	if result.TotalCount != 2 || !strings.Contains(string(result.Data[0]), far.ID()) {
+		t.Errorf("expected things ordered by distance")
+	}
+
+	result, err = db.QueryThings(ctx, app.WithTenants([]string{tenant}), app.WithBBox("17.30,62.38,17.31,62.40"))
+	if err != nil {
+		t.Error(err)
+	}
+	if result.TotalCount != 1 {
+		t.Errorf("expected one thing within bbox, found %d", result.TotalCount)
+	}
+
+	result, err = db.QueryThings(ctx, app.WithTenants([]string{tenant}), app.WithinPolygon(`{"type":"Polygon","coordinates":[[[17.40,62.39],[17.42,62.39],[17.42,62.41],[17.40,62.41],[17.40,62.39]]]}`))
+	if err != nil {
+		t.Error(err)
+	}
+	if result.TotalCount != 1 {
+		t.Errorf("expected one thing within polygon, found %d", result.TotalCount)
+	}
+}
+
+func TestNewQueryThingsParamsSpatial(t *testing.T) {
+	query, args := newQueryThingsParams(app.WithParams(map[string][]string{
+		"near":        {"62.39,17.30"},
+		"maxDistance": {"500"},
+		"bbox":        {"17.0,62.0,18.0,63.0"},
+		"georel":      {"within"},
+		"geometry":    {`{"type":"Polygon","coordinates":[[[17,62],[18,62],[18,63],[17,62]]]}`},
+	})...)
+
+	if !strings.Contains(query, "location <@ box(point(@bbox_min_lon,@bbox_min_lat)") {
+		t.Errorf("expected bbox condition in %s", query)
+	}
+	if !strings.Contains(query, "<= @max_distance") || args["max_distance"] != 500.0 {
+		t.Errorf("expected max distance condition in %s", query)
+	}
+	if args["within"] != "((17,62),(18,62),(18,63),(17,62))" {
+		t.Errorf("unexpected polygon %v", args["within"])
+	}
+	if !strings.Contains(query, "ORDER BY (2 * 6371008.8") {
+		t.Errorf("expected things to be ordered by distance in %s", query)
+	}
+}
+
+func TestQueryValuesAggregates(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+
+	thingID := uuid.NewString()
+	thing := things.NewRoom(thingID, things.DefaultLocation, "default")
+
+	err = db.AddThing(ctx, thing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, v := range []float64{20, 22, 21, 25} {
+		value := v
+		err = db.AddValue(ctx, thing, things.Value{
+			Measurement: things.Measurement{
+				ID:        thingID + "/3303/5700",
+				Urn:       "urn:oma:lwm2m:ext:3303",
+				Value:     &value,
+				Timestamp: ts.Add(time.Duration(i*10) * time.Minute),
+			},
+			Ref: "device-01",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := db.QueryValues(ctx, app.WithParams(map[string][]string{
+		"thingid":  {thingID},
+		"timeunit": {"30m"},
+		"aggr":     {"avg,min,max,delta"},
+		"tenant":   {"default"},
+	})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Count != 2 {
+		t.Fatalf("expected two buckets, found %d", result.Count)
+	}
+
+	expected := `"count":3,"avg":21,"min":20,"max":22,"delta":1`
+	if !strings.Contains(string(result.Data[0]), expected) {
+		t.Errorf("expected %s in %s", expected, string(result.Data[0]))
+	}
+}
+
+func TestQueryValuesAggregatesWithoutRef(t *testing.T) {
+	db, ctx, cancel, err := new()
+	defer cancel()
+
+	if err != nil {
+		t.Log("could not connect to database or create tables, will skip test")
+		t.SkipNow()
+	}
+
+	thingID := uuid.NewString()
+	thing := things.NewRoom(thingID, things.DefaultLocation, "default")
+
+	err = db.AddThing(ctx, thing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := 20.0
+	err = db.AddValue(ctx, thing, things.Value{
+		Measurement: things.Measurement{
+			ID:        thingID + "/3303/5700",
+			Urn:       "urn:oma:lwm2m:ext:3303",
+			Value:     &value,
+			Timestamp: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, groupBy := range []string{"", "ref"} {
+		params := map[string][]string{
+			"thingid":  {thingID},
+			"timeunit": {"hour"},
+			"aggr":     {"avg"},
+			"tenant":   {"default"},
+		}
+		if groupBy != "" {
+			params["groupby"] = []string{groupBy}
+		}
+
+		result, err := db.QueryValues(ctx, app.WithParams(params)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Count != 1 {
+			t.Fatalf("expected one bucket, found %d", result.Count)
+		}
+	}
+}
+
+func TestNewQueryValuesParamsAggregates(t *testing.T) {
+	_, args := newQueryValuesParams(app.WithParams(map[string][]string{
+		"timeunit": {"15m"},
+		"aggr":     {"avg,max", "last", "median"},
+		"timezone": {"Europe/Stockholm"},
+		"groupBy":  {"ref"},
+		"limit":    {"10"},
+	})...)
+
+	if args["timeunit"] != "15 minutes" {
+		t.Errorf("unexpected time bucket %v", args["timeunit"])
+	}
+	if args["timezone"] != "Europe/Stockholm" {
+		t.Errorf("unexpected time zone %v", args["timezone"])
+	}
+	if strings.Join(args["aggr"].([]string), ",") != "avg,max,last" {
+		t.Errorf("unexpected aggregates %v", args["aggr"])
+	}
+	if args["groupby"] != "ref" {
+		t.Errorf("expected values to be grouped by ref")
+	}
+	if _, ok := args["limit"]; ok {
+		t.Errorf("aggregates should not be paged")
+	}
+
+	_, args = newQueryValuesParams(app.WithParams(map[string][]string{
+		"timeunit": {"week"},
+		"timezone": {"Not/AZone"},
+	})...)
+
+	if args["timeunit"] != "1 week" || args["timezone"] != "UTC" {
+		t.Errorf("unexpected time bucket %v in %v", args["timeunit"], args["timezone"])
+	}
+}
+
 func new() (Storage, context.Context, context.CancelFunc, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	ctx = auth.WithAllowedTenants(ctx, []string{"default"})
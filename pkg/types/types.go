@@ -25,3 +25,62 @@ func (t *ThingUpdated) ContentType() string {
 func (t *ThingUpdated) TopicName() string {
 	return "thing.updated"
 }
+
+type ThingCreated struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Thing     any       `json:"thing,omitempty"`
+	Tenant    string    `json:"tenant"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (t *ThingCreated) Body() []byte {
+	b, _ := json.Marshal(t)
+	return b
+}
+func (t *ThingCreated) ContentType() string {
+	return fmt.Sprintf("application/vnd.diwise.%s+json", strings.ToLower(t.Type))
+}
+func (t *ThingCreated) TopicName() string {
+	return "thing.created"
+}
+
+type ThingDeleted struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Thing     any       `json:"thing,omitempty"`
+	Tenant    string    `json:"tenant"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (t *ThingDeleted) Body() []byte {
+	b, _ := json.Marshal(t)
+	return b
+}
+func (t *ThingDeleted) ContentType() string {
+	return fmt.Sprintf("application/vnd.diwise.%s+json", strings.ToLower(t.Type))
+}
+func (t *ThingDeleted) TopicName() string {
+	return "thing.deleted"
+}
+
+// ThingDevicesChanged is published when devices are connected to, or disconnected from, a thing
+type ThingDevicesChanged struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Tenant    string    `json:"tenant"`
+	Before    []string  `json:"before"`
+	After     []string  `json:"after"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (t *ThingDevicesChanged) Body() []byte {
+	b, _ := json.Marshal(t)
+	return b
+}
+func (t *ThingDevicesChanged) ContentType() string {
+	return fmt.Sprintf("application/vnd.diwise.%s+json", strings.ToLower(t.Type))
+}
+func (t *ThingDevicesChanged) TopicName() string {
+	return "thing.devicesChanged"
+}